@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/openshift/ocm-agent/pkg/logging"
+)
+
+const (
+	// OutcomeSent means OCM accepted the notification
+	OutcomeSent = "sent"
+	// OutcomeFailed means the notification could not be posted to OCM
+	OutcomeFailed = "failed"
+	// OutcomeDryRun means the notification was not posted as OCM Agent runs in dry run mode
+	OutcomeDryRun = "dry_run"
+	// OutcomeUnknownCluster means the notification was not posted as its cluster is not known to OCM, or not
+	// managed by the management cluster reporting it in fleet mode
+	OutcomeUnknownCluster = "unknown_cluster"
+	// OutcomeCancelled means the notification was not posted as the request of its alert was cancelled, or ran
+	// out of time, first
+	OutcomeCancelled = "cancelled"
+	// OutcomeOptedOut means the notification was not posted as the preferences of its cluster disable it
+	OutcomeOptedOut = "opted_out"
+	// OutcomeTemplateNotFound means the notification was not posted as the notification template of its alert does
+	// not exist
+	OutcomeTemplateNotFound = "template_not_found"
+)
+
+var log = logging.Subsystem(logging.SubsystemHandlers)
+
+// Record is a single record of a notification posted, or attempted to be posted, to a customer
+type Record struct {
+	Timestamp        time.Time `json:"timestamp"`
+	ClusterID        string    `json:"cluster_id"`
+	Template         string    `json:"template"`
+	Summary          string    `json:"summary"`
+	Description      string    `json:"description"`
+	Firing           bool      `json:"firing"`
+	AlertFingerprint string    `json:"alert_fingerprint,omitempty"`
+	OperationID      string    `json:"operation_id,omitempty"`
+	Outcome          string    `json:"outcome"`
+	Error            string    `json:"error,omitempty"`
+
+	// Object is the notification template the record relates to, it is not persisted
+	Object runtime.Object `json:"-"`
+}
+
+// Backend persists audit records
+type Backend interface {
+	Write(r Record) error
+}
+
+var (
+	mutex    sync.RWMutex
+	backends []Backend
+)
+
+// SetBackends replaces the backends audit records are recorded to
+func SetBackends(b ...Backend) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	backends = b
+}
+
+// Write sends the record to every configured backend. A failing backend is logged and does not
+// prevent the record from reaching the others.
+func Write(r Record) {
+	if r.Timestamp.IsZero() {
+		r.Timestamp = time.Now().UTC()
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for _, b := range backends {
+		err := b.Write(r)
+		if err != nil {
+			log.WithError(err).WithField("template", r.Template).Error("unable to write audit record")
+		}
+	}
+}
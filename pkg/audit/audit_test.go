@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/client-go/tools/record"
+
+	testconst "github.com/openshift/ocm-agent/pkg/consts/test"
+)
+
+type failingBackend struct{}
+
+func (failingBackend) Write(r Record) error {
+	return fmt.Errorf("backend unavailable")
+}
+
+type memoryBackend struct {
+	records []Record
+}
+
+func (b *memoryBackend) Write(r Record) error {
+	b.records = append(b.records, r)
+	return nil
+}
+
+var _ = Describe("Audit trail", func() {
+
+	var (
+		dir      string
+		testFile string
+	)
+
+	newRecord := func(clusterID, outcome string) Record {
+		return Record{
+			Timestamp: time.Now().UTC(),
+			ClusterID: clusterID,
+			Template:  testconst.TestNotificationName,
+			Summary:   "Issue Notification: test-summary",
+			Firing:    true,
+			Outcome:   outcome,
+		}
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		testFile = filepath.Join(dir, "audit.jsonl")
+	})
+
+	AfterEach(func() {
+		SetBackends()
+	})
+
+	Context("When recording an record", func() {
+		It("reaches every backend even if one fails", func() {
+			mem := &memoryBackend{}
+			SetBackends(failingBackend{}, mem)
+			Write(newRecord("cluster-a", OutcomeSent))
+			Expect(mem.records).To(HaveLen(1))
+			Expect(mem.records[0].Timestamp.IsZero()).To(BeFalse())
+		})
+	})
+
+	Context("When using the file backend", func() {
+		It("appends JSON lines that can be queried", func() {
+			b, err := NewFileBackend(testFile, 0, 0)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(b.Write(newRecord("cluster-a", OutcomeSent))).To(Succeed())
+			Expect(b.Write(newRecord("cluster-b", OutcomeFailed))).To(Succeed())
+			Expect(b.Close()).To(Succeed())
+
+			records, err := Query(testFile, 0, Filter{})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(records).To(HaveLen(2))
+
+			records, err = Query(testFile, 0, Filter{ClusterID: "cluster-b"})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(records).To(HaveLen(1))
+			Expect(records[0].Outcome).To(Equal(OutcomeFailed))
+		})
+		It("rotates the file and keeps at most the configured backups", func() {
+			line, _ := os.ReadFile(testFile)
+			Expect(line).To(BeEmpty())
+			b, err := NewFileBackend(testFile, 200, 2)
+			Expect(err).ShouldNot(HaveOccurred())
+			for i := 0; i < 5; i++ {
+				Expect(b.Write(newRecord(fmt.Sprintf("cluster-%d", i), OutcomeSent))).To(Succeed())
+			}
+			Expect(b.Close()).To(Succeed())
+
+			Expect(backupName(testFile, 1)).To(BeAnExistingFile())
+			Expect(backupName(testFile, 2)).To(BeAnExistingFile())
+			Expect(backupName(testFile, 3)).ToNot(BeAnExistingFile())
+
+			records, err := Query(testFile, 2, Filter{})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(records).To(HaveLen(3))
+			Expect(records[0].ClusterID).To(Equal("cluster-2"))
+			Expect(records[2].ClusterID).To(Equal("cluster-4"))
+		})
+		It("filters records older than the since time", func() {
+			b, err := NewFileBackend(testFile, 0, 0)
+			Expect(err).ShouldNot(HaveOccurred())
+			old := newRecord("cluster-a", OutcomeSent)
+			old.Timestamp = time.Now().Add(-48 * time.Hour)
+			Expect(b.Write(old)).To(Succeed())
+			Expect(b.Write(newRecord("cluster-a", OutcomeSent))).To(Succeed())
+			Expect(b.Close()).To(Succeed())
+
+			records, err := Query(testFile, 0, Filter{Since: time.Now().Add(-24 * time.Hour)})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(records).To(HaveLen(1))
+		})
+	})
+
+	Context("When using the event backend", func() {
+		var recorder *record.FakeRecorder
+		BeforeEach(func() {
+			recorder = record.NewFakeRecorder(10)
+		})
+		It("records a normal event for a sent service log", func() {
+			e := newRecord("cluster-a", OutcomeSent)
+			e.Object = &testconst.TestManagedNotification
+			Expect(NewEventBackend(recorder).Write(e)).To(Succeed())
+			Expect(<-recorder.Events).To(HavePrefix("Normal " + EventReasonServiceLogSent))
+		})
+		It("records a warning event for a failed service log", func() {
+			e := newRecord("cluster-a", OutcomeFailed)
+			e.Error = "internal server error"
+			e.Object = &testconst.TestManagedNotification
+			Expect(NewEventBackend(recorder).Write(e)).To(Succeed())
+			event := <-recorder.Events
+			Expect(event).To(HavePrefix("Warning " + EventReasonServiceLogFailed))
+			Expect(strings.HasSuffix(event, "internal server error")).To(BeTrue())
+		})
+		It("records a warning event for an unknown cluster", func() {
+			e := newRecord("cluster-a", OutcomeUnknownCluster)
+			e.Object = &testconst.TestManagedNotification
+			Expect(NewEventBackend(recorder).Write(e)).To(Succeed())
+			Expect(<-recorder.Events).To(HavePrefix("Warning " + EventReasonUnknownCluster))
+		})
+		It("records a normal event for a notification disabled by the preferences of its cluster", func() {
+			e := newRecord("cluster-a", OutcomeOptedOut)
+			e.Error = "log type disabled"
+			e.Object = &testconst.TestManagedNotification
+			Expect(NewEventBackend(recorder).Write(e)).To(Succeed())
+			Expect(<-recorder.Events).To(HavePrefix("Normal " + EventReasonOptedOut))
+		})
+		It("ignores records without an object", func() {
+			Expect(NewEventBackend(recorder).Write(newRecord("cluster-a", OutcomeSent))).To(Succeed())
+			Expect(recorder.Events).To(BeEmpty())
+		})
+	})
+})
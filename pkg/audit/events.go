@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// EventReasonServiceLogSent is the reason of the event recorded when a service log is sent
+	EventReasonServiceLogSent = "ServiceLogSent"
+	// EventReasonServiceLogFailed is the reason of the event recorded when a service log can't be sent
+	EventReasonServiceLogFailed = "ServiceLogFailed"
+	// EventReasonUnknownCluster is the reason of the event recorded when the cluster of an alert is unknown
+	EventReasonUnknownCluster = "UnknownCluster"
+	// EventReasonOptedOut is the reason of the event recorded when the preferences of a cluster disable a notification
+	EventReasonOptedOut = "NotificationOptedOut"
+
+	// maxEventMessageLength keeps event messages well under the API server limit
+	maxEventMessageLength = 1024
+)
+
+// EventBackend records audit records as Kubernetes Events on the notification template they relate to
+type EventBackend struct {
+	recorder record.EventRecorder
+}
+
+// NewEventBackend returns a backend recording events with the given recorder
+func NewEventBackend(recorder record.EventRecorder) *EventBackend {
+	return &EventBackend{
+		recorder: recorder,
+	}
+}
+
+// Write emits an event for the record, records with no related object are ignored
+func (b *EventBackend) Write(r Record) error {
+	if r.Object == nil {
+		return nil
+	}
+	state := "resolved"
+	if r.Firing {
+		state = "firing"
+	}
+	msg := fmt.Sprintf("%s service log for %s to cluster %s: %s", state, r.Template, r.ClusterID, r.Summary)
+	if r.OperationID != "" {
+		msg += fmt.Sprintf(" (operation ID %s)", r.OperationID)
+	}
+	if r.Outcome == OutcomeDryRun {
+		// Nothing was posted to OCM, the file backend and the logs are enough
+		return nil
+	}
+	if r.Outcome == OutcomeSent {
+		b.recorder.Event(r.Object, corev1.EventTypeNormal, EventReasonServiceLogSent, truncate(msg))
+		return nil
+	}
+	if r.Outcome == OutcomeUnknownCluster {
+		b.recorder.Event(r.Object, corev1.EventTypeWarning, EventReasonUnknownCluster, truncate(msg+": "+r.Error))
+		return nil
+	}
+	if r.Outcome == OutcomeOptedOut {
+		b.recorder.Event(r.Object, corev1.EventTypeNormal, EventReasonOptedOut, truncate(msg+": "+r.Error))
+		return nil
+	}
+	b.recorder.Event(r.Object, corev1.EventTypeWarning, EventReasonServiceLogFailed, truncate(msg+": "+r.Error))
+	return nil
+}
+
+func truncate(msg string) string {
+	if len(msg) <= maxEventMessageLength {
+		return msg
+	}
+	return msg[:maxEventMessageLength-3] + "..."
+}
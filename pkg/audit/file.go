@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileBackend appends audit records as JSON lines to a local file, rotating it once it reaches a maximum size
+type FileBackend struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+// NewFileBackend opens, or creates, the audit file at path. The file is rotated when writing an
+// record would make it larger than maxSize bytes and at most maxBackups rotated files are kept.
+func NewFileBackend(path string, maxSize int64, maxBackups int) (*FileBackend, error) {
+	b := &FileBackend{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Write appends the record to the audit file
+func (b *FileBackend) Write(r Record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.maxSize > 0 && b.size > 0 && b.size+int64(len(line)) > b.maxSize {
+		err = b.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	n, err := b.file.Write(line)
+	b.size += int64(n)
+	return err
+}
+
+// Close closes the audit file
+func (b *FileBackend) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.file.Close()
+}
+
+func (b *FileBackend) open() error {
+	f, err := os.OpenFile(b.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("can't open audit file %s: %w", b.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	b.file = f
+	b.size = info.Size()
+	return nil
+}
+
+// rotate shifts every backup by one, dropping the oldest, and starts a new audit file
+func (b *FileBackend) rotate() error {
+	err := b.file.Close()
+	if err != nil {
+		return err
+	}
+	if b.maxBackups > 0 {
+		for i := b.maxBackups - 1; i > 0; i-- {
+			_ = os.Rename(backupName(b.path, i), backupName(b.path, i+1))
+		}
+		err = os.Rename(b.path, backupName(b.path, 1))
+	} else {
+		err = os.Remove(b.path)
+	}
+	if err != nil {
+		return err
+	}
+	return b.open()
+}
+
+func backupName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
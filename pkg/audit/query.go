@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Filter selects audit records, empty fields match everything
+type Filter struct {
+	ClusterID string
+	Template  string
+	Outcome   string
+	Since     time.Time
+}
+
+// Matches indicates whether the record is selected by the filter
+func (f Filter) Matches(r Record) bool {
+	if f.ClusterID != "" && f.ClusterID != r.ClusterID {
+		return false
+	}
+	if f.Template != "" && f.Template != r.Template {
+		return false
+	}
+	if f.Outcome != "" && f.Outcome != r.Outcome {
+		return false
+	}
+	if !f.Since.IsZero() && r.Timestamp.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// Query returns the records matching the filter from the audit file at path and its rotated
+// backups, oldest first
+func Query(path string, maxBackups int, f Filter) ([]Record, error) {
+	var records []Record
+	files := []string{}
+	for i := maxBackups; i > 0; i-- {
+		files = append(files, backupName(path, i))
+	}
+	files = append(files, path)
+
+	for _, name := range files {
+		found, err := queryFile(name, f)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		records = append(records, found...)
+	}
+	return records, nil
+}
+
+func queryFile(name string, f Filter) ([]Record, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		// A partially written line can only happen on a crash, skip it rather than failing the query
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if f.Matches(r) {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
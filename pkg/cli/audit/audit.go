@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	kcmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"github.com/openshift/ocm-agent/pkg/audit"
+	"github.com/openshift/ocm-agent/pkg/config"
+	"github.com/openshift/ocm-agent/pkg/consts"
+)
+
+// queryOptions define the options used to search the audit trail
+type queryOptions struct {
+	file       string
+	maxBackups int
+	clusterID  string
+	template   string
+	outcome    string
+	since      time.Duration
+}
+
+var (
+	queryLong = templates.LongDesc(`
+	Search the audit trail of service logs posted by the OCM Agent
+
+	Entries are read from the audit file and its rotated backups and printed as JSON lines, oldest first.
+	`)
+
+	queryExample = templates.Examples(`
+	# Show every service log sent in the last day
+	ocm-agent audit query --audit-file /var/log/ocm-agent/audit.jsonl --since 24h
+
+	# Show the service logs that failed to be sent to a cluster
+	ocm-agent audit query --audit-file /var/log/ocm-agent/audit.jsonl --cluster-id abcd-1234 --outcome failed
+	`)
+)
+
+// NewAuditCmd initializes audit command and its subcommands
+func NewAuditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the audit trail of service logs posted by the OCM Agent",
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = cmd.Help()
+		},
+	}
+	cmd.AddCommand(newQueryCmd())
+	return cmd
+}
+
+func newQueryCmd() *cobra.Command {
+	o := &queryOptions{}
+	cmd := &cobra.Command{
+		Use:     "query",
+		Short:   "Search the audit trail",
+		Long:    queryLong,
+		Example: queryExample,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			kcmdutil.CheckErr(o.Run())
+		},
+	}
+
+	cmd.Flags().StringVar(&o.file, config.AuditFile, "", "Path of the audit file (string)")
+	cmd.Flags().IntVar(&o.maxBackups, config.AuditFileMaxBackups, consts.DefaultAuditFileMaxBackups, "Number of rotated audit files to search (int)")
+	cmd.Flags().StringVarP(&o.clusterID, config.ExternalClusterID, "c", "", "Only show records for this cluster ID (string)")
+	cmd.Flags().StringVar(&o.template, "template", "", "Only show records for this notification template (string)")
+	cmd.Flags().StringVar(&o.outcome, "outcome", "", "Only show records with this outcome, sent, failed, dry_run, unknown_cluster, cancelled, opted_out or template_not_found (string)")
+	cmd.Flags().DurationVar(&o.since, "since", 0, "Only show records more recent than this duration, e.g. 24h (duration)")
+	_ = cmd.MarkFlagRequired(config.AuditFile)
+
+	return cmd
+}
+
+// Run prints the matching audit records
+func (o *queryOptions) Run() error {
+	f := audit.Filter{
+		ClusterID: o.clusterID,
+		Template:  o.template,
+		Outcome:   o.outcome,
+	}
+	if o.since > 0 {
+		f.Since = time.Now().Add(-o.since)
+	}
+	records, err := audit.Query(o.file, o.maxBackups, f)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for _, e := range records {
+		err = enc.Encode(e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/openshift/ocm-agent/pkg/cli/audit"
 	"github.com/openshift/ocm-agent/pkg/cli/serve"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -25,6 +26,7 @@ func NewCmdRoot() *cobra.Command {
 
 	// Add subcommands
 	rootCmd.AddCommand(serve.NewServeCmd())
+	rootCmd.AddCommand(audit.NewAuditCmd())
 
 	return rootCmd
 }
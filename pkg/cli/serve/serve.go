@@ -1,12 +1,16 @@
 package serve
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/openshift/ocm-agent/pkg/audit"
 	"github.com/openshift/ocm-agent/pkg/consts"
 	"github.com/openshift/ocm-agent/pkg/ocm"
 	"github.com/sirupsen/logrus"
@@ -15,14 +19,18 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"k8s.io/client-go/tools/record"
 	kcmdutil "k8s.io/kubectl/pkg/cmd/util"
 	"k8s.io/kubectl/pkg/util/templates"
 
 	"github.com/openshift/ocm-agent/pkg/config"
+	"github.com/openshift/ocm-agent/pkg/diagnostics"
 	"github.com/openshift/ocm-agent/pkg/handlers"
 	"github.com/openshift/ocm-agent/pkg/k8s"
 	"github.com/openshift/ocm-agent/pkg/logging"
 	"github.com/openshift/ocm-agent/pkg/metrics"
+	"github.com/openshift/ocm-agent/pkg/sink"
+	"github.com/openshift/ocm-agent/pkg/suppression"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	sdk "github.com/openshift-online/ocm-sdk-go"
@@ -36,9 +44,35 @@ type serveOptions struct {
 	externalClusterID string
 	ocmClientID       string
 	ocmClientSecret   string
+	adminToken        string
+	auditFile         string
+	auditFileMaxSize  int
+	auditMaxBackups   int
+	sinksConfig       string
+	auditEvents       bool
+	recordEvents      bool
+	dryRun            bool
+	ocmTimeout        time.Duration
+	ocmCAFile         string
+	ocmTLSMinVersion  string
+	httpsProxy        string
+	noProxy           string
+	recordRetention   time.Duration
+	recordGCInterval  time.Duration
+	recordShards      int
+	leaderElect       bool
+	alertConcurrency  int
+	requestTimeout    time.Duration
+	leaderNamespace   string
+	severityMapping   map[string]string
+	refAnnotations    []string
+	refAllowedHosts   []string
+	suppressionConfig string
+	preferences       string
 	debug             bool
+	enablePprof       bool
 	fleetMode         bool
-	logger            logrus.Logger
+	logger            *logrus.Logger
 }
 
 var (
@@ -80,7 +114,7 @@ func NewServeOptions() *serveOptions {
 // NewServeCmd initializes serve command and it's flags
 func NewServeCmd() *cobra.Command {
 	o := NewServeOptions()
-	o.logger = *logging.NewLogger()
+	o.logger = logging.Subsystem(logging.SubsystemServe)
 
 	var cmd = &cobra.Command{
 		Use:     "serve",
@@ -115,8 +149,34 @@ func NewServeCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&o.externalClusterID, config.ExternalClusterID, "c", "", "Cluster ID (string)")
 	cmd.Flags().StringVarP(&o.ocmClientID, config.OCMClientID, "", "", "OCM Client ID for testing fleet mode (string)")
 	cmd.Flags().StringVarP(&o.ocmClientSecret, config.OCMClientSecret, "", "", "OCM Client Secret for testing fleet mode (string)")
+	cmd.Flags().StringVarP(&o.adminToken, config.AdminToken, "", "", "Bearer token required by the admin endpoints on the metrics port, admin endpoints are disabled if empty (string)")
 	cmd.Flags().StringSliceVarP(&o.services, config.Services, "", []string{}, "OCM service name (string)")
 	cmd.Flags().BoolVar(&o.fleetMode, config.FleetMode, false, "Fleet Mode (bool)")
+	cmd.Flags().BoolVar(&o.enablePprof, config.EnablePprof, false, "Serve the pprof endpoints on the metrics port, requires --admin-token (bool)")
+	cmd.Flags().StringVar(&o.auditFile, config.AuditFile, "", "Path of the local audit trail of service logs, disabled if empty (string)")
+	cmd.Flags().IntVar(&o.auditFileMaxSize, config.AuditFileMaxSize, consts.DefaultAuditFileMaxSize, "Size in megabytes at which the audit file is rotated (int)")
+	cmd.Flags().IntVar(&o.auditMaxBackups, config.AuditFileMaxBackups, consts.DefaultAuditFileMaxBackups, "Number of rotated audit files to keep (int)")
+	cmd.Flags().BoolVar(&o.auditEvents, config.AuditEvents, false, "Record audit entries as Kubernetes Events on the notification template (bool)")
+	cmd.Flags().BoolVar(&o.recordEvents, config.RecordEvents, false, "Record the outcome of each alert as a Kubernetes Event on its notification template (bool)")
+	cmd.Flags().DurationVar(&o.ocmTimeout, config.OCMRequestTimeout, consts.DefaultOCMRequestTimeout, "Timeout of a single request to OCM, including reading the response (duration)")
+	cmd.Flags().StringVar(&o.ocmCAFile, config.OCMCAFile, "", "PEM file of CA certificates trusted for OCM in addition to the system ones, reloaded when it changes (string)")
+	cmd.Flags().StringVar(&o.ocmTLSMinVersion, config.OCMTLSMinVersion, consts.DefaultOCMTLSMinVersion, "Minimum TLS version accepted from OCM, 1.2 or 1.3 (string)")
+	cmd.Flags().StringVar(&o.httpsProxy, config.HTTPSProxy, "", "URL of the proxy OCM is reached through, credentials can be included, the HTTPS_PROXY environment variable is used if empty (string)")
+	cmd.Flags().StringVar(&o.noProxy, config.NoProxy, "", "Comma separated list of hosts reached without the proxy set by --https-proxy (string)")
+	cmd.Flags().DurationVar(&o.recordRetention, config.FleetRecordRetention, consts.DefaultFleetRecordRetention, "How long the fleet notification record of a hosted cluster is kept once no notification is sent for it, 0 keeps them until the cluster is deleted (duration)")
+	cmd.Flags().DurationVar(&o.recordGCInterval, config.FleetRecordGCInterval, consts.DefaultFleetRecordGCInterval, "How often the fleet notification records are pruned, 0 disables the pruning (duration)")
+	cmd.Flags().IntVar(&o.recordShards, config.FleetRecordShards, consts.DefaultFleetRecordShards, "Number of ManagedFleetNotificationRecords the records of a management cluster are spread over by hosted cluster, existing records are migrated before the first alert (int)")
+	cmd.Flags().IntVar(&o.alertConcurrency, config.AlertConcurrency, consts.DefaultAlertConcurrency, "Number of alerts of a webhook request processed concurrently, the alerts of the same notification record are processed one after the other (int)")
+	cmd.Flags().DurationVar(&o.requestTimeout, config.WebhookRequestTimeout, consts.DefaultWebhookRequestTimeout, "How long the alerts of a webhook request are processed, the alerts not processed by then are retried by Alertmanager, 0 disables the timeout (duration)")
+	cmd.Flags().BoolVar(&o.leaderElect, config.LeaderElect, false, "Elect a leader among the replicas with a Lease, only the leader is ready and processes alerts (bool)")
+	cmd.Flags().StringVar(&o.leaderNamespace, config.LeaderElectionNamespace, consts.DefaultLeaderElectionNamespace, "Namespace of the Lease the replicas elect their leader with (string)")
+	cmd.Flags().StringToStringVar(&o.severityMapping, config.SeverityMapping, map[string]string{}, "Comma separated list of alert severity=service log severity pairs, e.g. warning=Warning,critical=Error, the severity of the notification is used for the alerts not listed (string)")
+	cmd.Flags().StringSliceVar(&o.refAnnotations, config.ReferenceAnnotations, []string{}, "Comma separated list of the alert annotations whose links are referenced by their service logs, generatorURL being the generator URL of the alert (string)")
+	cmd.Flags().StringSliceVar(&o.refAllowedHosts, config.ReferenceAllowedHosts, []string{}, "Comma separated list of the hosts the links of the alerts can point to, e.g. docs.openshift.com,*.redhat.com, no link is referenced if empty (string)")
+	cmd.Flags().BoolVar(&o.dryRun, config.DryRun, false, "Log the service logs and limited support changes instead of posting them to OCM (bool)")
+	cmd.Flags().StringVar(&o.sinksConfig, config.SinksConfig, "", "Path of the file configuring the sinks notifications can be delivered to besides service logs (string)")
+	cmd.Flags().StringVar(&o.suppressionConfig, config.SuppressionConfig, "", "Path of the file configuring the rules and maintenance windows suppressing the notifications of alerts, reloaded when it changes (string)")
+	cmd.Flags().StringVar(&o.preferences, config.NotificationPreferences, "", "Name of the ConfigMap of the namespace of OCM Agent holding the notifications the clusters opted out of, disabled if empty (string)")
 	cmd.PersistentFlags().BoolVarP(&o.debug, config.Debug, "d", false, "Debug mode enable")
 	kcmdutil.CheckErr(viper.BindPFlags(cmd.Flags()))
 
@@ -143,7 +203,7 @@ func NewServeCmd() *cobra.Command {
 func (o *serveOptions) Complete(cmd *cobra.Command, args []string) error {
 
 	// ReadFlagsFromFile would read the values of flags from files (if any)
-	err := ReadFlagsFromFile(cmd, config.AccessToken, config.OcmURL, config.Services, config.ExternalClusterID)
+	err := ReadFlagsFromFile(cmd, config.AccessToken, config.OcmURL, config.Services, config.ExternalClusterID, config.AdminToken, config.HTTPSProxy)
 	// Cobra keeps the filename argument as the first element of the services slice
 	// Example services slice from file: [@services_file service_logs]
 	// Remove that element if it starts with an '@' symbol.
@@ -155,7 +215,55 @@ func (o *serveOptions) Complete(cmd *cobra.Command, args []string) error {
 
 	// Check if debug mode is enabled and set the logging level accordingly
 	if o.debug {
-		o.logger.Level = logging.DebugLogLevel
+		logging.SetBaseLevel(logging.DebugLogLevel)
+	}
+
+	for _, service := range o.services {
+		switch service {
+		case config.ServiceLogService:
+		case config.LimitedSupportService:
+			// Fleet mode alerts are never resolved, the limited support could not be removed
+			if o.fleetMode {
+				return fmt.Errorf("service %s is not supported in fleet mode", config.LimitedSupportService)
+			}
+		default:
+			o.logger.WithField("Service", service).Warning("Ignoring unknown service")
+		}
+	}
+
+	if o.recordShards < 1 {
+		return fmt.Errorf("--%s must be at least 1", config.FleetRecordShards)
+	}
+	if o.alertConcurrency < 1 {
+		return fmt.Errorf("--%s must be at least 1", config.AlertConcurrency)
+	}
+	if o.requestTimeout < 0 {
+		return fmt.Errorf("--%s can't be negative", config.WebhookRequestTimeout)
+	}
+	if o.recordRetention < 0 || o.recordGCInterval < 0 {
+		return fmt.Errorf("--%s and --%s can't be negative", config.FleetRecordRetention, config.FleetRecordGCInterval)
+	}
+
+	for label, severity := range o.severityMapping {
+		if label == "" || severity == "" {
+			return fmt.Errorf("invalid --%s: empty severity in %q", config.SeverityMapping, label+"="+severity)
+		}
+		if !handlers.IsValidSeverity(severity) {
+			return fmt.Errorf("invalid --%s: unknown service log severity %q, expected Debug, Info, Warning, Error or Fatal", config.SeverityMapping, severity)
+		}
+	}
+
+	if len(o.refAnnotations) > 0 && len(o.refAllowedHosts) == 0 {
+		o.logger.Warningf("No link of the alerts is referenced as --%s is empty", config.ReferenceAllowedHosts)
+	}
+
+	if _, err := ocm.ParseTLSVersion(o.ocmTLSMinVersion); err != nil {
+		return fmt.Errorf("invalid --%s: %w", config.OCMTLSMinVersion, err)
+	}
+
+	// pprof exposes the process internals, never serve it without authentication
+	if o.enablePprof && o.adminToken == "" {
+		return fmt.Errorf("--%s requires --%s to be set", config.EnablePprof, config.AdminToken)
 	}
 
 	return nil
@@ -166,7 +274,8 @@ func (o *serveOptions) Run() error {
 	var ocmAgentClientSecret string
 	var ocmAgentURL string
 
-	o.logger.Info("Starting ocm-agent server")
+	buildInfo := diagnostics.GetBuildInfo()
+	o.logger.WithFields(logrus.Fields{"Revision": buildInfo.Revision, "FIPS": buildInfo.FIPSEnabled}).Info("Starting ocm-agent server")
 	o.logger.WithField("URL", o.ocmURL).Debug("OCM URL configured")
 	o.logger.WithField("Service", o.services).Debug("OCM Service configured")
 
@@ -179,6 +288,19 @@ func (o *serveOptions) Run() error {
 	// create new router for metrics
 	rMetrics := mux.NewRouter()
 	rMetrics.Path(consts.MetricsPath).Handler(promhttp.Handler())
+	if o.adminToken != "" {
+		o.logger.Info("Admin endpoints enabled on metrics port")
+		rMetrics.Path(consts.LogLevelPath).Handler(handlers.RequireAdminToken(o.adminToken, handlers.NewLogLevelHandler()))
+		rMetrics.Path(consts.DebugStatePath).Handler(handlers.RequireAdminToken(o.adminToken, handlers.NewDebugStateHandler()))
+	}
+	if o.enablePprof {
+		o.logger.WithField("Path", consts.PprofPathPrefix).Info("pprof endpoints enabled on metrics port")
+		rMetrics.Path(consts.PprofPathPrefix + "cmdline").Handler(handlers.RequireAdminToken(o.adminToken, http.HandlerFunc(pprof.Cmdline)))
+		rMetrics.Path(consts.PprofPathPrefix + "profile").Handler(handlers.RequireAdminToken(o.adminToken, http.HandlerFunc(pprof.Profile)))
+		rMetrics.Path(consts.PprofPathPrefix + "symbol").Handler(handlers.RequireAdminToken(o.adminToken, http.HandlerFunc(pprof.Symbol)))
+		rMetrics.Path(consts.PprofPathPrefix + "trace").Handler(handlers.RequireAdminToken(o.adminToken, http.HandlerFunc(pprof.Trace)))
+		rMetrics.PathPrefix(consts.PprofPathPrefix).Handler(handlers.RequireAdminToken(o.adminToken, http.HandlerFunc(pprof.Index)))
+	}
 
 	// Listen on the metrics port with a separated goroutine
 	o.logger.WithField("Port", consts.OCMAgentMetricsPort).Info("Start listening on metrics port")
@@ -204,10 +326,42 @@ func (o *serveOptions) Run() error {
 		return err
 	}
 
+	// The audit trail and the alert outcomes share the recorder, and so its rate limiting
+	var eventRecorder, recorder record.EventRecorder
+	if o.auditEvents || o.recordEvents {
+		eventRecorder, err = k8s.NewEventRecorder()
+		if err != nil {
+			o.logger.WithError(err).Fatal("Can't initialise k8s event recorder")
+			return err
+		}
+	}
+	if o.recordEvents {
+		o.logger.Info("Recording alert outcomes as Kubernetes Events")
+		recorder = eventRecorder
+	}
+
+	err = o.initAudit(eventRecorder)
+	if err != nil {
+		o.logger.WithError(err).Fatal("Can't initialise audit trail")
+		return err
+	}
+
+	sinks, err := o.initSinks()
+	if err != nil {
+		o.logger.WithError(err).Fatal("Can't initialise sinks")
+		return err
+	}
+
+	suppressor, err := o.initSuppression()
+	if err != nil {
+		o.logger.WithError(err).Fatal("Can't initialise suppression rules")
+		return err
+	}
+
 	// Depending on whether the FleetMode is enabled or not, we need to initiate the OCM SDK connection accordingly
 	// If fleet mode is not enabled, we will fetch the cluster ID and access token to initiate connection with OCM
 	if !o.fleetMode {
-		sdkclient, err = ocm.NewConnection().Build(viper.GetString(config.OcmURL),
+		sdkclient, err = o.connectionBuilder().Build(viper.GetString(config.OcmURL),
 			viper.GetString(config.ExternalClusterID),
 			viper.GetString(config.AccessToken))
 		if err != nil {
@@ -246,7 +400,7 @@ func (o *serveOptions) Run() error {
 			}
 		}
 
-		sdkclient, err = sdk.NewConnectionBuilder().URL(ocmAgentURL).Client(ocmAgentClientID, ocmAgentClientSecret).Insecure(false).Build()
+		sdkclient, err = o.connectionBuilder().BuildWithClient(ocmAgentURL, ocmAgentClientID, ocmAgentClientSecret)
 		if err != nil {
 			o.logger.WithError(err).Fatal("Can't initialise OCM sdk.connection client in fleet mode")
 			return err
@@ -254,30 +408,128 @@ func (o *serveOptions) Run() error {
 		o.logger.Info("Connection with OCM initialised successfully in fleet mode")
 	}
 
-	// Initialize OCMClient
-	ocmclient := handlers.NewOcmClient(sdkclient)
+	o.registerDiagnostics(sdkclient)
+
+	// Initialize the OCM clients of the enabled services, sharing the cache of cluster IDs
+	resolver := ocm.NewClusterIDResolver(sdkclient, consts.ClusterIDCacheTTL, consts.ClusterIDNegativeCacheTTL)
+	diagnostics.Register(diagnostics.SectionCaches, "cluster_ids", resolver.State)
+	var ocmclient handlers.OCMClient
+	var limitedSupportClient handlers.LimitedSupportClient
+	for _, service := range o.services {
+		switch service {
+		case config.ServiceLogService:
+			ocmclient = handlers.NewOcmClient(sdkclient, resolver, o.dryRun)
+		case config.LimitedSupportService:
+			o.logger.Info("Limited support service enabled")
+			limitedSupportClient = handlers.NewLimitedSupportClient(sdkclient, resolver, o.dryRun)
+		}
+	}
+	if o.dryRun {
+		o.logger.Warning("Dry run mode enabled, nothing is posted to OCM")
+	}
 
 	// create a new router
 	r := mux.NewRouter()
 
+	// Only the leader processes alerts and runs the background tasks when leader election is enabled
+	var leader handlers.LeaderChecker
+	var elector *k8s.LeaderElector
+	var leaderTasks []func(ctx context.Context)
+	if o.leaderElect {
+		identity, err := os.Hostname()
+		if err != nil {
+			o.logger.WithError(err).Fatal("Can't determine the leader election identity")
+			return err
+		}
+		elector, err = k8s.NewLeaderElector(o.leaderNamespace, consts.LeaderElectionLeaseName, identity, func(ctx context.Context) {
+			for _, task := range leaderTasks {
+				go task(ctx)
+			}
+		})
+		if err != nil {
+			o.logger.WithError(err).Fatal("Can't initialise leader election")
+			return err
+		}
+		leader = elector
+	}
+
 	livezHandler := handlers.NewLivezHandler()
 	readyzHandler := handlers.NewReadyzHandler()
+	if leader != nil {
+		readyzHandler.WithLeaderElection(leader)
+	}
 	r.Path(consts.LivezPath).Handler(livezHandler)
 	r.Path(consts.ReadyzPath).Handler(readyzHandler)
 
-	for _, service := range o.services {
-		switch service {
-		case config.ServiceLogService:
-			if o.fleetMode {
-				o.logger.Info("Initialising alertmanager webhook handler in fleet mode")
-				webhookReceiverHandler := handlers.NewWebhookRHOBSReceiverHandler(client, ocmclient)
-				r.Path(consts.WebhookReceiverPath).Handler(webhookReceiverHandler)
-			} else {
-				o.logger.Info("Initialising alertmanager webhook handler in NON-fleet mode")
-				webhookReceiverHandler := handlers.NewWebhookReceiverHandler(client, ocmclient)
-				r.Path(consts.WebhookReceiverPath).Handler(webhookReceiverHandler)
+	if o.fleetMode {
+		o.logger.Info("Initialising alertmanager webhook handler in fleet mode")
+		// Hosted clusters are verified with the cache lifetimes of the cluster IDs
+		validator := ocm.NewHostedClusterValidator(sdkclient, consts.ClusterIDCacheTTL, consts.ClusterIDNegativeCacheTTL)
+		diagnostics.Register(diagnostics.SectionCaches, "hosted_clusters", validator.State)
+		webhookReceiverHandler := handlers.NewWebhookRHOBSReceiverHandler(client, ocmclient).WithEventRecorder(recorder).WithSinks(sinks).WithHostedClusterValidator(validator).WithRecordShards(o.recordShards).WithIdempotentServiceLogs().
+			WithAlertConcurrency(o.alertConcurrency).WithRequestTimeout(o.requestTimeout).WithSeverityMapping(o.severityMapping).
+			WithAlertReferences(o.refAnnotations, o.refAllowedHosts).WithNotificationPreferences(o.preferences)
+		if leader != nil {
+			webhookReceiverHandler.WithLeaderElection(leader)
+		}
+		if suppressor != nil {
+			webhookReceiverHandler.WithSuppression(suppressor)
+			leaderTasks = append(leaderTasks, func(ctx context.Context) {
+				suppressor.Run(ctx, consts.SuppressionEvaluationInterval, webhookReceiverHandler.ProcessReleasedAlerts)
+			})
+		}
+		r.Path(consts.WebhookReceiverPath).Handler(webhookReceiverHandler)
+		// Resolve the service logs a previous process was posting when it stopped. This runs alongside the alerts, an
+		// alert finding an intent which is not resolved yet looks its service log up in OCM itself
+		leaderTasks = append(leaderTasks, func(ctx context.Context) {
+			err := webhookReceiverHandler.ReconcileServiceLogIntents(ctx)
+			if err != nil {
+				o.logger.WithError(err).Error("Can't resolve the pending service logs of the fleet notification records")
 			}
-			r.Use(metrics.PrometheusMiddleware)
+		})
+		if o.recordGCInterval > 0 {
+			collector := handlers.NewFleetRecordCollector(client, validator, o.recordRetention)
+			leaderTasks = append(leaderTasks, func(ctx context.Context) {
+				collector.Start(ctx, o.recordGCInterval)
+			})
+		}
+	} else {
+		o.logger.Info("Initialising alertmanager webhook handler in NON-fleet mode")
+		webhookReceiverHandler := handlers.NewWebhookReceiverHandler(client, ocmclient).WithEventRecorder(recorder).WithSinks(sinks).WithLimitedSupport(limitedSupportClient).WithIdempotentServiceLogs().
+			WithAlertConcurrency(o.alertConcurrency).WithRequestTimeout(o.requestTimeout).WithSeverityMapping(o.severityMapping).
+			WithAlertReferences(o.refAnnotations, o.refAllowedHosts).WithNotificationPreferences(o.preferences)
+		if leader != nil {
+			webhookReceiverHandler.WithLeaderElection(leader)
+		}
+		if suppressor != nil {
+			webhookReceiverHandler.WithSuppression(suppressor)
+			leaderTasks = append(leaderTasks, func(ctx context.Context) {
+				suppressor.Run(ctx, consts.SuppressionEvaluationInterval, webhookReceiverHandler.ProcessReleasedAlerts)
+			})
+		}
+		r.Path(consts.WebhookReceiverPath).Handler(webhookReceiverHandler)
+		// Resolve the service logs a previous process was posting when it stopped. This runs alongside the alerts, an
+		// alert finding an intent which is not resolved yet looks its service log up in OCM itself
+		leaderTasks = append(leaderTasks, func(ctx context.Context) {
+			err := webhookReceiverHandler.ReconcileServiceLogIntents(ctx)
+			if err != nil {
+				o.logger.WithError(err).Error("Can't resolve the pending service logs of the managed notifications")
+			}
+		})
+	}
+	r.Use(metrics.PrometheusMiddleware)
+
+	if elector != nil {
+		o.logger.WithField("Namespace", o.leaderNamespace).Info("Starting leader election")
+		go func() {
+			err := elector.Run(context.Background())
+			if err != nil {
+				o.logger.WithError(err).Fatal("Leader election failed")
+			}
+		}()
+	} else {
+		for _, task := range leaderTasks {
+			go task(context.Background())
 		}
 	}
 
@@ -300,6 +552,102 @@ func (o *serveOptions) Run() error {
 	return nil
 }
 
+// networkConfig returns the proxy and TLS configuration of the OCM connection, the TLS version is validated by Complete
+func (o *serveOptions) networkConfig() ocm.NetworkConfig {
+	minVersion, _ := ocm.ParseTLSVersion(o.ocmTLSMinVersion)
+	return ocm.NetworkConfig{
+		HTTPSProxy:    o.httpsProxy,
+		NoProxy:       o.noProxy,
+		CAFile:        o.ocmCAFile,
+		MinTLSVersion: minVersion,
+	}
+}
+
+// connectionBuilder returns the OCM connection builder shared by the traditional and fleet modes
+func (o *serveOptions) connectionBuilder() *ocm.ConnectionBuilder {
+	return ocm.NewConnection().
+		Logger(ocm.NewLogger()).
+		TransportWrapper(ocm.NewTransportWrapper(o.ocmTimeout)).
+		Network(o.networkConfig())
+}
+
+// initAudit configures the backends recording every service log posted, the records are also recorded as events
+// when audit events are enabled or the outcome of each alert is recorded
+func (o *serveOptions) initAudit(recorder record.EventRecorder) error {
+	var backends []audit.Backend
+	if o.auditFile != "" {
+		fileBackend, err := audit.NewFileBackend(o.auditFile, int64(o.auditFileMaxSize)*1024*1024, o.auditMaxBackups)
+		if err != nil {
+			return err
+		}
+		o.logger.WithField("File", o.auditFile).Info("Recording audit trail to file")
+		backends = append(backends, fileBackend)
+	}
+	if recorder != nil {
+		o.logger.Info("Recording audit trail as Kubernetes Events")
+		backends = append(backends, audit.NewEventBackend(recorder))
+	}
+	audit.SetBackends(backends...)
+	return nil
+}
+
+// initSinks builds the sinks notifications can select besides service logs, none are available
+// when no configuration file is given
+func (o *serveOptions) initSinks() (*sink.Registry, error) {
+	if o.sinksConfig == "" {
+		return sink.NewRegistry(), nil
+	}
+	c, err := sink.LoadConfig(o.sinksConfig)
+	if err != nil {
+		return nil, err
+	}
+	sinks, err := sink.NewRegistryFromConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	o.logger.WithField("Sinks", sinks.Names()).Info("Sinks configured")
+	diagnostics.Register(diagnostics.SectionConfig, "sinks", func() interface{} {
+		return sinks.Names()
+	})
+	return sinks, nil
+}
+
+// initSuppression loads the rules suppressing the notifications of alerts, no notification is suppressed when no
+// configuration file is given
+func (o *serveOptions) initSuppression() (*suppression.Suppressor, error) {
+	if o.suppressionConfig == "" {
+		return nil, nil
+	}
+	suppressor, err := suppression.NewSuppressor(o.suppressionConfig, consts.SuppressedAlertRetention)
+	if err != nil {
+		return nil, err
+	}
+	o.logger.WithField("File", o.suppressionConfig).Info("Suppression rules configured")
+	diagnostics.Register(diagnostics.SectionCaches, "suppressed_alerts", func() interface{} {
+		return suppressor.Pending()
+	})
+	return suppressor, nil
+}
+
+// registerDiagnostics exposes the configuration and OCM connection in effect on the debug state endpoint
+func (o *serveOptions) registerDiagnostics(conn *sdk.Connection) {
+	diagnostics.Register(diagnostics.SectionConfig, "flags", func() interface{} {
+		return diagnostics.RedactSettings(viper.AllSettings(), config.AccessToken, config.OCMClientSecret, config.AdminToken, config.HTTPSProxy)
+	})
+	diagnostics.Register(diagnostics.SectionOCM, "connection", func() interface{} {
+		clientID, _ := conn.Client()
+		return map[string]interface{}{
+			"URL":        conn.URL(),
+			"TokenURL":   conn.TokenURL(),
+			"ClientID":   clientID,
+			"Agent":      conn.Agent(),
+			"Insecure":   conn.Insecure(),
+			"RetryLimit": conn.RetryLimit(),
+			"FleetMode":  o.fleetMode,
+		}
+	})
+}
+
 func deleteFirstElementIfFileName(slice []string) []string {
 	if strings.HasPrefix(slice[0], "@") {
 		slice = slice[1:]
@@ -17,6 +17,59 @@ const (
 	OCMClientID string = "ocm-client-id"
 	// OCMClientSecret represents the OCM Client ID that will be used for testing fleet-mode run
 	OCMClientSecret string = "ocm-client-secret" //#nosec G101 -- This is a false positive
+	// AdminToken represents the bearer token required by the admin endpoints on the metrics port
+	AdminToken string = "admin-token" //#nosec G101 -- This is a false positive
+	// EnablePprof represents whether the pprof endpoints are served on the metrics port
+	EnablePprof string = "enable-pprof"
+	// AuditFile represents the path of the local audit trail of service logs, the file backend is disabled if empty
+	AuditFile string = "audit-file"
+	// AuditFileMaxSize represents the size in megabytes at which the audit file is rotated
+	AuditFileMaxSize string = "audit-file-max-size"
+	// AuditFileMaxBackups represents the number of rotated audit files that are kept
+	AuditFileMaxBackups string = "audit-file-max-backups"
+	// AuditEvents represents whether audit entries are recorded as Kubernetes Events on the notification template
+	AuditEvents string = "audit-events"
+	// RecordEvents represents whether the outcome of each alert is recorded as a Kubernetes Event on the notification template
+	RecordEvents string = "record-events"
+	// DryRun represents whether notifications are only logged instead of being posted to OCM
+	DryRun string = "dry-run"
+	// OCMRequestTimeout represents the timeout of a single request to OCM
+	OCMRequestTimeout string = "ocm-request-timeout"
+	// OCMCAFile represents the PEM file of CA certificates trusted for OCM in addition to the system ones
+	OCMCAFile string = "ocm-ca-file"
+	// OCMTLSMinVersion represents the minimum TLS version accepted from OCM
+	OCMTLSMinVersion string = "ocm-tls-min-version"
+	// HTTPSProxy represents the URL of the proxy OCM is reached through, it may include the proxy credentials
+	HTTPSProxy string = "https-proxy"
+	// NoProxy represents the hosts reached without going through HTTPSProxy
+	NoProxy string = "no-proxy"
+	// SinksConfig represents the path of the file configuring the sinks notifications can be delivered to
+	SinksConfig string = "sinks-config"
+	// FleetRecordRetention represents how long the fleet notification record of a hosted cluster is kept without notification
+	FleetRecordRetention string = "fleet-record-retention"
+	// FleetRecordGCInterval represents how often the fleet notification records are pruned
+	FleetRecordGCInterval string = "fleet-record-gc-interval"
+	// FleetRecordShards represents the number of ManagedFleetNotificationRecords the records of a management cluster are spread over
+	FleetRecordShards string = "fleet-record-shards"
+	// AlertConcurrency represents the number of alerts of a webhook request processed concurrently
+	AlertConcurrency string = "alert-concurrency"
+	// WebhookRequestTimeout represents how long the alerts of a webhook request are processed
+	WebhookRequestTimeout string = "webhook-request-timeout"
+	// LeaderElect represents whether the replicas elect a leader, the only one processing alerts
+	LeaderElect string = "leader-elect"
+	// LeaderElectionNamespace represents the namespace of the Lease the replicas elect their leader with
+	LeaderElectionNamespace string = "leader-election-namespace"
+	// SeverityMapping represents the mapping of the severity label of the alerts to the severity of their service logs
+	SeverityMapping string = "severity-mapping"
+	// ReferenceAnnotations represents the annotations of the alerts whose links are referenced by their service logs
+	ReferenceAnnotations string = "reference-annotations"
+	// ReferenceAllowedHosts represents the hosts the links of the alerts can point to to be referenced by their service logs
+	ReferenceAllowedHosts string = "reference-allowed-hosts"
+	// SuppressionConfig represents the path of the file configuring the rules suppressing the notifications of alerts
+	SuppressionConfig string = "suppression-config"
+	// NotificationPreferences represents the name of the ConfigMap holding the notification preferences of the clusters
+	NotificationPreferences string = "notification-preferences"
 
-	ServiceLogService string = "service_logs"
+	ServiceLogService     string = "service_logs"
+	LimitedSupportService string = "limited_support"
 )
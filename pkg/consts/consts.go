@@ -1,5 +1,7 @@
 package consts
 
+import "time"
+
 const (
 	// Listening port for the OCM Agent web service
 	OCMAgentServicePort = 8081
@@ -14,6 +16,79 @@ const (
 	LivezPath = "/livez"
 	// Alertmanger webhook receiver path
 	WebhookReceiverPath = "/alertmanager-receiver"
+	// Runtime log level path served on the metrics port
+	LogLevelPath = "/debug/loglevel"
+	// Runtime state dump path served on the metrics port
+	DebugStatePath = "/debug/state"
+	// Prefix of the pprof endpoints served on the metrics port
+	PprofPathPrefix = "/debug/pprof/"
+
+	// DefaultLogLevelTTL is how long a runtime log level change lasts when no TTL is given
+	DefaultLogLevelTTL = 15 * time.Minute
+	// MaxLogLevelTTL is the longest a runtime log level change may last
+	MaxLogLevelTTL = 24 * time.Hour
+
+	// DefaultAuditFileMaxSize is the size in megabytes at which the audit file is rotated
+	DefaultAuditFileMaxSize = 10
+	// DefaultAuditFileMaxBackups is the number of rotated audit files kept
+	DefaultAuditFileMaxBackups = 5
+
+	// EventBurstSize is the number of events that can be recorded at once for a single object
+	EventBurstSize = 10
+	// EventQPS is the rate at which events are allowed for a single object once the burst is spent
+	EventQPS = 1.0 / 60
+	// EventAggregationMaxEvents is the number of similar events after which they are aggregated into one
+	EventAggregationMaxEvents = 5
+	// EventAggregationIntervalSeconds is the window in which similar events are aggregated
+	EventAggregationIntervalSeconds = 600
+
+	// DefaultOCMRequestTimeout is the timeout of a single request to OCM
+	DefaultOCMRequestTimeout = 30 * time.Second
+	// DefaultOCMTLSMinVersion is the minimum TLS version accepted from OCM
+	DefaultOCMTLSMinVersion = "1.2"
+
+	// ClusterIDCacheTTL is how long the OCM identity of a cluster is cached
+	ClusterIDCacheTTL = time.Hour
+	// ClusterIDNegativeCacheTTL is how long a cluster which is not found in OCM is remembered as such
+	ClusterIDNegativeCacheTTL = 5 * time.Minute
+
+	// DefaultFleetRecordRetention is how long the fleet notification record of a hosted cluster is kept without notification
+	DefaultFleetRecordRetention = 30 * 24 * time.Hour
+	// DefaultFleetRecordGCInterval is how often the fleet notification records are pruned
+	DefaultFleetRecordGCInterval = time.Hour
+	// DefaultFleetRecordShards keeps the records of a management cluster in a single ManagedFleetNotificationRecord
+	DefaultFleetRecordShards = 1
+	// KubernetesRequestTimeout bounds every request to the Kubernetes API
+	KubernetesRequestTimeout = 10 * time.Second
+	// RecordUpdateTimeout bounds the recording of a sent notification, including the retries of conflicting updates
+	RecordUpdateTimeout = 30 * time.Second
+	// DefaultAlertConcurrency is the number of alerts of a webhook request processed concurrently
+	DefaultAlertConcurrency = 4
+	// DefaultWebhookRequestTimeout bounds how long the alerts of a webhook request are processed
+	DefaultWebhookRequestTimeout = 30 * time.Second
+	// DefaultLeaderElectionNamespace is the namespace of the Lease the replicas of OCM Agent elect their leader with
+	DefaultLeaderElectionNamespace = "openshift-ocm-agent-operator"
+	// LeaderElectionLeaseName is the name of the Lease the replicas of OCM Agent elect their leader with
+	LeaderElectionLeaseName = "ocm-agent-leader"
+	// LeaderElectionLeaseDuration is how long the other replicas wait before taking over the leadership of a leader
+	// which stopped renewing it
+	LeaderElectionLeaseDuration = 15 * time.Second
+	// LeaderElectionRenewDeadline is how long the leader tries to renew its leadership before giving it up
+	LeaderElectionRenewDeadline = 10 * time.Second
+	// LeaderElectionRetryPeriod is how often the replicas try to acquire or renew the leadership
+	LeaderElectionRetryPeriod = 2 * time.Second
+	// NotLeaderRetryAfter is the delay after which Alertmanager is told to retry the alerts rejected by a replica
+	// which is not the leader
+	NotLeaderRetryAfter = 5 * time.Second
+	// SuppressionEvaluationInterval is how often the suppressed alerts are checked to notify the ones no longer suppressed
+	SuppressionEvaluationInterval = time.Minute
+	// SuppressedAlertRetention is how long a suppressed alert which is not received again is kept to be notified
+	SuppressedAlertRetention = 24 * time.Hour
+	// NotificationPreferencesCacheTTL is how long the ConfigMap of the notification preferences is cached
+	NotificationPreferencesCacheTTL = time.Minute
+	// OptOutAuditInterval is how often the opt-out of a cluster from a notification is recorded to the audit trail
+	// while its alert keeps firing
+	OptOutAuditInterval = time.Hour
 
 	// OCMAgentAccessFleetSecretPathBase is the base path where to find the secret
 	OCMAgentAccessFleetSecretPathBase = "/secrets/"
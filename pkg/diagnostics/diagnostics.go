@@ -0,0 +1,111 @@
+package diagnostics
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+const (
+	// SectionConfig holds the configuration in effect
+	SectionConfig = "config"
+	// SectionOCM holds information about the OCM connections
+	SectionOCM = "ocm"
+	// SectionCaches holds the content and sync status of in-process caches
+	SectionCaches = "caches"
+	// SectionQueues holds the content of in-process work queues
+	SectionQueues = "queues"
+
+	// Redacted replaces the value of secrets in the dumped state
+	Redacted = "REDACTED"
+)
+
+// StateFunc returns a JSON serialisable snapshot of the state of a component
+type StateFunc func() interface{}
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	GoVersion   string
+	Version     string
+	Revision    string
+	BuildTime   string
+	Modified    bool
+	FIPSEnabled bool
+	Settings    map[string]string
+}
+
+var (
+	mutex     sync.Mutex
+	providers = map[string]map[string]StateFunc{}
+)
+
+// Register adds a state provider under the given section. Registering the same name twice
+// replaces the previous provider.
+func Register(section, name string, f StateFunc) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := providers[section]; !ok {
+		providers[section] = map[string]StateFunc{}
+	}
+	providers[section][name] = f
+}
+
+// Snapshot calls every registered provider and returns their state grouped by section
+func Snapshot() map[string]map[string]interface{} {
+	mutex.Lock()
+	defer mutex.Unlock()
+	snapshot := map[string]map[string]interface{}{}
+	for _, section := range []string{SectionConfig, SectionOCM, SectionCaches, SectionQueues} {
+		snapshot[section] = map[string]interface{}{}
+	}
+	for section, funcs := range providers {
+		if _, ok := snapshot[section]; !ok {
+			snapshot[section] = map[string]interface{}{}
+		}
+		for name, f := range funcs {
+			snapshot[section][name] = f()
+		}
+	}
+	return snapshot
+}
+
+// GetBuildInfo returns the build information embedded in the binary
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		GoVersion:   runtime.Version(),
+		FIPSEnabled: fipsEnabled,
+		Settings:    map[string]string{},
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Version = bi.Main.Version
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.BuildTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		case "-tags", "GOEXPERIMENT", "CGO_ENABLED", "GOOS", "GOARCH":
+			info.Settings[s.Key] = s.Value
+		}
+	}
+	return info
+}
+
+// RedactSettings returns a copy of the settings with the value of every secret key replaced
+func RedactSettings(settings map[string]interface{}, secrets ...string) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(settings))
+	for k, v := range settings {
+		redacted[k] = v
+	}
+	for _, k := range secrets {
+		if v, ok := redacted[k]; ok && v != "" {
+			redacted[k] = Redacted
+		}
+	}
+	return redacted
+}
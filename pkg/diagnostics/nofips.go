@@ -0,0 +1,7 @@
+//go:build !fips_enabled
+// +build !fips_enabled
+
+package diagnostics
+
+// fipsEnabled reports whether the binary was built with FIPS crypto
+const fipsEnabled = false
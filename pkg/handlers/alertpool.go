@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// alertJob processes an alert of a webhook request. The jobs sharing a key touch the same notification record, they
+// are run one after the other in the order of the request.
+type alertJob struct {
+	key     string
+	process func(ctx context.Context) error
+}
+
+// alertPool bounds the number of alerts of a webhook request processed concurrently and how long they can take. Its
+// zero value processes the alerts one at a time without a deadline, as the handlers always did.
+type alertPool struct {
+	concurrency int
+	timeout     time.Duration
+}
+
+// WithAlertConcurrency makes the handler process up to the given number of alerts of a request concurrently, the
+// alerts of the same notification being processed one after the other
+func (h *WebhookReceiverHandler) WithAlertConcurrency(concurrency int) *WebhookReceiverHandler {
+	h.pool.concurrency = concurrency
+	return h
+}
+
+// WithRequestTimeout bounds how long the alerts of a request are processed, the alerts not started by then are left
+// for Alertmanager to send again
+func (h *WebhookReceiverHandler) WithRequestTimeout(timeout time.Duration) *WebhookReceiverHandler {
+	h.pool.timeout = timeout
+	return h
+}
+
+// WithAlertConcurrency makes the handler process up to the given number of alerts of a request concurrently, the
+// alerts of the same management cluster being processed one after the other
+func (h *WebhookRHOBSReceiverHandler) WithAlertConcurrency(concurrency int) *WebhookRHOBSReceiverHandler {
+	h.pool.concurrency = concurrency
+	return h
+}
+
+// WithRequestTimeout bounds how long the alerts of a request are processed, the alerts not started by then are left
+// for Alertmanager to send again
+func (h *WebhookRHOBSReceiverHandler) WithRequestTimeout(timeout time.Duration) *WebhookRHOBSReceiverHandler {
+	h.pool.timeout = timeout
+	return h
+}
+
+// run runs the jobs, up to the concurrency of the pool at a time, under a deadline derived from the context of the
+// request. No job is started once the deadline passed or a job failed. The error of the first failed job is returned,
+// or the error of the context when jobs were left unprocessed by the deadline.
+func (p alertPool) run(ctx context.Context, jobs []alertJob) error {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	// The failure of a job stops the others from being started, not the requests to OCM of those in flight
+	stop, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Group the jobs by key, in the order of their first job
+	var keys []string
+	groups := map[string][]alertJob{}
+	for _, job := range jobs {
+		if _, ok := groups[job.key]; !ok {
+			keys = append(keys, job.key)
+		}
+		groups[job.key] = append(groups[job.key], job)
+	}
+
+	concurrency := p.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg       sync.WaitGroup
+		mutex    sync.Mutex
+		firstErr error
+		skipped  int
+	)
+	// next returns whether another job can be started, counting the jobs which can't be as skipped
+	next := func() bool {
+		if ctx.Err() == nil && stop.Err() == nil {
+			return true
+		}
+		mutex.Lock()
+		skipped++
+		mutex.Unlock()
+		return false
+	}
+	slots := make(chan struct{}, concurrency)
+	for _, key := range keys {
+		group := groups[key]
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		case <-stop.Done():
+		}
+		if !next() {
+			mutex.Lock()
+			skipped += len(group) - 1
+			mutex.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			for _, job := range group {
+				if !next() {
+					continue
+				}
+				err := job.process(ctx)
+				if err != nil {
+					mutex.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mutex.Unlock()
+					cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if skipped > 0 {
+		return fmt.Errorf("%d alerts were not processed: %w", skipped, ctx.Err())
+	}
+	return nil
+}
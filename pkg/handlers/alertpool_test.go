@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Alert pool", func() {
+
+	Context("When processing the alerts of a request", func() {
+		It("Processes up to the concurrency of the pool at a time", func() {
+			var running, peak int32
+			var jobs []alertJob
+			for i := 0; i < 8; i++ {
+				jobs = append(jobs, alertJob{key: fmt.Sprintf("record-%d", i), process: func(ctx context.Context) error {
+					n := atomic.AddInt32(&running, 1)
+					for {
+						p := atomic.LoadInt32(&peak)
+						if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+							break
+						}
+					}
+					time.Sleep(20 * time.Millisecond)
+					atomic.AddInt32(&running, -1)
+					return nil
+				}})
+			}
+			Expect(alertPool{concurrency: 3}.run(context.Background(), jobs)).To(Succeed())
+			Expect(peak).To(BeNumerically(">", 1))
+			Expect(peak).To(BeNumerically("<=", 3))
+		})
+
+		It("Processes the alerts of the same record one after the other in order", func() {
+			var mutex sync.Mutex
+			var order []int
+			var jobs []alertJob
+			for i := 0; i < 6; i++ {
+				i := i
+				jobs = append(jobs, alertJob{key: fmt.Sprintf("record-%d", i%2), process: func(ctx context.Context) error {
+					time.Sleep(time.Duration(6-i) * time.Millisecond)
+					mutex.Lock()
+					defer mutex.Unlock()
+					order = append(order, i)
+					return nil
+				}})
+			}
+			Expect(alertPool{concurrency: 4}.run(context.Background(), jobs)).To(Succeed())
+			var even, odd []int
+			for _, i := range order {
+				if i%2 == 0 {
+					even = append(even, i)
+				} else {
+					odd = append(odd, i)
+				}
+			}
+			Expect(even).To(Equal([]int{0, 2, 4}))
+			Expect(odd).To(Equal([]int{1, 3, 5}))
+		})
+
+		It("Leaves the alerts not started by the deadline", func() {
+			var processed int32
+			var jobs []alertJob
+			for i := 0; i < 3; i++ {
+				jobs = append(jobs, alertJob{key: "record", process: func(ctx context.Context) error {
+					atomic.AddInt32(&processed, 1)
+					<-ctx.Done()
+					return nil
+				}})
+			}
+			err := alertPool{concurrency: 2, timeout: 20 * time.Millisecond}.run(context.Background(), jobs)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(err.Error()).To(ContainSubstring("2 alerts were not processed"))
+			Expect(processed).To(Equal(int32(1)))
+		})
+
+		It("Stops starting alerts once one failed", func() {
+			var processed int32
+			jobs := []alertJob{
+				{key: "record", process: func(ctx context.Context) error {
+					atomic.AddInt32(&processed, 1)
+					return fmt.Errorf("a fake error")
+				}},
+				{key: "record", process: func(ctx context.Context) error {
+					atomic.AddInt32(&processed, 1)
+					return nil
+				}},
+			}
+			Expect(alertPool{}.run(context.Background(), jobs)).To(MatchError("a fake error"))
+			Expect(processed).To(Equal(int32(1)))
+		})
+
+		It("Does not start alerts of a cancelled request", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			jobs := []alertJob{{key: "record", process: func(ctx context.Context) error {
+				Fail("the alert should not be processed")
+				return nil
+			}}}
+			Expect(alertPool{}.run(ctx, jobs)).To(MatchError(context.Canceled))
+		})
+	})
+})
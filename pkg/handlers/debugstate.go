@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/openshift/ocm-agent/pkg/diagnostics"
+)
+
+type DebugStateHandler struct {
+}
+
+// debug state endpoint response
+type DebugStateResponse struct {
+	Build diagnostics.BuildInfo
+	State map[string]map[string]interface{}
+}
+
+func NewDebugStateHandler() *DebugStateHandler {
+	return &DebugStateHandler{}
+}
+
+func (h *DebugStateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Handling debug state request")
+	// validate request
+	if r != nil && r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// write response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := DebugStateResponse{
+		Build: diagnostics.GetBuildInfo(),
+		State: diagnostics.Snapshot(),
+	}
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Errorf("Failed to write to response: %s\n", err)
+		http.Error(w, "Failed to write to response", http.StatusInternalServerError)
+		return
+	}
+}
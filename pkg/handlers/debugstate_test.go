@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+
+	"github.com/onsi/gomega/ghttp"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/ocm-agent/pkg/diagnostics"
+)
+
+var _ = Describe("Debug state tests", func() {
+
+	var (
+		debugStateHandler *DebugStateHandler
+		server            *ghttp.Server
+	)
+
+	BeforeEach(func() {
+		debugStateHandler = NewDebugStateHandler()
+		server = ghttp.NewServer()
+		server.AppendHandlers(debugStateHandler.ServeHTTP)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("Debug state handler post", func() {
+		It("Returns the correct http status code", func() {
+			resp, err := http.Post(server.URL(), "application/json", nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+
+	Context("Debug state handler get", func() {
+		BeforeEach(func() {
+			diagnostics.Register(diagnostics.SectionConfig, "test", func() interface{} {
+				return diagnostics.RedactSettings(map[string]interface{}{"access-token": "secret", "ocm-url": "https://example.com"}, "access-token")
+			})
+		})
+		It("Returns the build info and registered state with secrets redacted", func() {
+			resp, err := http.Get(server.URL())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Content-Type")).Should(Equal("application/json"))
+			var response DebugStateResponse
+			_ = json.NewDecoder(resp.Body).Decode(&response)
+			Expect(response.Build.GoVersion).To(Equal(runtime.Version()))
+			Expect(response.State).To(HaveKey(diagnostics.SectionCaches))
+			Expect(response.State).To(HaveKey(diagnostics.SectionQueues))
+			Expect(response.State[diagnostics.SectionConfig]["test"]).To(Equal(map[string]interface{}{
+				"access-token": diagnostics.Redacted,
+				"ocm-url":      "https://example.com",
+			}))
+		})
+	})
+})
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AnnotationEventStreams records on a ManagedNotification the event stream ID of the firing service log of each of
+// its notifications, so the resolved service log of the incident references it. Its value is a JSON object mapping a
+// notification name to the event stream ID.
+const AnnotationEventStreams = "ocmagent.managed.openshift.io/event-streams"
+
+// notificationEventStreams returns the event stream IDs of the incidents in progress of the template by notification
+func notificationEventStreams(mn *oav1alpha1.ManagedNotification) map[string]string {
+	streams := map[string]string{}
+	value, ok := mn.Annotations[AnnotationEventStreams]
+	if !ok {
+		return streams
+	}
+	err := json.Unmarshal([]byte(value), &streams)
+	if err != nil {
+		log.WithError(err).WithField(LogFieldManagedNotification, mn.Name).Warning("unable to parse the event streams annotation, ignoring it")
+		return map[string]string{}
+	}
+	return streams
+}
+
+// incidentEventStream returns the event stream ID of the service log of the alert. A firing alert starts an incident
+// whose ID is recorded before its service log is posted, the service logs sent again while it fires and the resolved
+// service log reference the recorded ID. A resolved alert whose firing service log was not recorded gets none.
+func (h *WebhookReceiverHandler) incidentEventStream(ctx context.Context, mn *oav1alpha1.ManagedNotification, name, clusterID string, alert template.Alert, firing bool) (string, error) {
+	if id, ok := notificationEventStreams(mn)[name]; ok || !firing {
+		return id, nil
+	}
+	id := eventStreamID(clusterID, name, alert)
+	if id == "" {
+		return "", nil
+	}
+	err := h.updateEventStreams(ctx, mn, func(streams map[string]string) {
+		streams[name] = id
+	})
+	return id, err
+}
+
+// endIncidentEventStream forgets the event stream ID of a notification once its alert is resolved, the next firing
+// alert starting a new incident
+func (h *WebhookReceiverHandler) endIncidentEventStream(ctx context.Context, mn *oav1alpha1.ManagedNotification, name string) {
+	if _, ok := notificationEventStreams(mn)[name]; !ok {
+		return
+	}
+	err := h.updateEventStreams(ctx, mn, func(streams map[string]string) {
+		delete(streams, name)
+	})
+	if err != nil {
+		log.WithError(err).WithFields(logrus.Fields{LogFieldNotificationName: name, LogFieldManagedNotification: mn.Name}).Warning("unable to forget the event stream of a resolved incident")
+	}
+}
+
+// updateEventStreams applies the mutation to the event stream IDs of the template and updates it. When the update
+// conflicts with another writer, the template is read again and the mutation is applied to its latest version.
+func (h *WebhookReceiverHandler) updateEventStreams(ctx context.Context, mn *oav1alpha1.ManagedNotification, mutate func(map[string]string)) error {
+	key := client.ObjectKeyFromObject(mn)
+	stale := false
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if stale {
+			*mn = oav1alpha1.ManagedNotification{}
+			if err := h.c.Get(ctx, key, mn); err != nil {
+				return err
+			}
+		}
+		stale = true
+		streams := notificationEventStreams(mn)
+		mutate(streams)
+		if len(streams) == 0 {
+			delete(mn.Annotations, AnnotationEventStreams)
+		} else {
+			value, err := json.Marshal(streams)
+			if err != nil {
+				return err
+			}
+			if mn.Annotations == nil {
+				mn.Annotations = map[string]string{}
+			}
+			mn.Annotations[AnnotationEventStreams] = string(value)
+		}
+		return h.c.Update(ctx, mn)
+	})
+}
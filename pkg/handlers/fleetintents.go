@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/ocm-agent/pkg/metrics"
+	"github.com/openshift/ocm-agent/pkg/ocm"
+)
+
+const (
+	// AnnotationPendingServiceLogs records on a ManagedFleetNotificationRecord, or on a ManagedNotification, the service
+	// logs being posted, so a service log posted by a process which died before recording it is not posted again. Its
+	// value is a JSON object mapping the idempotency key of a service log to its intent.
+	AnnotationPendingServiceLogs = "ocmagent.managed.openshift.io/pending-service-logs"
+
+	// intentClockSkew is the tolerated difference between the clocks of OCM Agent and OCM when looking up the
+	// service log of an intent
+	intentClockSkew = 5 * time.Minute
+)
+
+// serviceLogIntent is a service log about to be posted to a hosted cluster
+type serviceLogIntent struct {
+	Notification    string    `json:"notification"`
+	ResendWait      int32     `json:"resendWait"`
+	HostedClusterID string    `json:"hostedClusterID"`
+	Summary         string    `json:"summary"`
+	EventStreamID   string    `json:"eventStreamID,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// WithIdempotentServiceLogs makes the handler record the intent to post a service log on the record before posting it,
+// and look the service log up in OCM instead of posting it again when an intent was left by a failed attempt
+func (h *WebhookRHOBSReceiverHandler) WithIdempotentServiceLogs() *WebhookRHOBSReceiverHandler {
+	h.idempotent = true
+	return h
+}
+
+// intentKey returns the idempotency key of the service log of the notification for the hosted cluster. It is derived
+// from the record item the decision to post was made on, so it is the same until the service log is recorded.
+func intentKey(mfnr *oav1alpha1.ManagedFleetNotificationRecord, name, hcID string) string {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\x00%s", name, hcID)
+	item, err := mfnr.GetNotificationRecordItem(mfnr.Status.ManagementCluster, name, hcID)
+	if err == nil {
+		_, _ = fmt.Fprintf(hash, "\x00%d", item.ServiceLogSentCount)
+		if item.LastTransitionTime != nil {
+			_, _ = fmt.Fprintf(hash, "\x00%d", item.LastTransitionTime.Unix())
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// recordIntents returns the pending service logs of the record by idempotency key
+func recordIntents(mfnr *oav1alpha1.ManagedFleetNotificationRecord) map[string]serviceLogIntent {
+	intents := map[string]serviceLogIntent{}
+	value, ok := mfnr.Annotations[AnnotationPendingServiceLogs]
+	if !ok {
+		return intents
+	}
+	err := json.Unmarshal([]byte(value), &intents)
+	if err != nil {
+		log.WithError(err).WithField(LogFieldManagementClusterID, mfnr.Status.ManagementCluster).Warning("unable to parse the pending service logs annotation, ignoring it")
+		return map[string]serviceLogIntent{}
+	}
+	return intents
+}
+
+// updateRecordIntents applies the mutation to the pending service logs of the record and updates it. When the update
+// conflicts with another writer, the record is read again and the mutation is applied to its latest version.
+func (h *WebhookRHOBSReceiverHandler) updateRecordIntents(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, mutate func(map[string]serviceLogIntent)) error {
+	key := client.ObjectKeyFromObject(mfnr)
+	stale := false
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if stale {
+			*mfnr = oav1alpha1.ManagedFleetNotificationRecord{}
+			if err := h.c.Get(ctx, key, mfnr); err != nil {
+				return err
+			}
+		}
+		stale = true
+		intents := recordIntents(mfnr)
+		mutate(intents)
+		if len(intents) == 0 {
+			delete(mfnr.Annotations, AnnotationPendingServiceLogs)
+		} else {
+			value, err := json.Marshal(intents)
+			if err != nil {
+				return err
+			}
+			if mfnr.Annotations == nil {
+				mfnr.Annotations = map[string]string{}
+			}
+			mfnr.Annotations[AnnotationPendingServiceLogs] = string(value)
+		}
+		return h.c.Update(ctx, mfnr)
+	})
+}
+
+// beginServiceLog records the intent to post the service log before it is posted, and returns its idempotency key.
+// When a previous attempt left an intent for the same service log, it is looked up in OCM instead and posted is true
+// if OCM already holds it. No key is returned when service logs are not idempotent.
+func (h *WebhookRHOBSReceiverHandler) beginServiceLog(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, fn oav1alpha1.FleetNotification, req ocm.ServiceLogRequest) (string, bool, error) {
+	if !h.idempotent {
+		return "", false, nil
+	}
+	key := intentKey(mfnr, fn.Name, req.ClusterID)
+	if intent, ok := recordIntents(mfnr)[key]; ok {
+		// A previous attempt failed after posting the service log, or before recording it
+		posted, err := h.intentPosted(ctx, intent)
+		if err != nil {
+			return "", false, fmt.Errorf("unable to verify whether the service log was already posted: %w", err)
+		}
+		if posted {
+			log.WithFields(logrus.Fields{LogFieldNotificationName: fn.Name, LogFieldHostedClusterID: req.ClusterID}).Info("not sending a notification which was already posted to OCM")
+			metrics.CountServiceLogDuplicateSkipped(fn.Name)
+		}
+		return key, posted, nil
+	}
+
+	intent := serviceLogIntent{
+		Notification:    fn.Name,
+		ResendWait:      fn.ResendWait,
+		HostedClusterID: req.ClusterID,
+		Summary:         req.Summary,
+		EventStreamID:   req.EventStreamID,
+		CreatedAt:       time.Now().UTC().Truncate(time.Second),
+	}
+	err := h.updateRecordIntents(ctx, mfnr, func(intents map[string]serviceLogIntent) {
+		intents[key] = intent
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("unable to record the intent to post the service log: %w", err)
+	}
+	return key, false, nil
+}
+
+// endServiceLog removes the intent of a service log once it is recorded in the status of the record. An intent which
+// can't be removed is resolved by the next startup.
+func (h *WebhookRHOBSReceiverHandler) endServiceLog(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, key string) {
+	if key == "" {
+		return
+	}
+	err := h.updateRecordIntents(ctx, mfnr, func(intents map[string]serviceLogIntent) {
+		delete(intents, key)
+	})
+	if err != nil {
+		log.WithError(err).WithField(LogFieldManagementClusterID, mfnr.Status.ManagementCluster).Warning("unable to remove the intent of a recorded service log")
+	}
+}
+
+// intentPosted returns whether OCM holds the service log of the intent
+func (h *WebhookRHOBSReceiverHandler) intentPosted(ctx context.Context, intent serviceLogIntent) (bool, error) {
+	return h.ocm.HasServiceLog(ctx, ocm.ServiceLogQuery{
+		ClusterID:     intent.HostedClusterID,
+		Summary:       intent.Summary,
+		Firing:        true,
+		EventStreamID: intent.EventStreamID,
+		Since:         intent.CreatedAt.Add(-intentClockSkew),
+	})
+}
+
+// ReconcileServiceLogIntents resolves the intents left by a previous process. The service logs which OCM holds are
+// recorded in the status of their record if they were not, the others are forgotten and posted by the next alert.
+// Intents which can't be looked up in OCM are kept until the next startup or the next alert.
+func (h *WebhookRHOBSReceiverHandler) ReconcileServiceLogIntents(ctx context.Context) error {
+	if !h.idempotent || h.ocm == nil {
+		return nil
+	}
+	records := &oav1alpha1.ManagedFleetNotificationRecordList{}
+	err := h.c.List(ctx, records, client.InNamespace(OCMAgentNamespaceName))
+	if err != nil {
+		return fmt.Errorf("unable to list managedFleetNotificationRecords: %w", err)
+	}
+	var errs []error
+	for i := range records.Items {
+		mfnr := &records.Items[i]
+		if len(recordIntents(mfnr)) == 0 {
+			continue
+		}
+		unlock := h.recordLocks.lock(mfnr.Status.ManagementCluster)
+		err := h.reconcileRecordIntents(ctx, mfnr)
+		unlock()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// reconcileRecordIntents resolves the intents of a record
+func (h *WebhookRHOBSReceiverHandler) reconcileRecordIntents(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord) error {
+	var errs []error
+	resolved := map[string]bool{}
+	for key, intent := range recordIntents(mfnr) {
+		fields := logrus.Fields{LogFieldNotificationName: intent.Notification, LogFieldHostedClusterID: intent.HostedClusterID}
+		posted, err := h.intentPosted(ctx, intent)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to look up the service log of intent %s: %w", key, err))
+			continue
+		}
+		if posted {
+			err = h.updateRecordStatus(ctx, mfnr, func(mfnr *oav1alpha1.ManagedFleetNotificationRecord) error {
+				return recordIntent(mfnr, intent)
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to record the service log of intent %s: %w", key, err))
+				continue
+			}
+			log.WithFields(fields).Info("recorded a service log posted by a previous attempt")
+		} else {
+			log.WithFields(fields).Info("forgetting the intent of a service log which was not posted")
+		}
+		resolved[key] = true
+	}
+	if len(resolved) > 0 {
+		err := h.updateRecordIntents(ctx, mfnr, func(intents map[string]serviceLogIntent) {
+			for key := range resolved {
+				delete(intents, key)
+			}
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// recordIntent records the service log of the intent as sent, unless it was recorded since the intent was created
+func recordIntent(mfnr *oav1alpha1.ManagedFleetNotificationRecord, intent serviceLogIntent) error {
+	item, err := mfnr.GetNotificationRecordItem(mfnr.Status.ManagementCluster, intent.Notification, intent.HostedClusterID)
+	if err == nil && item.LastTransitionTime != nil && !item.LastTransitionTime.Time.Before(intent.CreatedAt) {
+		return nil
+	}
+	fn := oav1alpha1.FleetNotification{Name: intent.Notification, ResendWait: intent.ResendWait}
+	err = ensureRecordItem(mfnr, fn, intent.HostedClusterID)
+	if err != nil {
+		return err
+	}
+	_, err = mfnr.UpdateNotificationRecordItem(intent.Notification, intent.HostedClusterID)
+	return err
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"github.com/prometheus/alertmanager/template"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	testconst "github.com/openshift/ocm-agent/pkg/consts/test"
+	webhookreceivermock "github.com/openshift/ocm-agent/pkg/handlers/mocks"
+	"github.com/openshift/ocm-agent/pkg/ocm"
+	clientmocks "github.com/openshift/ocm-agent/pkg/util/test/generated/mocks/client"
+)
+
+var _ = Describe("Pending fleet service logs", func() {
+
+	var (
+		mockCtrl         *gomock.Controller
+		mockClient       *clientmocks.MockClient
+		mockStatusWriter *clientmocks.MockStatusWriter
+		mockOCMClient    *webhookreceivermock.MockOCMClient
+		testHandler      *WebhookRHOBSReceiverHandler
+		testAlert        template.Alert
+		testMFN          oav1alpha1.ManagedFleetNotification
+		testMFNR         oav1alpha1.ManagedFleetNotificationRecord
+		lastSent         time.Time
+	)
+
+	// withIntent adds the pending service log of the test notification for the test hosted cluster to the record
+	withIntent := func(mfnr *oav1alpha1.ManagedFleetNotificationRecord, createdAt time.Time) {
+		key := intentKey(mfnr, testconst.TestNotificationName, testconst.TestHostedClusterID)
+		value, err := json.Marshal(map[string]serviceLogIntent{key: {
+			Notification:    testconst.TestNotificationName,
+			ResendWait:      1,
+			HostedClusterID: testconst.TestHostedClusterID,
+			Summary:         testMFN.Spec.FleetNotification.Summary,
+			EventStreamID:   eventStreamID(testconst.TestHostedClusterID, testconst.TestNotificationName, testAlert),
+			CreatedAt:       createdAt,
+		}})
+		Expect(err).ToNot(HaveOccurred())
+		mfnr.Annotations = map[string]string{AnnotationPendingServiceLogs: string(value)}
+	}
+
+	// expectIntents expects the record to be updated with the given pending service logs
+	expectIntents := func(keys ...string) *gomock.Call {
+		return mockClient.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, opts ...client.UpdateOption) error {
+				intents := recordIntents(mfnr)
+				Expect(intents).To(HaveLen(len(keys)))
+				for _, key := range keys {
+					Expect(intents).To(HaveKey(key))
+				}
+				return nil
+			})
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockClient = clientmocks.NewMockClient(mockCtrl)
+		mockStatusWriter = clientmocks.NewMockStatusWriter(mockCtrl)
+		mockOCMClient = webhookreceivermock.NewMockOCMClient(mockCtrl)
+		testHandler = NewWebhookRHOBSReceiverHandler(mockClient, mockOCMClient).WithIdempotentServiceLogs()
+		testAlert = testconst.NewTestAlert(false, true)
+		testMFN = testconst.NewManagedFleetNotification()
+		testMFNR = testconst.NewManagedFleetNotificationRecord()
+		lastSent = time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+		testMFNR.Status.NotificationRecordByName = []oav1alpha1.NotificationRecordByName{
+			{
+				NotificationName: testconst.TestNotificationName,
+				ResendWait:       1,
+				NotificationRecordItems: []oav1alpha1.NotificationRecordItem{
+					{HostedClusterID: testconst.TestHostedClusterID, ServiceLogSentCount: 1, LastTransitionTime: &metav1.Time{Time: lastSent}},
+				},
+			},
+		}
+	})
+
+	Context("When sending a service log", func() {
+		It("Records the intent until the service log is recorded", func() {
+			key := intentKey(&testMFNR, testconst.TestNotificationName, testconst.TestHostedClusterID)
+			gomock.InOrder(
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR),
+				expectIntents(key),
+				mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Any()),
+				mockClient.EXPECT().Status().Return(mockStatusWriter),
+				mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil),
+				expectIntents(),
+			)
+			Expect(testHandler.processAlert(testconst.Context, testAlert, testMFN)).To(Succeed())
+		})
+
+		It("Does not send a service log without recording its intent", func() {
+			gomock.InOrder(
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR),
+				mockClient.EXPECT().Update(gomock.Any(), gomock.Any()).Return(fmt.Errorf("a fake error")),
+			)
+			Expect(testHandler.processAlert(testconst.Context, testAlert, testMFN)).ToNot(Succeed())
+		})
+
+		It("Does not send again a service log which OCM holds", func() {
+			withIntent(&testMFNR, time.Now().Add(-time.Minute))
+			gomock.InOrder(
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR),
+				mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, q ocm.ServiceLogQuery) (bool, error) {
+					Expect(q.ClusterID).To(Equal(testconst.TestHostedClusterID))
+					Expect(q.Summary).To(Equal(testMFN.Spec.FleetNotification.Summary))
+					Expect(q.Since).To(BeTemporally("<", time.Now().Add(-intentClockSkew)))
+					return true, nil
+				}),
+				mockClient.EXPECT().Status().Return(mockStatusWriter),
+				mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, opts ...client.SubResourceUpdateOption) error {
+						item, err := mfnr.GetNotificationRecordItem(testconst.TestManagedClusterID, testconst.TestNotificationName, testconst.TestHostedClusterID)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(item.ServiceLogSentCount).To(Equal(2))
+						return nil
+					}),
+				expectIntents(),
+			)
+			Expect(testHandler.processAlert(testconst.Context, testAlert, testMFN)).To(Succeed())
+		})
+
+		It("Sends a service log which OCM does not hold", func() {
+			withIntent(&testMFNR, time.Now().Add(-time.Minute))
+			gomock.InOrder(
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR),
+				mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).Return(false, nil),
+				mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Any()),
+				mockClient.EXPECT().Status().Return(mockStatusWriter),
+				mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil),
+				expectIntents(),
+			)
+			Expect(testHandler.processAlert(testconst.Context, testAlert, testMFN)).To(Succeed())
+		})
+
+		It("Does not send a service log which can't be looked up in OCM", func() {
+			withIntent(&testMFNR, time.Now().Add(-time.Minute))
+			gomock.InOrder(
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR),
+				mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).Return(false, fmt.Errorf("a fake error")),
+			)
+			Expect(testHandler.processAlert(testconst.Context, testAlert, testMFN)).ToNot(Succeed())
+		})
+	})
+
+	Context("When starting", func() {
+		expectList := func() *gomock.Call {
+			return mockClient.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, list *oav1alpha1.ManagedFleetNotificationRecordList, opts ...client.ListOption) error {
+					list.Items = []oav1alpha1.ManagedFleetNotificationRecord{testMFNR}
+					return nil
+				})
+		}
+
+		It("Records the service logs posted by the previous process", func() {
+			withIntent(&testMFNR, time.Now().Add(-time.Minute))
+			gomock.InOrder(
+				expectList(),
+				mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).Return(true, nil),
+				mockClient.EXPECT().Status().Return(mockStatusWriter),
+				mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, opts ...client.SubResourceUpdateOption) error {
+						item, err := mfnr.GetNotificationRecordItem(testconst.TestManagedClusterID, testconst.TestNotificationName, testconst.TestHostedClusterID)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(item.ServiceLogSentCount).To(Equal(2))
+						Expect(item.LastTransitionTime.After(lastSent)).To(BeTrue())
+						return nil
+					}),
+				expectIntents(),
+			)
+			Expect(testHandler.ReconcileServiceLogIntents(context.Background())).To(Succeed())
+		})
+
+		It("Does not record twice a service log which was recorded", func() {
+			withIntent(&testMFNR, lastSent.Add(-time.Minute))
+			gomock.InOrder(
+				expectList(),
+				mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).Return(true, nil),
+				mockClient.EXPECT().Status().Return(mockStatusWriter),
+				mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, opts ...client.SubResourceUpdateOption) error {
+						item, err := mfnr.GetNotificationRecordItem(testconst.TestManagedClusterID, testconst.TestNotificationName, testconst.TestHostedClusterID)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(item.ServiceLogSentCount).To(Equal(1))
+						return nil
+					}),
+				expectIntents(),
+			)
+			Expect(testHandler.ReconcileServiceLogIntents(context.Background())).To(Succeed())
+		})
+
+		It("Forgets the service logs which were not posted", func() {
+			withIntent(&testMFNR, time.Now().Add(-time.Minute))
+			gomock.InOrder(
+				expectList(),
+				mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).Return(false, nil),
+				expectIntents(),
+			)
+			Expect(testHandler.ReconcileServiceLogIntents(context.Background())).To(Succeed())
+		})
+
+		It("Keeps the service logs which can't be looked up in OCM", func() {
+			withIntent(&testMFNR, time.Now().Add(-time.Minute))
+			gomock.InOrder(
+				expectList(),
+				mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).Return(false, fmt.Errorf("a fake error")),
+			)
+			Expect(testHandler.ReconcileServiceLogIntents(context.Background())).ToNot(Succeed())
+		})
+	})
+})
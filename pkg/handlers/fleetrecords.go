@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/ocm-agent/pkg/metrics"
+)
+
+const (
+	// Reasons of the pruned fleet record items metric
+	FleetRecordPruneReasonClusterDeleted = "cluster_deleted"
+	FleetRecordPruneReasonExpired        = "expired"
+)
+
+// FleetRecordCollector prunes the items of the ManagedFleetNotificationRecords which are of no use anymore, so the
+// records don't grow with every hosted cluster ever notified. An item is pruned when its hosted cluster no longer
+// exists in OCM, or when no notification was sent for it during the retention window.
+type FleetRecordCollector struct {
+	c         client.Client
+	clusters  HostedClusterChecker
+	retention time.Duration
+	now       func() time.Time
+}
+
+// NewFleetRecordCollector returns a collector pruning the items older than the retention, a zero retention disables
+// the pruning by age. The items of deleted clusters are only pruned when a checker is given.
+func NewFleetRecordCollector(c client.Client, clusters HostedClusterChecker, retention time.Duration) *FleetRecordCollector {
+	return &FleetRecordCollector{
+		c:         c,
+		clusters:  clusters,
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// Start collects the records every interval until the context is done
+func (g *FleetRecordCollector) Start(ctx context.Context, interval time.Duration) {
+	log.WithFields(logrus.Fields{"Interval": interval, "Retention": g.retention}).Info("Starting the collection of fleet notification records")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := g.Collect(ctx); err != nil {
+			log.WithError(err).Error("unable to collect the fleet notification records")
+		}
+	}, interval)
+}
+
+// Collect prunes the items of all the ManagedFleetNotificationRecords and updates their size metrics
+func (g *FleetRecordCollector) Collect(ctx context.Context) error {
+	records := &oav1alpha1.ManagedFleetNotificationRecordList{}
+	err := g.c.List(ctx, records, client.InNamespace(OCMAgentNamespaceName))
+	if err != nil {
+		return fmt.Errorf("unable to list managedFleetNotificationRecords: %w", err)
+	}
+	// Forget the sizes of the records which were deleted
+	metrics.ResetMetric(metrics.MetricFleetRecordItems)
+	metrics.ResetMetric(metrics.MetricFleetRecordSize)
+
+	var errs []error
+	for _, record := range records.Items {
+		if err := g.collectRecord(ctx, record.Name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// collectRecord prunes the items of a record, the record is read again when its update conflicts with another one
+func (g *FleetRecordCollector) collectRecord(ctx context.Context, name string) error {
+	var mfnr *oav1alpha1.ManagedFleetNotificationRecord
+	var pruned map[string]int
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		mfnr = &oav1alpha1.ManagedFleetNotificationRecord{}
+		err := g.c.Get(ctx, client.ObjectKey{Namespace: OCMAgentNamespaceName, Name: name}, mfnr)
+		if err != nil {
+			return err
+		}
+		var changed bool
+		pruned, changed = g.prune(ctx, mfnr)
+		if !changed {
+			return nil
+		}
+		return g.c.Status().Update(ctx, mfnr)
+	})
+	if apierrors.IsNotFound(err) {
+		// The record was deleted since it was listed
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to prune managedFleetNotificationRecord %s: %w", name, err)
+	}
+
+	items := 0
+	for _, nfr := range mfnr.Status.NotificationRecordByName {
+		items += len(nfr.NotificationRecordItems)
+	}
+	fields := logrus.Fields{LogFieldManagementClusterID: mfnr.Status.ManagementCluster, "Items": items}
+	for reason, count := range pruned {
+		metrics.CountFleetRecordItemsPruned(reason, count)
+		fields[reason] = count
+	}
+	if len(pruned) > 0 {
+		log.WithFields(fields).Info("pruned the fleet notification record")
+	}
+
+	size, err := json.Marshal(mfnr)
+	if err != nil {
+		return fmt.Errorf("unable to encode managedFleetNotificationRecord %s: %w", name, err)
+	}
+	metrics.SetFleetRecordSize(name, items, len(size))
+	return nil
+}
+
+// prune removes the items which are of no use anymore from the record, and the notifications left without items.
+// It returns the number of pruned items by reason and whether the record was changed.
+func (g *FleetRecordCollector) prune(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord) (map[string]int, bool) {
+	now := g.now()
+	pruned := map[string]int{}
+	changed := false
+	byName := make([]oav1alpha1.NotificationRecordByName, 0, len(mfnr.Status.NotificationRecordByName))
+	for _, nfr := range mfnr.Status.NotificationRecordByName {
+		items := make([]oav1alpha1.NotificationRecordItem, 0, len(nfr.NotificationRecordItems))
+		for _, item := range nfr.NotificationRecordItems {
+			reason := g.pruneReason(ctx, now, nfr, item)
+			if reason == "" {
+				items = append(items, item)
+				continue
+			}
+			log.WithFields(logrus.Fields{
+				LogFieldNotificationName:    nfr.NotificationName,
+				LogFieldManagementClusterID: mfnr.Status.ManagementCluster,
+				LogFieldHostedClusterID:     item.HostedClusterID,
+			}).Debugf("pruning fleet notification record item: %s", reason)
+			pruned[reason]++
+			changed = true
+		}
+		nfr.NotificationRecordItems = items
+		if len(items) == 0 {
+			// The notification is recorded again by the next alert
+			changed = true
+			continue
+		}
+		byName = append(byName, nfr)
+	}
+	mfnr.Status.NotificationRecordByName = byName
+	return pruned, changed
+}
+
+// pruneReason returns why the item is to be pruned, or an empty string if it is kept
+func (g *FleetRecordCollector) pruneReason(ctx context.Context, now time.Time, nfr oav1alpha1.NotificationRecordByName, item oav1alpha1.NotificationRecordItem) string {
+	if g.retention > 0 && item.LastTransitionTime != nil {
+		// Pruning an item within its resend wait would let the notification be sent again too early
+		retention := g.retention
+		if resendWait := time.Duration(nfr.ResendWait) * time.Hour; resendWait > retention {
+			retention = resendWait
+		}
+		if now.Sub(item.LastTransitionTime.Time) > retention {
+			return FleetRecordPruneReasonExpired
+		}
+	}
+	if g.clusters == nil {
+		return ""
+	}
+	exists, err := g.clusters.ClusterExists(ctx, item.HostedClusterID)
+	if err != nil {
+		// The item is kept, the cluster is checked again by the next collection
+		log.WithError(err).WithField(LogFieldHostedClusterID, item.HostedClusterID).Warning("unable to check whether the hosted cluster exists")
+		return ""
+	}
+	if !exists {
+		return FleetRecordPruneReasonClusterDeleted
+	}
+	return ""
+}
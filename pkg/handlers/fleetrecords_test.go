@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	testconst "github.com/openshift/ocm-agent/pkg/consts/test"
+	webhookreceivermock "github.com/openshift/ocm-agent/pkg/handlers/mocks"
+	clientmocks "github.com/openshift/ocm-agent/pkg/util/test/generated/mocks/client"
+)
+
+var _ = Describe("Fleet notification record collector", func() {
+
+	const (
+		deletedHCID  = "deleted-hosted-cluster-id"
+		inactiveHCID = "inactive-hosted-cluster-id"
+	)
+
+	var (
+		mockCtrl         *gomock.Controller
+		mockClient       *clientmocks.MockClient
+		mockStatusWriter *clientmocks.MockStatusWriter
+		mockChecker      *webhookreceivermock.MockHostedClusterChecker
+		collector        *FleetRecordCollector
+		testMFNR         oav1alpha1.ManagedFleetNotificationRecord
+		now              time.Time
+	)
+
+	item := func(hcID string, lastSent time.Time) oav1alpha1.NotificationRecordItem {
+		return oav1alpha1.NotificationRecordItem{HostedClusterID: hcID, ServiceLogSentCount: 1, LastTransitionTime: &metav1.Time{Time: lastSent}}
+	}
+
+	// expectList returns the test record when listing the records and fetching it
+	expectList := func() {
+		mockClient.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, list *oav1alpha1.ManagedFleetNotificationRecordList, opts ...client.ListOption) error {
+				list.Items = []oav1alpha1.ManagedFleetNotificationRecord{testMFNR}
+				return nil
+			})
+		mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR)
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockClient = clientmocks.NewMockClient(mockCtrl)
+		mockStatusWriter = clientmocks.NewMockStatusWriter(mockCtrl)
+		mockChecker = webhookreceivermock.NewMockHostedClusterChecker(mockCtrl)
+		now = time.Now()
+		collector = NewFleetRecordCollector(mockClient, mockChecker, 7*24*time.Hour)
+		collector.now = func() time.Time { return now }
+		testMFNR = testconst.NewManagedFleetNotificationRecord()
+		testMFNR.Status.NotificationRecordByName = []oav1alpha1.NotificationRecordByName{
+			{
+				NotificationName: testconst.TestNotificationName,
+				ResendWait:       24,
+				NotificationRecordItems: []oav1alpha1.NotificationRecordItem{
+					item(testconst.TestHostedClusterID, now.Add(-time.Hour)),
+					item(deletedHCID, now.Add(-time.Hour)),
+					item(inactiveHCID, now.Add(-8*24*time.Hour)),
+				},
+			},
+		}
+	})
+
+	It("Prunes the items of deleted and inactive hosted clusters", func() {
+		expectList()
+		mockChecker.EXPECT().ClusterExists(gomock.Any(), testconst.TestHostedClusterID).Return(true, nil)
+		mockChecker.EXPECT().ClusterExists(gomock.Any(), deletedHCID).Return(false, nil)
+		mockClient.EXPECT().Status().Return(mockStatusWriter)
+		mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, opts ...client.SubResourceUpdateOption) error {
+				Expect(mfnr.Status.NotificationRecordByName).To(HaveLen(1))
+				items := mfnr.Status.NotificationRecordByName[0].NotificationRecordItems
+				Expect(items).To(HaveLen(1))
+				Expect(items[0].HostedClusterID).To(Equal(testconst.TestHostedClusterID))
+				return nil
+			})
+
+		Expect(collector.Collect(context.Background())).To(Succeed())
+	})
+
+	It("Removes the notifications left without items", func() {
+		testMFNR.Status.NotificationRecordByName[0].NotificationRecordItems = testMFNR.Status.NotificationRecordByName[0].NotificationRecordItems[1:2]
+		expectList()
+		mockChecker.EXPECT().ClusterExists(gomock.Any(), deletedHCID).Return(false, nil)
+		mockClient.EXPECT().Status().Return(mockStatusWriter)
+		mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, opts ...client.SubResourceUpdateOption) error {
+				Expect(mfnr.Status.NotificationRecordByName).To(BeEmpty())
+				return nil
+			})
+
+		Expect(collector.Collect(context.Background())).To(Succeed())
+	})
+
+	It("Keeps the items within the resend wait of their notification", func() {
+		testMFNR.Status.NotificationRecordByName[0].ResendWait = 10 * 24
+		testMFNR.Status.NotificationRecordByName[0].NotificationRecordItems = testMFNR.Status.NotificationRecordByName[0].NotificationRecordItems[2:]
+		expectList()
+		mockChecker.EXPECT().ClusterExists(gomock.Any(), inactiveHCID).Return(true, nil)
+
+		Expect(collector.Collect(context.Background())).To(Succeed())
+	})
+
+	It("Keeps the items whose cluster can't be checked", func() {
+		expectList()
+		mockChecker.EXPECT().ClusterExists(gomock.Any(), testconst.TestHostedClusterID).Return(true, nil)
+		mockChecker.EXPECT().ClusterExists(gomock.Any(), deletedHCID).Return(false, fmt.Errorf("a fake error"))
+		mockClient.EXPECT().Status().Return(mockStatusWriter)
+		mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, opts ...client.SubResourceUpdateOption) error {
+				Expect(mfnr.Status.NotificationRecordByName[0].NotificationRecordItems).To(HaveLen(2))
+				return nil
+			})
+
+		Expect(collector.Collect(context.Background())).To(Succeed())
+	})
+
+	It("Retries the update on the latest record when it conflicts", func() {
+		conflict := errors.NewConflict(schema.GroupResource{Group: oav1alpha1.GroupVersion.Group, Resource: "ManagedFleetNotificationRecord"},
+			testconst.TestManagedClusterID, fmt.Errorf("the object has been modified"))
+		expectList()
+		mockChecker.EXPECT().ClusterExists(gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
+		mockClient.EXPECT().Status().Return(mockStatusWriter).Times(2)
+		mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).Return(conflict)
+		mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR)
+		mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+
+		Expect(collector.Collect(context.Background())).To(Succeed())
+	})
+
+	It("Ignores the records deleted since they were listed", func() {
+		mockClient.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, list *oav1alpha1.ManagedFleetNotificationRecordList, opts ...client.ListOption) error {
+				list.Items = []oav1alpha1.ManagedFleetNotificationRecord{testMFNR}
+				return nil
+			})
+		mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.NewNotFound(schema.GroupResource{
+			Group: oav1alpha1.GroupVersion.Group, Resource: "ManagedFleetNotificationRecord"}, testconst.TestManagedClusterID))
+
+		Expect(collector.Collect(context.Background())).To(Succeed())
+	})
+
+	It("Fails when the records can't be listed", func() {
+		mockClient.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("a fake error"))
+
+		Expect(collector.Collect(context.Background())).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// WithRecordShards makes the handler spread the notification records of a management cluster over the given number
+// of ManagedFleetNotificationRecords by hash of the hosted cluster ID, so no record grows past the size limit of etcd
+// objects. With one shard or less, a single record named after the management cluster holds them all.
+// The record items held by another record than the one of their hosted cluster are migrated before the first alert.
+func (h *WebhookRHOBSReceiverHandler) WithRecordShards(shards int) *WebhookRHOBSReceiverHandler {
+	h.recordShards = shards
+	h.migration = &recordMigration{}
+	return h
+}
+
+// fleetRecordName returns the name of the ManagedFleetNotificationRecord holding the records of the hosted cluster
+func fleetRecordName(mcID, hcID string, shards int) string {
+	if shards <= 1 {
+		return mcID
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(hcID))
+	return fmt.Sprintf("%s-shard-%d", mcID, hash.Sum32()%uint32(shards))
+}
+
+// recordMigration remembers whether the records were migrated to the shard count of the handler by this process
+type recordMigration struct {
+	mutex    sync.Mutex
+	migrated bool
+}
+
+// ensureRecordsMigrated migrates the records once per process, before the first alert reads them. A failed migration
+// is attempted again by the next alert. Handlers without a shard count set don't migrate.
+func (h *WebhookRHOBSReceiverHandler) ensureRecordsMigrated(ctx context.Context) error {
+	if h.migration == nil {
+		return nil
+	}
+	h.migration.mutex.Lock()
+	defer h.migration.mutex.Unlock()
+	if h.migration.migrated {
+		return nil
+	}
+	err := h.migrateRecords(ctx)
+	if err != nil {
+		return err
+	}
+	h.migration.migrated = true
+	return nil
+}
+
+// migrateRecords moves the record items held by another record than the one of their hosted cluster for the shard
+// count of the handler: the items of the single record of a management cluster once its records are sharded, of the
+// shards of another shard count, or of the shards once they are gone back to a single record.
+// The items are saved in their record before being removed from the other one, so a failure never loses them.
+func (h *WebhookRHOBSReceiverHandler) migrateRecords(ctx context.Context) error {
+	records := &oav1alpha1.ManagedFleetNotificationRecordList{}
+	err := h.c.List(ctx, records, client.InNamespace(OCMAgentNamespaceName))
+	if err != nil {
+		return fmt.Errorf("unable to list managedFleetNotificationRecords: %w", err)
+	}
+	byName := map[string]*oav1alpha1.ManagedFleetNotificationRecord{}
+	for i := range records.Items {
+		byName[records.Items[i].Name] = &records.Items[i]
+	}
+	for i := range records.Items {
+		err = h.migrateRecord(ctx, &records.Items[i], byName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// misplacedItem is a record item to move to another record, along with the notification it belongs to
+type misplacedItem struct {
+	notification string
+	resendWait   int32
+	item         oav1alpha1.NotificationRecordItem
+}
+
+// migrateRecord moves the misplaced record items of the record to the records of their hosted clusters
+func (h *WebhookRHOBSReceiverHandler) migrateRecord(ctx context.Context, previous *oav1alpha1.ManagedFleetNotificationRecord, byName map[string]*oav1alpha1.ManagedFleetNotificationRecord) error {
+	mcID := previous.Status.ManagementCluster
+	if mcID == "" {
+		return nil
+	}
+	misplaced := map[string][]misplacedItem{}
+	for _, nfr := range previous.Status.NotificationRecordByName {
+		for _, item := range nfr.NotificationRecordItems {
+			name := fleetRecordName(mcID, item.HostedClusterID, h.recordShards)
+			if name != previous.Name {
+				misplaced[name] = append(misplaced[name], misplacedItem{notification: nfr.NotificationName, resendWait: nfr.ResendWait, item: item})
+			}
+		}
+	}
+	if len(misplaced) == 0 {
+		return nil
+	}
+
+	unlock := h.recordLocks.lock(mcID)
+	defer unlock()
+
+	for name, items := range misplaced {
+		mfnr, ok := byName[name]
+		if !ok {
+			created, err := h.createManagedFleetNotificationRecord(ctx, name, mcID)
+			if err != nil {
+				return fmt.Errorf("unable to create managedFleetNotificationRecord %s: %w", name, err)
+			}
+			byName[name] = created
+			mfnr = created
+		}
+		// An item already in the record is more recent than the misplaced one, it is kept
+		err := h.updateRecordStatus(ctx, mfnr, func(mfnr *oav1alpha1.ManagedFleetNotificationRecord) error {
+			if mfnr.Status.ManagementCluster == "" {
+				mfnr.Status.ManagementCluster = mcID
+			}
+			for _, m := range items {
+				if !mfnr.HasNotificationRecordItem(mcID, m.notification, m.item.HostedClusterID) {
+					putRecordItem(mfnr, m.notification, m.resendWait, m.item)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("unable to add the migrated record items to %s: %w", name, err)
+		}
+		log.WithFields(logrus.Fields{
+			"From":  previous.Name,
+			"To":    name,
+			"Items": len(items),
+		}).Info("migrated the fleet notification record items")
+	}
+
+	err := h.updateRecordStatus(ctx, previous, func(previous *oav1alpha1.ManagedFleetNotificationRecord) error {
+		for _, items := range misplaced {
+			for _, m := range items {
+				// The item may have been pruned in the meantime
+				_, _ = previous.RemoveNotificationRecordItem(m.notification, m.item.HostedClusterID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to remove the migrated record items from %s: %w", previous.Name, err)
+	}
+	return nil
+}
+
+// putRecordItem adds the item to the record of the notification, which is added to the status if missing
+func putRecordItem(mfnr *oav1alpha1.ManagedFleetNotificationRecord, name string, resendWait int32, item oav1alpha1.NotificationRecordItem) {
+	for i := range mfnr.Status.NotificationRecordByName {
+		nfr := &mfnr.Status.NotificationRecordByName[i]
+		if nfr.NotificationName == name {
+			nfr.NotificationRecordItems = append(nfr.NotificationRecordItems, item)
+			return
+		}
+	}
+	mfnr.Status.NotificationRecordByName = append(mfnr.Status.NotificationRecordByName, oav1alpha1.NotificationRecordByName{
+		NotificationName:        name,
+		ResendWait:              resendWait,
+		NotificationRecordItems: []oav1alpha1.NotificationRecordItem{item},
+	})
+}
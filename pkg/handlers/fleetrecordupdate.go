@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// keyedMutex serializes the holders of the same key, its zero value is ready to use. The lock of a key is only kept
+// while it is held or waited for, so keys which are no longer used don't accumulate.
+type keyedMutex struct {
+	mutex sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock is the lock of a key and the number of its holders and waiters
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the key and returns the function unlocking it
+func (k *keyedMutex) lock(key string) func() {
+	k.mutex.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*keyedLock{}
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mutex.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mutex.Lock()
+		defer k.mutex.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+	}
+}
+
+// updateRecordStatus applies the mutation to the record and updates its status. When the update conflicts with
+// another writer, e.g. the record collector or another replica, the record is read again and the mutation is
+// applied to its latest version.
+func (h *WebhookRHOBSReceiverHandler) updateRecordStatus(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, mutate func(*oav1alpha1.ManagedFleetNotificationRecord) error) error {
+	key := client.ObjectKeyFromObject(mfnr)
+	stale := false
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if stale {
+			*mfnr = oav1alpha1.ManagedFleetNotificationRecord{}
+			if err := h.c.Get(ctx, key, mfnr); err != nil {
+				return err
+			}
+		}
+		stale = true
+		if err := mutate(mfnr); err != nil {
+			return err
+		}
+		return h.c.Status().Update(ctx, mfnr)
+	})
+}
+
+// ensureRecordItem adds the record item of the hosted cluster for the notification to the record, along with the
+// record of the notification, when they don't exist yet
+func ensureRecordItem(mfnr *oav1alpha1.ManagedFleetNotificationRecord, fn oav1alpha1.FleetNotification, hcID string) error {
+	mcID := mfnr.Status.ManagementCluster
+	nfr, err := mfnr.GetNotificationRecordByName(mcID, fn.Name)
+	if err != nil {
+		_, err = addNotificationRecordByName(fn.Name, fn.ResendWait, hcID, mfnr)
+		return err
+	}
+	if mfnr.HasNotificationRecordItem(mcID, fn.Name, hcID) {
+		return nil
+	}
+	_, err = mfnr.AddNotificationRecordItem(hcID, nfr)
+	return err
+}
@@ -1,19 +1,32 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/openshift-online/ocm-cli/pkg/arguments"
 	sdk "github.com/openshift-online/ocm-sdk-go"
 	"github.com/openshift/ocm-agent-operator/api/v1alpha1"
 	"github.com/prometheus/alertmanager/template"
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/openshift/ocm-agent/pkg/audit"
 	"github.com/openshift/ocm-agent/pkg/consts"
+	"github.com/openshift/ocm-agent/pkg/logging"
 	"github.com/openshift/ocm-agent/pkg/ocm"
+	"github.com/openshift/ocm-agent/pkg/sink"
+	"github.com/openshift/ocm-agent/pkg/suppression"
 
 	_ "github.com/golang/mock/mockgen/model"
 )
@@ -34,6 +47,7 @@ const (
 	LogFieldAlert                      = "alert"
 	LogFieldIsFiring                   = "is_firing"
 	LogFieldManagedNotification        = "managed_notification_cr"
+	LogFieldClusterID                  = "cluster_id"
 	LogFieldPostServiceLogOpId         = "post_servicelog_operation_id"
 	LogFieldPostServiceLogFailedReason = "post_servicelog_failed_reason"
 	ServiceLogActivePrefix             = "Issue Notification"
@@ -41,8 +55,24 @@ const (
 
 	// Header returned in OCM responses
 	HeaderOperationId = "X-Operation-Id"
+
+	// Reasons of the events recorded on notification templates, events for sent and failed
+	// service logs are recorded by the audit trail
+	EventReasonServiceLogSuppressed = "ServiceLogSuppressed"
+	EventReasonInvalidAlert         = "InvalidAlert"
+
+	// AnnotationSinks selects the delivery paths of the notifications of a template. Its value is a JSON object
+	// mapping a notification name to a list of sink names, "service_logs" being the OCM service log.
+	// Notifications which are not listed are only sent as service logs.
+	AnnotationSinks = "ocmagent.managed.openshift.io/sinks"
+
+	// AnnotationServiceLogOptions sets the optional fields of the service logs of a template. Its value is a JSON
+	// object mapping a notification name to its options, e.g. {"internalOnly": true, "serviceName": "..."}.
+	AnnotationServiceLogOptions = "ocmagent.managed.openshift.io/service-log-options"
 )
 
+var log = logging.Subsystem(logging.SubsystemHandlers)
+
 // Alert Manager receiver response
 type AMReceiverResponse struct {
 	Error  error
@@ -59,25 +89,41 @@ type AMReceiverAlert template.Alert
 //
 //go:generate mockgen -destination=mocks/helper.go -package=mocks github.com/openshift/ocm-agent/pkg/handlers OCMClient
 type OCMClient interface {
-	SendServiceLog(summary, firingDesc, resolveDesc, clusterID string, severity v1alpha1.NotificationSeverity, logType string, references []v1alpha1.NotificationReferenceType, firing bool) error
+	SendServiceLog(ctx context.Context, req ocm.ServiceLogRequest) (*ocm.ServiceLogResponse, error)
+	// HasServiceLog returns whether OCM holds a service log matching the query
+	HasServiceLog(ctx context.Context, q ocm.ServiceLogQuery) (bool, error)
 }
 
 type ocmsdkclient struct {
-	ocm *sdk.Connection
+	ocm      *sdk.Connection
+	resolver *ocm.ClusterIDResolver
+	dryRun   bool
 }
 
 type WebhookReceiverHandler struct {
-	c   client.Client
-	ocm OCMClient
+	c              client.Client
+	ocm            OCMClient
+	limitedSupport LimitedSupportClient
+	recorder       record.EventRecorder
+	sinks          *sink.Registry
+	idempotent     bool
+	leader         LeaderChecker
+	pool           alertPool
+	severities     map[string]v1alpha1.NotificationSeverity
+	references     alertReferences
+	suppressor     *suppression.Suppressor
+	preferences    *preferencesReader
 }
 
 type OCMResponseBody struct {
 	Reason string `json:"reason"`
 }
 
-func NewOcmClient(ocm *sdk.Connection) OCMClient {
+func NewOcmClient(conn *sdk.Connection, resolver *ocm.ClusterIDResolver, dryRun bool) OCMClient {
 	return &ocmsdkclient{
-		ocm: ocm,
+		ocm:      conn,
+		resolver: resolver,
+		dryRun:   dryRun,
 	}
 }
 
@@ -139,51 +185,303 @@ func alertName(a template.Alert) (*string, error) {
 	return nil, fmt.Errorf("no alertname defined in alert")
 }
 
-// SendServiceLog sends a servicelog notification for the given alert
-func (o *ocmsdkclient) SendServiceLog(summary, firingDesc, resolveDesc, clusterID string, severity v1alpha1.NotificationSeverity, logType string, references []v1alpha1.NotificationReferenceType, firing bool) error {
-	req := o.ocm.Post()
-	err := arguments.ApplyPathArg(req, "/api/service_logs/v1/cluster_logs")
+// recordEvent records an event on the notification template if an event recorder is configured
+func recordEvent(recorder record.EventRecorder, obj runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	if recorder == nil || obj == nil {
+		return
+	}
+	recorder.Eventf(obj, eventtype, reason, messageFmt, args...)
+}
+
+// auditServiceLog records the outcome of posting the service log for an alert to the audit trail
+func auditServiceLog(obj runtime.Object, templateName, clusterID string, alert template.Alert, firing bool, res *ocm.ServiceLogResponse, err error) {
+	r := audit.Record{
+		ClusterID:        clusterID,
+		Template:         templateName,
+		Firing:           firing,
+		AlertFingerprint: alert.Fingerprint,
+		Outcome:          audit.OutcomeSent,
+		Object:           obj,
+	}
+	if res != nil {
+		r.Summary = res.ServiceLog.Summary
+		r.Description = res.ServiceLog.Description
+		r.OperationID = res.OperationID
+	}
+	if res != nil && res.DryRun {
+		r.Outcome = audit.OutcomeDryRun
+	}
 	if err != nil {
-		return err
+		r.Outcome = audit.OutcomeFailed
+		if isCancelled(err) {
+			r.Outcome = audit.OutcomeCancelled
+		}
+		r.Error = err.Error()
+	}
+	audit.Write(r)
+}
+
+// isCancelled returns whether the error is due to the request of the alert being cancelled or running out of time
+func isCancelled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// logAlertError logs the failure to process an alert, an alert whose request was cancelled is only warned about as
+// Alertmanager sends it again
+func logAlertError(err error, msg string) {
+	if isCancelled(err) {
+		log.WithError(err).Warning(msg + ", its request was cancelled")
+		return
+	}
+	log.WithError(err).Error(msg)
+}
+
+// recordContext returns the context recording a notification which was sent. It is not derived from the request, so
+// the notification is recorded even if the request is cancelled meanwhile and it is not sent again.
+func recordContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), consts.RecordUpdateTimeout)
+}
+
+// notificationSinks returns the delivery paths selected for a notification by the annotations of its template
+func notificationSinks(annotations map[string]string, name string) []string {
+	defaultSinks := []string{sink.ServiceLog}
+	value, ok := annotations[AnnotationSinks]
+	if !ok {
+		return defaultSinks
 	}
+	var sinksByNotification map[string][]string
+	err := json.Unmarshal([]byte(value), &sinksByNotification)
+	if err != nil {
+		log.WithError(err).WithField(LogFieldNotificationName, name).Warning("unable to parse the sinks annotation, sending a service log only")
+		return defaultSinks
+	}
+	sinks, ok := sinksByNotification[name]
+	if !ok || len(sinks) == 0 {
+		return defaultSinks
+	}
+	return sinks
+}
+
+// eventStreamID returns a new ID grouping the service logs of the same incident of an alert for a notification.
+// It is derived from the fingerprint and start time of the alert, so the fleet service logs sent again while an
+// alert keeps firing share it. The traditional mode records it when the incident starts, see incidentEventStream.
+func eventStreamID(clusterID, notificationName string, alert template.Alert) string {
+	if alert.Fingerprint == "" && alert.StartsAt.IsZero() {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{clusterID, notificationName, alert.Fingerprint, alert.StartsAt.UTC().Format(time.RFC3339Nano)}, "/")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// withIncidentDuration appends the duration of the incident to the description of a resolved service log,
+// the description is returned as is when the alert doesn't tell when it started and ended
+func withIncidentDuration(desc string, alert template.Alert) string {
+	if desc == "" || alert.StartsAt.IsZero() || alert.EndsAt.IsZero() || !alert.EndsAt.After(alert.StartsAt) {
+		return desc
+	}
+	return fmt.Sprintf("%s\n\nThe issue lasted %s.", desc, formatIncidentDuration(alert.EndsAt.Sub(alert.StartsAt)))
+}
+
+// formatIncidentDuration formats the duration in hours and minutes, e.g. 2h 5m
+func formatIncidentDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Minute {
+		return "less than a minute"
+	}
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	if hours == 0 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %dm", hours, minutes)
+}
+
+// notificationServiceLogOptions returns the optional fields set for the service logs of a notification by the
+// annotations of its template
+func notificationServiceLogOptions(annotations map[string]string, name string) ocm.ServiceLogOptions {
+	value, ok := annotations[AnnotationServiceLogOptions]
+	if !ok {
+		return ocm.ServiceLogOptions{}
+	}
+	var optionsByNotification map[string]ocm.ServiceLogOptions
+	err := json.Unmarshal([]byte(value), &optionsByNotification)
+	if err != nil {
+		log.WithError(err).WithField(LogFieldNotificationName, name).Warning("unable to parse the service log options annotation, ignoring it")
+		return ocm.ServiceLogOptions{}
+	}
+	return optionsByNotification[name]
+}
+
+// containsSink returns whether the named sink is part of the list
+func containsSink(sinks []string, name string) bool {
+	for _, s := range sinks {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
 
+// withoutSink returns the list without the named sink
+func withoutSink(sinks []string, name string) []string {
+	filtered := make([]string, 0, len(sinks))
+	for _, s := range sinks {
+		if s != name {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+// newSinkMessage builds the message delivered to sinks, mirroring the service log sent for the alert
+func newSinkMessage(name, clusterID, summary, firingDesc, resolveDesc string, severity v1alpha1.NotificationSeverity, firing bool) sink.Message {
+	m := sink.Message{
+		Notification: name,
+		ClusterID:    clusterID,
+		Severity:     string(severity),
+		Summary:      serviceLogSummary(summary, firing),
+		Firing:       firing,
+	}
+	if firing {
+		m.Description = firingDesc
+	} else {
+		m.Description = resolveDesc
+	}
+	return m
+}
+
+// deliverToSinks sends the message to every selected sink other than the service log. An error is only returned
+// when no delivery path succeeded, so that a notification already delivered somewhere is not sent again.
+func deliverToSinks(ctx context.Context, registry *sink.Registry, sinks []string, m sink.Message) error {
+	delivered := false
+	var errs []error
+	for _, name := range sinks {
+		if name == sink.ServiceLog {
+			// The service log is sent by the caller, which returns early when it fails
+			delivered = true
+			continue
+		}
+		if registry == nil || !registry.Has(name) {
+			log.WithFields(logrus.Fields{LogFieldNotificationName: m.Notification, "sink": name}).Warning("notification selects a sink which is not configured")
+			errs = append(errs, fmt.Errorf("sink %s is not configured", name))
+			continue
+		}
+		err := registry.Send(ctx, name, m)
+		if err != nil {
+			log.WithError(err).WithFields(logrus.Fields{LogFieldNotificationName: m.Notification, "sink": name}).Error("unable to deliver notification to sink")
+			errs = append(errs, err)
+			continue
+		}
+		delivered = true
+	}
+	if !delivered && len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	return nil
+}
+
+// SendServiceLog sends a servicelog notification for the given alert and returns what was sent.
+// The response is also returned when OCM rejected the service log so the failure can be audited.
+// A dry run makes no call to OCM, the cluster is not resolved and the service log only holds its external ID.
+func (o *ocmsdkclient) SendServiceLog(ctx context.Context, r ocm.ServiceLogRequest) (*ocm.ServiceLogResponse, error) {
+	serviceName := r.ServiceName
+	if serviceName == "" {
+		serviceName = consts.ServiceLogServiceName
+	}
 	sl := ocm.ServiceLog{
-		ServiceName:   consts.ServiceLogServiceName,
-		ClusterUUID:   clusterID,
-		Summary:       summary,
-		InternalOnly:  false,
-		Severity:      severity,
-		LogType:       logType,
-		DocReferences: references,
+		ServiceName:   serviceName,
+		ClusterUUID:   r.ClusterID,
+		InternalOnly:  r.InternalOnly,
+		Severity:      r.Severity,
+		LogType:       r.LogType,
+		DocReferences: r.References,
+		EventStreamID: r.EventStreamID,
+		Username:      r.Username,
+		CreatedBy:     r.CreatedBy,
 	}
 
 	// Use different Summary and Description for firing and resolved status for an alert
-	if firing {
-		sl.Description = firingDesc
-		sl.Summary = ServiceLogActivePrefix + ": " + summary
+	sl.Summary = serviceLogSummary(r.Summary, r.Firing)
+	if r.Firing {
+		sl.Description = r.FiringDesc
 	} else {
-		sl.Description = resolveDesc
-		sl.Summary = ServiceLogResolvePrefix + ": " + summary
+		sl.Description = r.ResolveDesc
+	}
+	response := &ocm.ServiceLogResponse{ServiceLog: sl}
+	if o.dryRun {
+		log.WithFields(logrus.Fields{"summary": sl.Summary, "cluster_id": r.ClusterID}).Info("dry run, not sending service log")
+		response.DryRun = true
+		return response, nil
+	}
+
+	// The service log is attached to the cluster and subscription known by OCM, not only to the external ID
+	identity, err := o.resolver.Resolve(ctx, r.ClusterID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve cluster %s in OCM: %w", r.ClusterID, err)
+	}
+	sl.ClusterID = identity.InternalID
+	sl.SubscriptionID = identity.SubscriptionID
+	response.ServiceLog = sl
+
+	req := o.ocm.Post()
+	err = arguments.ApplyPathArg(req, "/api/service_logs/v1/cluster_logs")
+	if err != nil {
+		return nil, err
 	}
 	slAsBytes, err := json.Marshal(sl)
 	if err != nil {
-		return err
+		return response, err
 	}
 
 	req.Bytes(slAsBytes)
 
-	res, err := req.Send()
+	res, err := req.SendContext(ctx)
 	if err != nil {
-		return err
+		return response, err
 	}
 
-	operationId := res.Header(HeaderOperationId)
-	err = responseChecker(operationId, res.Status(), res.Bytes())
+	response.OperationID = res.Header(HeaderOperationId)
+	err = responseChecker(response.OperationID, res.Status(), res.Bytes())
 	if err != nil {
-		return err
+		return response, err
 	}
 
-	return nil
+	return response, nil
+}
+
+// HasServiceLog returns whether OCM holds a service log of the cluster with the summary and event stream of the query,
+// created since the time of the query
+func (o *ocmsdkclient) HasServiceLog(ctx context.Context, q ocm.ServiceLogQuery) (bool, error) {
+	req := o.ocm.Get()
+	err := arguments.ApplyPathArg(req, "/api/service_logs/v1/cluster_logs")
+	if err != nil {
+		return false, err
+	}
+	req.Parameter("search", ocm.ServiceLogSearch(q.ClusterID, serviceLogSummary(q.Summary, q.Firing), q.EventStreamID, q.Since))
+	req.Parameter("size", 1)
+
+	res, err := req.SendContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	if res.Status() != http.StatusOK {
+		return false, fmt.Errorf("unable to list the service logs of cluster %s, OCM returned %d", q.ClusterID, res.Status())
+	}
+	var list struct {
+		Total int `json:"total"`
+	}
+	err = json.Unmarshal(res.Bytes(), &list)
+	if err != nil {
+		return false, err
+	}
+	return list.Total > 0, nil
+}
+
+// serviceLogSummary prefixes the summary of a service log according to the firing state of its alert
+func serviceLogSummary(summary string, firing bool) string {
+	if firing {
+		return ServiceLogActivePrefix + ": " + summary
+	}
+	return ServiceLogResolvePrefix + ": " + summary
 }
 
 // responseChecker checks the ocm response returns error or not
@@ -199,7 +497,7 @@ func responseChecker(opId string, statusCode int, asBytes []byte) error {
 		return err
 	}
 
-	log.WithFields(log.Fields{LogFieldPostServiceLogOpId: opId, LogFieldPostServiceLogFailedReason: ocmRes.Reason}).Error("service log sent failed")
+	log.WithFields(logrus.Fields{LogFieldPostServiceLogOpId: opId, LogFieldPostServiceLogFailedReason: ocmRes.Reason}).Error("service log sent failed")
 
 	switch statusCode {
 	case http.StatusBadRequest:
@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/prometheus/alertmanager/template"
 
+	"github.com/openshift/ocm-agent/pkg/audit"
 	testconst "github.com/openshift/ocm-agent/pkg/consts/test"
+	"github.com/openshift/ocm-agent/pkg/ocm"
 )
 
 var _ = Describe("Webhook Handler Helpers", func() {
@@ -64,4 +70,81 @@ var _ = Describe("Webhook Handler Helpers", func() {
 			})
 		})
 	})
+
+	Context("When linking the service logs of an incident", func() {
+		It("Uses the same event stream for the firing and resolved alert", func() {
+			testAlert.Fingerprint = "abc123"
+			resolvedAlert := testAlert
+			resolvedAlert.Status = "resolved"
+			resolvedAlert.EndsAt = testAlert.StartsAt.Add(time.Hour)
+			id := eventStreamID("test-cluster", testconst.TestNotificationName, testAlert)
+			Expect(id).ToNot(BeEmpty())
+			Expect(eventStreamID("test-cluster", testconst.TestNotificationName, resolvedAlert)).To(Equal(id))
+		})
+		It("Uses another event stream when the alert fires again", func() {
+			refiredAlert := testAlert
+			refiredAlert.StartsAt = testAlert.StartsAt.Add(time.Hour)
+			Expect(eventStreamID("test-cluster", testconst.TestNotificationName, refiredAlert)).ToNot(Equal(eventStreamID("test-cluster", testconst.TestNotificationName, testAlert)))
+		})
+		It("Uses another event stream for another cluster", func() {
+			Expect(eventStreamID("other-cluster", testconst.TestNotificationName, testAlert)).ToNot(Equal(eventStreamID("test-cluster", testconst.TestNotificationName, testAlert)))
+		})
+		It("Adds the duration of the incident to the resolved description", func() {
+			testAlert.EndsAt = testAlert.StartsAt.Add(2*time.Hour + 5*time.Minute)
+			Expect(withIncidentDuration("Resolved.", testAlert)).To(Equal("Resolved.\n\nThe issue lasted 2h 5m."))
+		})
+		It("Keeps the description when the alert has not ended", func() {
+			Expect(withIncidentDuration("Resolved.", testAlert)).To(Equal("Resolved."))
+		})
+		It("Formats short incidents", func() {
+			Expect(formatIncidentDuration(20 * time.Second)).To(Equal("less than a minute"))
+			Expect(formatIncidentDuration(45 * time.Minute)).To(Equal("45m"))
+		})
+	})
+
+	Context("When reading the service log options of a notification", func() {
+		It("Returns the options declared for the notification", func() {
+			o := notificationServiceLogOptions(map[string]string{AnnotationServiceLogOptions: `{"test-notification":{"internalOnly":true,"serviceName":"test-service"}}`}, testconst.TestNotificationName)
+			Expect(o).To(Equal(ocm.ServiceLogOptions{InternalOnly: true, ServiceName: "test-service"}))
+		})
+		It("Returns no option for a notification which is not listed", func() {
+			o := notificationServiceLogOptions(map[string]string{AnnotationServiceLogOptions: `{"other":{"internalOnly":true}}`}, testconst.TestNotificationName)
+			Expect(o).To(BeZero())
+		})
+		It("Returns no option for an invalid annotation", func() {
+			o := notificationServiceLogOptions(map[string]string{AnnotationServiceLogOptions: `[`}, testconst.TestNotificationName)
+			Expect(o).To(BeZero())
+		})
+	})
+
+	Context("When sending a service log in dry run", func() {
+		It("Does not look the cluster up in OCM", func() {
+			// Without connection nor resolver, any call to OCM would fail
+			o := NewOcmClient(nil, nil, true)
+			res, err := o.SendServiceLog(context.Background(), ocm.ServiceLogRequest{ClusterID: "test-cluster", Summary: "test", Firing: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.DryRun).To(BeTrue())
+			Expect(res.ServiceLog.ClusterUUID).To(Equal("test-cluster"))
+			Expect(res.ServiceLog.Summary).To(Equal(ServiceLogActivePrefix + ": test"))
+		})
+	})
+
+	Context("When auditing a service log", func() {
+		It("Records a dry run as such", func() {
+			auditBackend := &testAuditBackend{}
+			audit.SetBackends(auditBackend)
+			defer audit.SetBackends()
+			auditServiceLog(nil, testconst.TestNotificationName, "test-cluster", testAlert, true, &ocm.ServiceLogResponse{DryRun: true}, nil)
+			Expect(auditBackend.records).To(HaveLen(1))
+			Expect(auditBackend.records[0].Outcome).To(Equal(audit.OutcomeDryRun))
+		})
+		It("Records a cancelled request as such", func() {
+			auditBackend := &testAuditBackend{}
+			audit.SetBackends(auditBackend)
+			defer audit.SetBackends()
+			auditServiceLog(nil, testconst.TestNotificationName, "test-cluster", testAlert, true, nil, fmt.Errorf("unable to post: %w", context.DeadlineExceeded))
+			Expect(auditBackend.records).To(HaveLen(1))
+			Expect(auditBackend.records[0].Outcome).To(Equal(audit.OutcomeCancelled))
+		})
+	})
 })
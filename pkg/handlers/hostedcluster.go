@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/sirupsen/logrus"
+
+	"github.com/openshift/ocm-agent/pkg/audit"
+	"github.com/openshift/ocm-agent/pkg/metrics"
+	"github.com/openshift/ocm-agent/pkg/ocm"
+)
+
+const (
+	LogFieldManagementClusterID = "management_cluster_id"
+	LogFieldHostedClusterID     = "hosted_cluster_id"
+
+	// Reasons of the unknown cluster metric
+	UnknownClusterReasonNotFound               = "not_found"
+	UnknownClusterReasonWrongManagementCluster = "wrong_management_cluster"
+)
+
+// HostedClusterValidator verifies the clusters identified by the labels of fleet alerts
+//
+//go:generate mockgen -destination=mocks/hostedcluster.go -package=mocks github.com/openshift/ocm-agent/pkg/handlers HostedClusterChecker,HostedClusterValidator
+type HostedClusterValidator interface {
+	// ValidateHostedCluster returns an error wrapping ocm.ErrClusterNotFound or ocm.ErrNotInManagementCluster when
+	// the hosted cluster is unknown to OCM or managed by another management cluster
+	ValidateHostedCluster(ctx context.Context, mcID, hcID string) error
+}
+
+// HostedClusterChecker tells whether the hosted clusters of the fleet notification records still exist
+type HostedClusterChecker interface {
+	// ClusterExists returns false without error only when OCM does not know the cluster
+	ClusterExists(ctx context.Context, id string) (bool, error)
+}
+
+// WithHostedClusterValidator makes the handler verify the hosted cluster of every alert before notifying it
+func (h *WebhookRHOBSReceiverHandler) WithHostedClusterValidator(v HostedClusterValidator) *WebhookRHOBSReceiverHandler {
+	h.validator = v
+	return h
+}
+
+// isKnownCluster returns whether the hosted cluster of the alert exists in OCM and belongs to the management cluster
+// reporting it. Alerts for unknown clusters are counted and audited as such, they are not notified. An error is
+// returned when OCM can't verify the cluster.
+func (h *WebhookRHOBSReceiverHandler) isKnownCluster(ctx context.Context, alert template.Alert, mfn *oav1alpha1.ManagedFleetNotification) (bool, error) {
+	if h.validator == nil {
+		return true, nil
+	}
+	fn := mfn.Spec.FleetNotification
+	mcID := alert.Labels[AMLabelAlertMCID]
+	hcID := alert.Labels[AMLabelAlertHCID]
+	err := h.validator.ValidateHostedCluster(ctx, mcID, hcID)
+	if err == nil {
+		return true, nil
+	}
+
+	fields := logrus.Fields{LogFieldNotificationName: fn.Name, LogFieldManagementClusterID: mcID, LogFieldHostedClusterID: hcID}
+	var reason string
+	switch {
+	case errors.Is(err, ocm.ErrClusterNotFound):
+		reason = UnknownClusterReasonNotFound
+	case errors.Is(err, ocm.ErrNotInManagementCluster):
+		reason = UnknownClusterReasonWrongManagementCluster
+	default:
+		// Sending the notification would most likely fail as well, it is retried when Alertmanager sends the alert again
+		log.WithError(err).WithFields(fields).Error("unable to verify the hosted cluster of the alert")
+		return false, fmt.Errorf("unable to verify hosted cluster %s: %w", hcID, err)
+	}
+	log.WithError(err).WithFields(fields).Warning("not sending a notification for an unknown hosted cluster")
+	metrics.CountUnknownCluster(fn.Name, reason)
+	audit.Write(audit.Record{
+		ClusterID:        hcID,
+		Template:         fn.Name,
+		Summary:          fn.Summary,
+		Firing:           true,
+		AlertFingerprint: alert.Fingerprint,
+		Outcome:          audit.OutcomeUnknownCluster,
+		Error:            err.Error(),
+		Object:           mfn,
+	})
+	return false, nil
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/openshift/ocm-agent/pkg/consts"
+)
+
+// LeaderChecker tells whether the process is the leader of the replicas of OCM Agent
+type LeaderChecker interface {
+	IsLeader() bool
+}
+
+// WithLeaderElection makes the handler reject the alerts with a retryable status unless the process is the leader
+func (h *WebhookReceiverHandler) WithLeaderElection(l LeaderChecker) *WebhookReceiverHandler {
+	h.leader = l
+	return h
+}
+
+// WithLeaderElection makes the handler reject the alerts with a retryable status unless the process is the leader
+func (h *WebhookRHOBSReceiverHandler) WithLeaderElection(l LeaderChecker) *WebhookRHOBSReceiverHandler {
+	h.leader = l
+	return h
+}
+
+// WithLeaderElection makes the process ready only while it is the leader, so the Service only sends alerts to the leader
+func (h *ReadyzHandler) WithLeaderElection(l LeaderChecker) *ReadyzHandler {
+	h.leader = l
+	return h
+}
+
+// isLeader returns whether the process is the leader, which it always is without leader election
+func isLeader(l LeaderChecker) bool {
+	return l == nil || l.IsLeader()
+}
+
+// rejectUnlessLeader answers the request with a retryable error when the process is not the leader, and returns
+// whether it did. Alertmanager retries the alerts, the Service sending them to the leader once it is ready.
+func rejectUnlessLeader(l LeaderChecker, w http.ResponseWriter) bool {
+	if isLeader(l) {
+		return false
+	}
+	log.Debug("Rejecting alerts as not the leader")
+	w.Header().Set("Retry-After", strconv.Itoa(int(consts.NotLeaderRetryAfter.Seconds())))
+	http.Error(w, "Not the leader", http.StatusServiceUnavailable)
+	return true
+}
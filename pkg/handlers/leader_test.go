@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/onsi/gomega/ghttp"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeLeader is a leader election whose outcome is set by the test
+type fakeLeader bool
+
+func (l fakeLeader) IsLeader() bool {
+	return bool(l)
+}
+
+var _ = Describe("Leader election", func() {
+
+	var (
+		server *ghttp.Server
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("When the process is not the leader", func() {
+		It("Is not ready", func() {
+			server.AppendHandlers((&ReadyzHandler{}).WithLeaderElection(fakeLeader(false)).ServeHTTP)
+			resp, err := http.Get(server.URL())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+		})
+
+		It("Rejects the alerts with a retryable status", func() {
+			server.AppendHandlers((&WebhookReceiverHandler{}).WithLeaderElection(fakeLeader(false)).ServeHTTP)
+			resp, err := http.Post(server.URL(), "application/json", bytes.NewBufferString("{}"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+			Expect(resp.Header.Get("Retry-After")).Should(Equal("5"))
+		})
+
+		It("Rejects the fleet alerts with a retryable status", func() {
+			server.AppendHandlers((&WebhookRHOBSReceiverHandler{}).WithLeaderElection(fakeLeader(false)).ServeHTTP)
+			resp, err := http.Post(server.URL(), "application/json", bytes.NewBufferString("{}"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+			Expect(resp.Header.Get("Retry-After")).Should(Equal("5"))
+		})
+	})
+
+	Context("When the process is the leader", func() {
+		It("Is ready", func() {
+			server.AppendHandlers((&ReadyzHandler{}).WithLeaderElection(fakeLeader(true)).ServeHTTP)
+			resp, err := http.Get(server.URL())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusOK))
+		})
+
+		It("Processes the alerts", func() {
+			server.AppendHandlers((&WebhookReceiverHandler{}).WithLeaderElection(fakeLeader(true)).ServeHTTP)
+			resp, err := http.Post(server.URL(), "application/json", bytes.NewBufferString("{"))
+			Expect(err).ShouldNot(HaveOccurred())
+			// the request body is read, not rejected as the process is the leader
+			Expect(resp.StatusCode).Should(Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	sdk "github.com/openshift-online/ocm-sdk-go"
+	cmv1 "github.com/openshift-online/ocm-sdk-go/clustersmgmt/v1"
+	"github.com/sirupsen/logrus"
+
+	"github.com/openshift/ocm-agent/pkg/ocm"
+)
+
+const (
+	// AnnotationLimitedSupport declares the notifications of a template which place the cluster into limited support.
+	// Its value is a JSON object mapping a notification name to the summary and details of the limited support reason.
+	// The limited support follows the alert: it is placed even when the notification is suppressed or the cluster opted
+	// out of it, and removed when the alert resolves whether or not its firing notification was recorded.
+	AnnotationLimitedSupport = "ocmagent.managed.openshift.io/limited-support"
+
+	LogFieldLimitedSupportSummary = "limited_support_summary"
+)
+
+// LimitedSupportClient enables implementation of the OCM limited support reasons client
+//
+//go:generate mockgen -destination=mocks/limitedsupport.go -package=mocks github.com/openshift/ocm-agent/pkg/handlers LimitedSupportClient
+type LimitedSupportClient interface {
+	// PlaceLimitedSupport places the cluster into limited support, unless it already is for the same reason
+	PlaceLimitedSupport(ctx context.Context, clusterID string, reason ocm.LimitedSupportReason) error
+	// RemoveLimitedSupport removes the limited support reasons of the cluster with the same summary
+	RemoveLimitedSupport(ctx context.Context, clusterID string, reason ocm.LimitedSupportReason) error
+}
+
+func NewLimitedSupportClient(conn *sdk.Connection, resolver *ocm.ClusterIDResolver, dryRun bool) LimitedSupportClient {
+	return &ocmsdkclient{
+		ocm:      conn,
+		resolver: resolver,
+		dryRun:   dryRun,
+	}
+}
+
+// notificationLimitedSupportReason returns the limited support reason declared for a notification by the annotations
+// of its template, or nil if the notification doesn't place the cluster into limited support
+func notificationLimitedSupportReason(annotations map[string]string, name string) *ocm.LimitedSupportReason {
+	value, ok := annotations[AnnotationLimitedSupport]
+	if !ok {
+		return nil
+	}
+	var reasonsByNotification map[string]ocm.LimitedSupportReason
+	err := json.Unmarshal([]byte(value), &reasonsByNotification)
+	if err != nil {
+		log.WithError(err).WithField(LogFieldNotificationName, name).Warning("unable to parse the limited support annotation, ignoring it")
+		return nil
+	}
+	reason, ok := reasonsByNotification[name]
+	if !ok {
+		return nil
+	}
+	if reason.Summary == "" {
+		log.WithField(LogFieldNotificationName, name).Warning("limited support reason has no summary, ignoring it")
+		return nil
+	}
+	return &reason
+}
+
+// limitedSupportReasons returns the limited support reasons of the cluster with the given internal ID
+func (o *ocmsdkclient) limitedSupportReasons(ctx context.Context, internalID string) ([]*cmv1.LimitedSupportReason, error) {
+	response, err := o.ocm.ClustersMgmt().V1().Clusters().Cluster(internalID).LimitedSupportReasons().List().SendContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return response.Items().Slice(), nil
+}
+
+// PlaceLimitedSupport posts a limited support reason for the cluster with the given external ID
+func (o *ocmsdkclient) PlaceLimitedSupport(ctx context.Context, clusterID string, reason ocm.LimitedSupportReason) error {
+	identity, err := o.resolver.Resolve(ctx, clusterID)
+	if err != nil {
+		return fmt.Errorf("unable to resolve cluster %s in OCM: %w", clusterID, err)
+	}
+	internalID := identity.InternalID
+	reasons, err := o.limitedSupportReasons(ctx, internalID)
+	if err != nil {
+		return err
+	}
+	for _, r := range reasons {
+		if r.Summary() == reason.Summary {
+			log.WithField(LogFieldLimitedSupportSummary, reason.Summary).Info("cluster is already in limited support for this reason")
+			return nil
+		}
+	}
+	if o.dryRun {
+		log.WithFields(logrus.Fields{LogFieldLimitedSupportSummary: reason.Summary, "details": reason.Details}).Info("dry run, not placing the cluster into limited support")
+		return nil
+	}
+
+	lsr, err := cmv1.NewLimitedSupportReason().
+		Summary(reason.Summary).
+		Details(reason.Details).
+		DetectionType(cmv1.DetectionTypeManual).
+		Build()
+	if err != nil {
+		return err
+	}
+	response, err := o.ocm.ClustersMgmt().V1().Clusters().Cluster(internalID).LimitedSupportReasons().Add().Body(lsr).SendContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to place cluster into limited support: %w", err)
+	}
+	log.WithFields(logrus.Fields{LogFieldLimitedSupportSummary: reason.Summary, "id": response.Body().ID()}).Info("cluster placed into limited support")
+	return nil
+}
+
+// RemoveLimitedSupport deletes the limited support reasons of the cluster with the given external ID and the same summary
+func (o *ocmsdkclient) RemoveLimitedSupport(ctx context.Context, clusterID string, reason ocm.LimitedSupportReason) error {
+	identity, err := o.resolver.Resolve(ctx, clusterID)
+	if err != nil {
+		return fmt.Errorf("unable to resolve cluster %s in OCM: %w", clusterID, err)
+	}
+	internalID := identity.InternalID
+	reasons, err := o.limitedSupportReasons(ctx, internalID)
+	if err != nil {
+		return err
+	}
+	for _, r := range reasons {
+		if r.Summary() != reason.Summary {
+			continue
+		}
+		if o.dryRun {
+			log.WithFields(logrus.Fields{LogFieldLimitedSupportSummary: reason.Summary, "id": r.ID()}).Info("dry run, not removing the limited support reason")
+			continue
+		}
+		_, err = o.ocm.ClustersMgmt().V1().Clusters().Cluster(internalID).LimitedSupportReasons().LimitedSupportReason(r.ID()).Delete().SendContext(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to remove limited support reason %s: %w", r.ID(), err)
+		}
+		log.WithFields(logrus.Fields{LogFieldLimitedSupportSummary: reason.Summary, "id": r.ID()}).Info("limited support reason removed")
+	}
+	return nil
+}
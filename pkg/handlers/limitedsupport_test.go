@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/ocm-agent/pkg/ocm"
+)
+
+var _ = Describe("Limited support", func() {
+	Context("When reading the limited support reason of a notification", func() {
+		It("Returns the reason declared for the notification", func() {
+			annotations := map[string]string{AnnotationLimitedSupport: `{"test-notification":{"summary":"test summary","details":"test details"}}`}
+			Expect(notificationLimitedSupportReason(annotations, "test-notification")).To(Equal(&ocm.LimitedSupportReason{Summary: "test summary", Details: "test details"}))
+		})
+		It("Returns nil without annotation", func() {
+			Expect(notificationLimitedSupportReason(nil, "test-notification")).To(BeNil())
+		})
+		It("Returns nil for a notification which is not listed", func() {
+			annotations := map[string]string{AnnotationLimitedSupport: `{"other-notification":{"summary":"test summary"}}`}
+			Expect(notificationLimitedSupportReason(annotations, "test-notification")).To(BeNil())
+		})
+		It("Returns nil for an invalid annotation", func() {
+			annotations := map[string]string{AnnotationLimitedSupport: `not json`}
+			Expect(notificationLimitedSupportReason(annotations, "test-notification")).To(BeNil())
+		})
+		It("Returns nil for a reason without summary", func() {
+			annotations := map[string]string{AnnotationLimitedSupport: `{"test-notification":{"details":"test details"}}`}
+			Expect(notificationLimitedSupportReason(annotations, "test-notification")).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/openshift/ocm-agent/pkg/consts"
+	"github.com/openshift/ocm-agent/pkg/logging"
+)
+
+type LogLevelHandler struct {
+}
+
+// log level change request
+type LogLevelRequest struct {
+	// Level is any level understood by logrus, e.g. "debug"
+	Level string `json:"level"`
+	// Subsystem limits the change to a single subsystem, all subsystems are changed if empty
+	Subsystem string `json:"subsystem,omitempty"`
+	// TTL is the duration after which the level is reverted, e.g. "15m"
+	TTL string `json:"ttl,omitempty"`
+}
+
+// log level endpoint response
+type LogLevelResponse struct {
+	Levels    map[string]string
+	ExpiresAt *time.Time `json:",omitempty"`
+}
+
+func NewLogLevelHandler() *LogLevelHandler {
+	return &LogLevelHandler{}
+}
+
+func (h *LogLevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response := LogLevelResponse{}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req LogLevelRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+		level, err := logrus.ParseLevel(req.Level)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl := consts.DefaultLogLevelTTL
+		if req.TTL != "" {
+			ttl, err = time.ParseDuration(req.TTL)
+			if err != nil || ttl <= 0 || ttl > consts.MaxLogLevelTTL {
+				http.Error(w, "ttl must be a positive duration of at most "+consts.MaxLogLevelTTL.String(), http.StatusBadRequest)
+				return
+			}
+		}
+		err = logging.SetLevel(req.Subsystem, level, ttl)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		expiresAt := time.Now().Add(ttl)
+		response.ExpiresAt = &expiresAt
+		logging.Subsystem(logging.SubsystemServe).WithFields(logrus.Fields{
+			"subsystem": req.Subsystem,
+			"level":     level.String(),
+			"ttl":       ttl.String(),
+		}).Info("Log level changed at runtime")
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// write response
+	response.Levels = logging.Levels()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Errorf("Failed to write to response: %s\n", err)
+		http.Error(w, "Failed to write to response", http.StatusInternalServerError)
+		return
+	}
+}
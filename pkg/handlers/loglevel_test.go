@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/ocm-agent/pkg/logging"
+)
+
+var _ = Describe("Log level tests", func() {
+
+	const testToken = "test-token"
+
+	var (
+		logLevelHandler http.Handler
+		server          *ghttp.Server
+	)
+
+	doRequest := func(method, token string, body interface{}) (*http.Response, error) {
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, server.URL(), bytes.NewBuffer(data))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return http.DefaultClient.Do(req)
+	}
+
+	BeforeEach(func() {
+		logLevelHandler = RequireAdminToken(testToken, NewLogLevelHandler())
+		server = ghttp.NewServer()
+		server.AppendHandlers(logLevelHandler.ServeHTTP)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		logging.SetBaseLevel(logrus.InfoLevel)
+		_ = logging.SetLevel("", logrus.InfoLevel, 0)
+	})
+
+	Context("Log level handler without a token", func() {
+		It("Rejects the request", func() {
+			resp, err := doRequest(http.MethodGet, "", nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("Log level handler with a wrong token", func() {
+		It("Rejects the request", func() {
+			resp, err := doRequest(http.MethodGet, "wrong-token", nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("Log level handler get", func() {
+		It("Returns the level of every subsystem", func() {
+			resp, err := doRequest(http.MethodGet, testToken, nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusOK))
+			var response LogLevelResponse
+			_ = json.NewDecoder(resp.Body).Decode(&response)
+			Expect(response.Levels).To(HaveLen(len(logging.Subsystems())))
+			Expect(response.ExpiresAt).To(BeNil())
+		})
+	})
+
+	Context("Log level handler put", func() {
+		It("Changes the level of a single subsystem", func() {
+			resp, err := doRequest(http.MethodPut, testToken, LogLevelRequest{Level: "debug", Subsystem: logging.SubsystemOCM, TTL: "1m"})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusOK))
+			var response LogLevelResponse
+			_ = json.NewDecoder(resp.Body).Decode(&response)
+			Expect(response.ExpiresAt).ToNot(BeNil())
+			Expect(response.Levels[logging.SubsystemOCM]).To(Equal("debug"))
+			Expect(response.Levels[logging.SubsystemHandlers]).To(Equal("info"))
+		})
+		It("Reverts the level once the TTL has expired", func() {
+			resp, err := doRequest(http.MethodPut, testToken, LogLevelRequest{Level: "debug", Subsystem: logging.SubsystemOCM, TTL: "10ms"})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusOK))
+			Eventually(func() string {
+				return logging.Levels()[logging.SubsystemOCM]
+			}).Should(Equal("info"))
+		})
+		It("Rejects an unknown subsystem", func() {
+			resp, err := doRequest(http.MethodPut, testToken, LogLevelRequest{Level: "debug", Subsystem: "dummy"})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusBadRequest))
+		})
+		It("Rejects an invalid level", func() {
+			resp, err := doRequest(http.MethodPut, testToken, LogLevelRequest{Level: "loud"})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusBadRequest))
+		})
+		It("Rejects a TTL above the maximum", func() {
+			resp, err := doRequest(http.MethodPut, testToken, LogLevelRequest{Level: "debug", TTL: "48h"})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resp.StatusCode).Should(Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -5,10 +5,11 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
-	v1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	ocm "github.com/openshift/ocm-agent/pkg/ocm"
 )
 
 // MockOCMClient is a mock of OCMClient interface.
@@ -34,16 +35,32 @@ func (m *MockOCMClient) EXPECT() *MockOCMClientMockRecorder {
 	return m.recorder
 }
 
+// HasServiceLog mocks base method.
+func (m *MockOCMClient) HasServiceLog(arg0 context.Context, arg1 ocm.ServiceLogQuery) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HasServiceLog", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HasServiceLog indicates an expected call of HasServiceLog.
+func (mr *MockOCMClientMockRecorder) HasServiceLog(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HasServiceLog", reflect.TypeOf((*MockOCMClient)(nil).HasServiceLog), arg0, arg1)
+}
+
 // SendServiceLog mocks base method.
-func (m *MockOCMClient) SendServiceLog(arg0, arg1, arg2, arg3 string, arg4 v1alpha1.NotificationSeverity, arg5 string, arg6 []v1alpha1.NotificationReferenceType, arg7 bool) error {
+func (m *MockOCMClient) SendServiceLog(arg0 context.Context, arg1 ocm.ServiceLogRequest) (*ocm.ServiceLogResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SendServiceLog", arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "SendServiceLog", arg0, arg1)
+	ret0, _ := ret[0].(*ocm.ServiceLogResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // SendServiceLog indicates an expected call of SendServiceLog.
-func (mr *MockOCMClientMockRecorder) SendServiceLog(arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7 interface{}) *gomock.Call {
+func (mr *MockOCMClientMockRecorder) SendServiceLog(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendServiceLog", reflect.TypeOf((*MockOCMClient)(nil).SendServiceLog), arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendServiceLog", reflect.TypeOf((*MockOCMClient)(nil).SendServiceLog), arg0, arg1)
 }
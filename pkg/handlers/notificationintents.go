@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/ocm-agent/pkg/metrics"
+	"github.com/openshift/ocm-agent/pkg/ocm"
+)
+
+// notificationIntent is a service log about to be posted to the cluster for a notification of a ManagedNotification
+type notificationIntent struct {
+	Notification  string    `json:"notification"`
+	ClusterID     string    `json:"clusterID"`
+	Summary       string    `json:"summary"`
+	Firing        bool      `json:"firing"`
+	EventStreamID string    `json:"eventStreamID,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// WithIdempotentServiceLogs makes the handler record the intent to post a service log on the ManagedNotification
+// before posting it, and look the service log up in OCM instead of posting it again when an intent was left by a
+// failed attempt
+func (h *WebhookReceiverHandler) WithIdempotentServiceLogs() *WebhookReceiverHandler {
+	h.idempotent = true
+	return h
+}
+
+// notificationIntentKey returns the idempotency key of the service log of the notification. It is derived from the
+// notification record the decision to post was made on, so it is the same until the service log is recorded.
+func notificationIntentKey(mn *oav1alpha1.ManagedNotification, name string, firing bool) string {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\x00%t", name, firing)
+	status, err := mn.Status.GetNotificationRecord(name)
+	if err == nil {
+		_, _ = fmt.Fprintf(hash, "\x00%d", status.ServiceLogSentCount)
+		if sent := status.Conditions.GetCondition(oav1alpha1.ConditionServiceLogSent); sent != nil && sent.LastTransitionTime != nil {
+			_, _ = fmt.Fprintf(hash, "\x00%d", sent.LastTransitionTime.Unix())
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// notificationIntents returns the pending service logs of the template by idempotency key
+func notificationIntents(mn *oav1alpha1.ManagedNotification) map[string]notificationIntent {
+	intents := map[string]notificationIntent{}
+	value, ok := mn.Annotations[AnnotationPendingServiceLogs]
+	if !ok {
+		return intents
+	}
+	err := json.Unmarshal([]byte(value), &intents)
+	if err != nil {
+		log.WithError(err).WithField(LogFieldManagedNotification, mn.Name).Warning("unable to parse the pending service logs annotation, ignoring it")
+		return map[string]notificationIntent{}
+	}
+	return intents
+}
+
+// updateNotificationIntents applies the mutation to the pending service logs of the template and updates it. When the
+// update conflicts with another writer, the template is read again and the mutation is applied to its latest version.
+func (h *WebhookReceiverHandler) updateNotificationIntents(ctx context.Context, mn *oav1alpha1.ManagedNotification, mutate func(map[string]notificationIntent)) error {
+	key := client.ObjectKeyFromObject(mn)
+	stale := false
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if stale {
+			*mn = oav1alpha1.ManagedNotification{}
+			if err := h.c.Get(ctx, key, mn); err != nil {
+				return err
+			}
+		}
+		stale = true
+		intents := notificationIntents(mn)
+		mutate(intents)
+		if len(intents) == 0 {
+			delete(mn.Annotations, AnnotationPendingServiceLogs)
+		} else {
+			value, err := json.Marshal(intents)
+			if err != nil {
+				return err
+			}
+			if mn.Annotations == nil {
+				mn.Annotations = map[string]string{}
+			}
+			mn.Annotations[AnnotationPendingServiceLogs] = string(value)
+		}
+		return h.c.Update(ctx, mn)
+	})
+}
+
+// beginServiceLog records the intent to post the service log before it is posted, and returns its idempotency key.
+// When a previous attempt left an intent for the same service log, it is looked up in OCM instead and the creation
+// time of the intent is returned if OCM already holds it, the zero time otherwise. No key is returned when service
+// logs are not idempotent.
+func (h *WebhookReceiverHandler) beginServiceLog(ctx context.Context, mn *oav1alpha1.ManagedNotification, name string, req ocm.ServiceLogRequest) (string, time.Time, error) {
+	if !h.idempotent {
+		return "", time.Time{}, nil
+	}
+	key := notificationIntentKey(mn, name, req.Firing)
+	if intent, ok := notificationIntents(mn)[key]; ok {
+		// A previous attempt failed after posting the service log, or before recording it
+		posted, err := h.intentPosted(ctx, intent)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("unable to verify whether the service log was already posted: %w", err)
+		}
+		if !posted {
+			return key, time.Time{}, nil
+		}
+		log.WithFields(logrus.Fields{LogFieldNotificationName: name, LogFieldIsFiring: req.Firing}).Info("not sending a notification which was already posted to OCM")
+		metrics.CountServiceLogDuplicateSkipped(name)
+		return key, intent.CreatedAt, nil
+	}
+
+	intent := notificationIntent{
+		Notification:  name,
+		ClusterID:     req.ClusterID,
+		Summary:       req.Summary,
+		Firing:        req.Firing,
+		EventStreamID: req.EventStreamID,
+		CreatedAt:     time.Now().UTC().Truncate(time.Second),
+	}
+	err := h.updateNotificationIntents(ctx, mn, func(intents map[string]notificationIntent) {
+		intents[key] = intent
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to record the intent to post the service log: %w", err)
+	}
+	return key, time.Time{}, nil
+}
+
+// endServiceLog removes the intent of a service log once it is recorded in the status of the template. An intent
+// which can't be removed is resolved by the next startup.
+func (h *WebhookReceiverHandler) endServiceLog(ctx context.Context, mn *oav1alpha1.ManagedNotification, key string) {
+	if key == "" {
+		return
+	}
+	err := h.updateNotificationIntents(ctx, mn, func(intents map[string]notificationIntent) {
+		delete(intents, key)
+	})
+	if err != nil {
+		log.WithError(err).WithField(LogFieldManagedNotification, mn.Name).Warning("unable to remove the intent of a recorded service log")
+	}
+}
+
+// intentPosted returns whether OCM holds the service log of the intent
+func (h *WebhookReceiverHandler) intentPosted(ctx context.Context, intent notificationIntent) (bool, error) {
+	return h.ocm.HasServiceLog(ctx, ocm.ServiceLogQuery{
+		ClusterID:     intent.ClusterID,
+		Summary:       intent.Summary,
+		Firing:        intent.Firing,
+		EventStreamID: intent.EventStreamID,
+		Since:         intent.CreatedAt.Add(-intentClockSkew),
+	})
+}
+
+// ReconcileServiceLogIntents resolves the intents left by a previous process. The service logs which OCM holds are
+// recorded in the status of their template if they were not, the others are forgotten and posted by the next alert.
+// Intents which can't be looked up in OCM are kept until the next startup or the next alert.
+func (h *WebhookReceiverHandler) ReconcileServiceLogIntents(ctx context.Context) error {
+	if !h.idempotent || h.ocm == nil {
+		return nil
+	}
+	mnl := &oav1alpha1.ManagedNotificationList{}
+	err := h.c.List(ctx, mnl, client.InNamespace(OCMAgentNamespaceName))
+	if err != nil {
+		return fmt.Errorf("unable to list managed notifications: %w", err)
+	}
+	var errs []error
+	for i := range mnl.Items {
+		mn := &mnl.Items[i]
+		if len(notificationIntents(mn)) == 0 {
+			continue
+		}
+		err := h.reconcileNotificationIntents(ctx, mn)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// reconcileNotificationIntents resolves the intents of a ManagedNotification
+func (h *WebhookReceiverHandler) reconcileNotificationIntents(ctx context.Context, mn *oav1alpha1.ManagedNotification) error {
+	var errs []error
+	resolved := map[string]bool{}
+	for key, intent := range notificationIntents(mn) {
+		fields := logrus.Fields{LogFieldNotificationName: intent.Notification, LogFieldIsFiring: intent.Firing}
+		posted, err := h.intentPosted(ctx, intent)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to look up the service log of intent %s: %w", key, err))
+			continue
+		}
+		if posted {
+			n, err := mn.GetNotificationForName(intent.Notification)
+			if err != nil || n == nil {
+				// The notification was removed from the template, there is nothing to record it on
+				log.WithFields(fields).Info("forgetting the intent of a service log whose notification no longer exists")
+				resolved[key] = true
+				continue
+			}
+			// An alert finding the intent meanwhile may have recorded the service log already
+			m, err := h.recordNotificationStatus(ctx, n, mn, intent.Firing, intent.CreatedAt)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to record the service log of intent %s: %w", key, err))
+				continue
+			}
+			*mn = *m
+			if !intent.Firing {
+				h.endIncidentEventStream(ctx, mn, intent.Notification)
+			}
+			log.WithFields(fields).Info("recorded a service log posted by a previous attempt")
+		} else {
+			log.WithFields(fields).Info("forgetting the intent of a service log which was not posted")
+		}
+		resolved[key] = true
+	}
+	if len(resolved) > 0 {
+		err := h.updateNotificationIntents(ctx, mn, func(intents map[string]notificationIntent) {
+			for key := range resolved {
+				delete(intents, key)
+			}
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// notificationRecordedSince returns whether a service log of the notification was recorded since the given time
+func notificationRecordedSince(mn *oav1alpha1.ManagedNotification, name string, since time.Time) bool {
+	status, err := mn.Status.GetNotificationRecord(name)
+	if err != nil {
+		return false
+	}
+	sent := status.Conditions.GetCondition(oav1alpha1.ConditionServiceLogSent)
+	return sent != nil && sent.LastTransitionTime != nil && !sent.LastTransitionTime.Time.Before(since)
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"github.com/prometheus/alertmanager/template"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	testconst "github.com/openshift/ocm-agent/pkg/consts/test"
+	webhookreceivermock "github.com/openshift/ocm-agent/pkg/handlers/mocks"
+	"github.com/openshift/ocm-agent/pkg/ocm"
+	clientmocks "github.com/openshift/ocm-agent/pkg/util/test/generated/mocks/client"
+)
+
+var _ = Describe("Pending service logs", func() {
+
+	var (
+		mockCtrl         *gomock.Controller
+		mockClient       *clientmocks.MockClient
+		mockStatusWriter *clientmocks.MockStatusWriter
+		mockOCMClient    *webhookreceivermock.MockOCMClient
+		testHandler      *WebhookReceiverHandler
+		testAlert        template.Alert
+		testMNL          *oav1alpha1.ManagedNotificationList
+	)
+
+	// withIntent adds the pending firing service log of the test notification to the template
+	withIntent := func(mn *oav1alpha1.ManagedNotification, createdAt time.Time) {
+		key := notificationIntentKey(mn, testconst.TestNotificationName, true)
+		value, err := json.Marshal(map[string]notificationIntent{key: {
+			Notification:  testconst.TestNotificationName,
+			Summary:       testconst.TestNotification.Summary,
+			Firing:        true,
+			EventStreamID: "test-event-stream",
+			CreatedAt:     createdAt,
+		}})
+		Expect(err).ToNot(HaveOccurred())
+		mn.Annotations[AnnotationPendingServiceLogs] = string(value)
+	}
+
+	// expectIntents expects the template to be updated with the given pending service logs
+	expectIntents := func(keys ...string) *gomock.Call {
+		return mockClient.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, mn *oav1alpha1.ManagedNotification, opts ...client.UpdateOption) error {
+				intents := notificationIntents(mn)
+				Expect(intents).To(HaveLen(len(keys)))
+				for _, key := range keys {
+					Expect(intents).To(HaveKey(key))
+				}
+				return nil
+			})
+	}
+
+	// expectRecorded expects the service log to be recorded in the status of the template
+	expectRecorded := func(count int32) []*gomock.Call {
+		return []*gomock.Call{
+			mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMNL.Items[0]),
+			mockClient.EXPECT().Status().Return(mockStatusWriter),
+			mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, mn *oav1alpha1.ManagedNotification, opts ...client.SubResourceUpdateOption) error {
+					status, err := mn.Status.GetNotificationRecord(testconst.TestNotificationName)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(status.ServiceLogSentCount).To(Equal(count))
+					return nil
+				}),
+		}
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockClient = clientmocks.NewMockClient(mockCtrl)
+		mockStatusWriter = clientmocks.NewMockStatusWriter(mockCtrl)
+		mockOCMClient = webhookreceivermock.NewMockOCMClient(mockCtrl)
+		testHandler = NewWebhookReceiverHandler(mockClient, mockOCMClient).WithIdempotentServiceLogs()
+		testAlert = testconst.NewTestAlert(false, false)
+		// The incident of the alert started with a previous service log
+		testMNL = newResendableManagedNotificationList(map[string]string{AnnotationEventStreams: `{"test-notification":"test-event-stream"}`})
+	})
+
+	It("Derives different keys for the firing and resolved service logs", func() {
+		Expect(notificationIntentKey(&testMNL.Items[0], testconst.TestNotificationName, true)).ToNot(
+			Equal(notificationIntentKey(&testMNL.Items[0], testconst.TestNotificationName, false)))
+	})
+
+	Context("When sending a service log", func() {
+		It("Records the intent until the service log is recorded", func() {
+			key := notificationIntentKey(&testMNL.Items[0], testconst.TestNotificationName, true)
+			calls := []*gomock.Call{
+				expectIntents(key),
+				mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Any()),
+			}
+			calls = append(calls, expectRecorded(1)...)
+			gomock.InOrder(append(calls, expectIntents())...)
+			Expect(testHandler.processAlert(testconst.Context, testAlert, testMNL, true)).To(Succeed())
+		})
+
+		It("Does not send a service log without recording its intent", func() {
+			mockClient.EXPECT().Update(gomock.Any(), gomock.Any()).Return(fmt.Errorf("a fake error"))
+			Expect(testHandler.processAlert(testconst.Context, testAlert, testMNL, true)).ToNot(Succeed())
+		})
+
+		It("Does not send again a service log which OCM holds", func() {
+			withIntent(&testMNL.Items[0], time.Now().Add(-time.Minute))
+			calls := []*gomock.Call{
+				mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, q ocm.ServiceLogQuery) (bool, error) {
+					Expect(q.Summary).To(Equal(testconst.TestNotification.Summary))
+					Expect(q.Firing).To(BeTrue())
+					Expect(q.EventStreamID).To(Equal("test-event-stream"))
+					Expect(q.Since).To(BeTemporally("<", time.Now().Add(-intentClockSkew)))
+					return true, nil
+				}),
+			}
+			calls = append(calls, expectRecorded(1)...)
+			gomock.InOrder(append(calls, expectIntents())...)
+			Expect(testHandler.processAlert(testconst.Context, testAlert, testMNL, true)).To(Succeed())
+		})
+
+		It("Does not record again a service log recorded meanwhile by the resolution of its intent", func() {
+			withIntent(&testMNL.Items[0], time.Now().Add(-time.Minute))
+			recorded := testMNL.Items[0].DeepCopy()
+			status, err := recorded.Status.GetNotificationRecord(testconst.TestNotificationName)
+			Expect(err).ToNot(HaveOccurred())
+			status.ServiceLogSentCount = 1
+			_ = status.SetStatus(oav1alpha1.ConditionServiceLogSent, "Service log sent again after the resend window passed", corev1.ConditionTrue, &metav1.Time{Time: time.Now()})
+			recorded.Status.NotificationRecords.SetNotificationRecord(*status)
+			gomock.InOrder(
+				mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).Return(true, nil),
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, *recorded),
+				expectIntents(),
+			)
+			Expect(testHandler.processAlert(testconst.Context, testAlert, testMNL, true)).To(Succeed())
+		})
+
+		It("Does not send a service log which can't be looked up in OCM", func() {
+			withIntent(&testMNL.Items[0], time.Now().Add(-time.Minute))
+			mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).Return(false, fmt.Errorf("a fake error"))
+			Expect(testHandler.processAlert(testconst.Context, testAlert, testMNL, true)).ToNot(Succeed())
+		})
+	})
+
+	Context("When starting", func() {
+		expectList := func() *gomock.Call {
+			return mockClient.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, list *oav1alpha1.ManagedNotificationList, opts ...client.ListOption) error {
+					list.Items = testMNL.Items
+					return nil
+				})
+		}
+
+		It("Records the service logs posted by the previous process", func() {
+			withIntent(&testMNL.Items[0], time.Now().Add(-time.Minute))
+			calls := []*gomock.Call{
+				expectList(),
+				mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).Return(true, nil),
+			}
+			calls = append(calls, expectRecorded(1)...)
+			gomock.InOrder(append(calls, expectIntents())...)
+			Expect(testHandler.ReconcileServiceLogIntents(context.Background())).To(Succeed())
+		})
+
+		It("Does not record twice a service log which was recorded", func() {
+			withIntent(&testMNL.Items[0], time.Now().Add(-2*time.Hour))
+			gomock.InOrder(
+				expectList(),
+				mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).Return(true, nil),
+				// The status is checked on the latest version of the template, it is not updated
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMNL.Items[0]),
+				expectIntents(),
+			)
+			Expect(testHandler.ReconcileServiceLogIntents(context.Background())).To(Succeed())
+		})
+
+		It("Forgets the service logs which were not posted", func() {
+			withIntent(&testMNL.Items[0], time.Now().Add(-time.Minute))
+			gomock.InOrder(
+				expectList(),
+				mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).Return(false, nil),
+				expectIntents(),
+			)
+			Expect(testHandler.ReconcileServiceLogIntents(context.Background())).To(Succeed())
+		})
+
+		It("Keeps the service logs which can't be looked up in OCM", func() {
+			withIntent(&testMNL.Items[0], time.Now().Add(-time.Minute))
+			gomock.InOrder(
+				expectList(),
+				mockOCMClient.EXPECT().HasServiceLog(gomock.Any(), gomock.Any()).Return(false, fmt.Errorf("a fake error")),
+			)
+			Expect(testHandler.ReconcileServiceLogIntents(context.Background())).ToNot(Succeed())
+		})
+	})
+})
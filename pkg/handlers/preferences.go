@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/ocm-agent/pkg/audit"
+	"github.com/openshift/ocm-agent/pkg/consts"
+	"github.com/openshift/ocm-agent/pkg/metrics"
+)
+
+// Reasons a cluster opted out of a notification, reported by the metrics
+const (
+	OptOutReasonTemplate = "template"
+	OptOutReasonLogType  = "log_type"
+	OptOutReasonSeverity = "severity"
+)
+
+// notificationPreferences are the notifications a cluster opted out of. They are held by a ConfigMap of the
+// namespace of OCM Agent, under the ID of the cluster, the external ID in the traditional mode and the ID of the
+// hosted cluster in fleet mode.
+type notificationPreferences struct {
+	// DisabledTemplates are the names of the notifications the cluster does not receive
+	DisabledTemplates []string `json:"disabledTemplates,omitempty"`
+	// DisabledLogTypes are the log types of the notifications the cluster does not receive
+	DisabledLogTypes []string `json:"disabledLogTypes,omitempty"`
+	// MinimumSeverity is the severity under which the cluster does not receive notifications
+	MinimumSeverity oav1alpha1.NotificationSeverity `json:"minimumSeverity,omitempty"`
+}
+
+// severityRanks orders the severities of service logs, from the least to the most severe
+var severityRanks = map[oav1alpha1.NotificationSeverity]int{
+	oav1alpha1.SeverityDebug:   0,
+	oav1alpha1.SeverityInfo:    1,
+	oav1alpha1.SeverityWarning: 2,
+	oav1alpha1.SeverityError:   3,
+	oav1alpha1.SeverityFatal:   4,
+}
+
+// preferencesReader reads the notification preferences of the clusters from a ConfigMap. The ConfigMap is read for
+// every firing alert, so its content is cached for the TTL. As Alertmanager sends the alerts again while they fire,
+// the opt-out of a cluster from a notification is recorded once per audit interval.
+type preferencesReader struct {
+	configMap     string
+	ttl           time.Duration
+	auditInterval time.Duration
+
+	mutex     sync.Mutex
+	data      map[string]string
+	expiresAt time.Time
+	audited   map[string]time.Time
+}
+
+func newPreferencesReader(configMap string) *preferencesReader {
+	if configMap == "" {
+		return nil
+	}
+	return &preferencesReader{
+		configMap:     configMap,
+		ttl:           consts.NotificationPreferencesCacheTTL,
+		auditInterval: consts.OptOutAuditInterval,
+		audited:       map[string]time.Time{},
+	}
+}
+
+// WithNotificationPreferences makes the handler read the notification preferences of the clusters from the given
+// ConfigMap, the clusters receive every notification when it is empty
+func (h *WebhookReceiverHandler) WithNotificationPreferences(configMap string) *WebhookReceiverHandler {
+	h.preferences = newPreferencesReader(configMap)
+	return h
+}
+
+// WithNotificationPreferences makes the handler read the notification preferences of the hosted clusters from the
+// given ConfigMap, the hosted clusters receive every notification when it is empty
+func (h *WebhookRHOBSReceiverHandler) WithNotificationPreferences(configMap string) *WebhookRHOBSReceiverHandler {
+	h.preferences = newPreferencesReader(configMap)
+	return h
+}
+
+// preferencesData returns the content of the ConfigMap, from the cache when possible. A ConfigMap which does not
+// exist has no content.
+func (r *preferencesReader) preferencesData(ctx context.Context, c client.Client) (map[string]string, error) {
+	r.mutex.Lock()
+	data, expiresAt := r.data, r.expiresAt
+	r.mutex.Unlock()
+	if time.Now().Before(expiresAt) {
+		return data, nil
+	}
+
+	cm := &corev1.ConfigMap{}
+	err := c.Get(ctx, client.ObjectKey{Namespace: OCMAgentNamespaceName, Name: r.configMap}, cm)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("unable to fetch the notification preferences: %w", err)
+	}
+	r.mutex.Lock()
+	r.data, r.expiresAt = cm.Data, time.Now().Add(r.ttl)
+	r.mutex.Unlock()
+	return cm.Data, nil
+}
+
+// clusterPreferences returns the notification preferences of the cluster held by the ConfigMap, nil when the cluster
+// has none. Preferences which can't be parsed are ignored, so the cluster receives every notification.
+func (r *preferencesReader) clusterPreferences(ctx context.Context, c client.Client, clusterID string) (*notificationPreferences, error) {
+	data, err := r.preferencesData(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := data[clusterID]
+	if !ok {
+		return nil, nil
+	}
+	p := &notificationPreferences{}
+	err = yaml.UnmarshalStrict([]byte(value), p)
+	if err != nil {
+		log.WithError(err).WithField(LogFieldClusterID, clusterID).Warning("unable to parse the notification preferences of the cluster, ignoring them")
+		return nil, nil
+	}
+	return p, nil
+}
+
+// shouldAudit returns whether the opt-out of the cluster from the notification for the reason was not recorded within
+// the audit interval, and remembers it is now
+func (r *preferencesReader) shouldAudit(clusterID, name, reason string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := time.Now()
+	key := clusterID + "/" + name + "/" + reason
+	if last, ok := r.audited[key]; ok && now.Sub(last) < r.auditInterval {
+		return false
+	}
+	// Forget the opt-outs which are no longer recent, as the alerts of the clusters stopped firing
+	for k, last := range r.audited {
+		if now.Sub(last) >= r.auditInterval {
+			delete(r.audited, k)
+		}
+	}
+	r.audited[key] = now
+	return true
+}
+
+// optOutReason returns why the preferences disable a notification and a description of it, or an empty reason if
+// they don't. A severity which is not known is never under the minimum severity.
+func (p *notificationPreferences) optOutReason(name, logType string, severity oav1alpha1.NotificationSeverity) (string, string) {
+	for _, t := range p.DisabledTemplates {
+		if t == name {
+			return OptOutReasonTemplate, "the notification is disabled by the preferences of the cluster"
+		}
+	}
+	for _, t := range p.DisabledLogTypes {
+		if logType != "" && t == logType {
+			return OptOutReasonLogType, fmt.Sprintf("the log type %s is disabled by the preferences of the cluster", logType)
+		}
+	}
+	if p.MinimumSeverity != "" {
+		minimum, ok := severityRanks[p.MinimumSeverity]
+		rank, known := severityRanks[severity]
+		if ok && known && rank < minimum {
+			return OptOutReasonSeverity, fmt.Sprintf("the severity %s is under the minimum severity %s of the preferences of the cluster", severity, p.MinimumSeverity)
+		}
+	}
+	return "", ""
+}
+
+// optOutReason returns why the preferences of the cluster disable the notification and a description of it, or an
+// empty reason if they don't or when the handler reads no preferences
+func (r *preferencesReader) optOutReason(ctx context.Context, c client.Client, clusterID, name, logType string, severity oav1alpha1.NotificationSeverity) (string, string, error) {
+	if r == nil {
+		return "", "", nil
+	}
+	p, err := r.clusterPreferences(ctx, c, clusterID)
+	if err != nil || p == nil {
+		return "", "", err
+	}
+	reason, description := p.optOutReason(name, logType, severity)
+	return reason, description, nil
+}
+
+// isOptedOut returns whether the preferences of the cluster disable the notification of a firing alert. The opt-out
+// is recorded to the audit trail once per audit interval, and the notification is left unrecorded so it is sent once
+// the cluster opts in.
+func (r *preferencesReader) isOptedOut(ctx context.Context, c client.Client, obj runtime.Object, clusterID, name, summary, logType string,
+	severity oav1alpha1.NotificationSeverity, alert template.Alert) (bool, error) {
+	reason, description, err := r.optOutReason(ctx, c, clusterID, name, logType, severity)
+	if err != nil || reason == "" {
+		return false, err
+	}
+	log.WithFields(logrus.Fields{LogFieldNotificationName: name, LogFieldClusterID: clusterID, "reason": reason}).Info("not sending a notification the cluster opted out of")
+	metrics.CountNotificationOptedOut(name, reason)
+	if !r.shouldAudit(clusterID, name, reason) {
+		return true, nil
+	}
+	audit.Write(audit.Record{
+		ClusterID:        clusterID,
+		Template:         name,
+		Summary:          summary,
+		Firing:           true,
+		AlertFingerprint: alert.Fingerprint,
+		Outcome:          audit.OutcomeOptedOut,
+		Error:            description,
+		Object:           obj,
+	})
+	return true, nil
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8serrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	ocmagentv1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+
+	"github.com/openshift/ocm-agent/pkg/audit"
+	testconst "github.com/openshift/ocm-agent/pkg/consts/test"
+	clientmocks "github.com/openshift/ocm-agent/pkg/util/test/generated/mocks/client"
+)
+
+var _ = Describe("Notification preferences", func() {
+	var (
+		mockCtrl   *gomock.Controller
+		mockClient *clientmocks.MockClient
+		reader     *preferencesReader
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockClient = clientmocks.NewMockClient(mockCtrl)
+		reader = newPreferencesReader("preferences")
+	})
+
+	preferencesConfigMap := func(data map[string]string) corev1.ConfigMap {
+		return corev1.ConfigMap{Data: data}
+	}
+
+	Context("When reading the preferences of a cluster", func() {
+		It("Reads the preferences held under the ID of the cluster", func() {
+			mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, preferencesConfigMap(map[string]string{
+				"cluster-a": "disabledTemplates: [a]\ndisabledLogTypes: [b]\nminimumSeverity: Warning\n",
+			}))
+			p, err := reader.clusterPreferences(testconst.Context, mockClient, "cluster-a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(Equal(&notificationPreferences{DisabledTemplates: []string{"a"}, DisabledLogTypes: []string{"b"}, MinimumSeverity: ocmagentv1alpha1.SeverityWarning}))
+		})
+		It("Returns no preferences for a cluster which has none", func() {
+			mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, preferencesConfigMap(map[string]string{"cluster-b": "{}"}))
+			p, err := reader.clusterPreferences(testconst.Context, mockClient, "cluster-a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+		It("Returns no preferences without the ConfigMap", func() {
+			mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(k8serrs.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "preferences"))
+			p, err := reader.clusterPreferences(testconst.Context, mockClient, "cluster-a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+		It("Ignores preferences which can't be parsed", func() {
+			mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, preferencesConfigMap(map[string]string{"cluster-a": "disabled: true"}))
+			p, err := reader.clusterPreferences(testconst.Context, mockClient, "cluster-a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+		It("Reports the failure to fetch the ConfigMap", func() {
+			mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("a fake error"))
+			_, err := reader.clusterPreferences(testconst.Context, mockClient, "cluster-a")
+			Expect(err).To(HaveOccurred())
+		})
+		It("Caches the ConfigMap", func() {
+			mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, preferencesConfigMap(map[string]string{"cluster-a": "disabledTemplates: [a]"})).Times(1)
+			for i := 0; i < 2; i++ {
+				p, err := reader.clusterPreferences(testconst.Context, mockClient, "cluster-a")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.DisabledTemplates).To(Equal([]string{"a"}))
+			}
+		})
+		It("Reads the ConfigMap again once the TTL has expired", func() {
+			reader.ttl = 0
+			mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, preferencesConfigMap(map[string]string{})).Times(2)
+			_, _ = reader.clusterPreferences(testconst.Context, mockClient, "cluster-a")
+			_, _ = reader.clusterPreferences(testconst.Context, mockClient, "cluster-a")
+		})
+		It("Does not cache the failure to fetch the ConfigMap", func() {
+			gomock.InOrder(
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("a fake error")),
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, preferencesConfigMap(map[string]string{"cluster-a": "disabledTemplates: [a]"})),
+			)
+			_, err := reader.clusterPreferences(testconst.Context, mockClient, "cluster-a")
+			Expect(err).To(HaveOccurred())
+			p, err := reader.clusterPreferences(testconst.Context, mockClient, "cluster-a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).ToNot(BeNil())
+		})
+	})
+
+	Context("When checking whether a cluster opted out of a notification", func() {
+		var p *notificationPreferences
+
+		BeforeEach(func() {
+			p = &notificationPreferences{
+				DisabledTemplates: []string{"disabled-notification"},
+				DisabledLogTypes:  []string{"cluster-networking"},
+				MinimumSeverity:   ocmagentv1alpha1.SeverityWarning,
+			}
+		})
+
+		It("Disables the notifications of a disabled template", func() {
+			reason, _ := p.optOutReason("disabled-notification", "", ocmagentv1alpha1.SeverityFatal)
+			Expect(reason).To(Equal(OptOutReasonTemplate))
+		})
+		It("Disables the notifications of a disabled log type", func() {
+			reason, _ := p.optOutReason("notification", "cluster-networking", ocmagentv1alpha1.SeverityFatal)
+			Expect(reason).To(Equal(OptOutReasonLogType))
+		})
+		It("Disables the notifications under the minimum severity", func() {
+			reason, _ := p.optOutReason("notification", "", ocmagentv1alpha1.SeverityInfo)
+			Expect(reason).To(Equal(OptOutReasonSeverity))
+		})
+		It("Keeps the other notifications", func() {
+			for _, severity := range []ocmagentv1alpha1.NotificationSeverity{ocmagentv1alpha1.SeverityWarning, ocmagentv1alpha1.SeverityError, "Unknown"} {
+				reason, _ := p.optOutReason("notification", "cluster-upgrade", severity)
+				Expect(reason).To(BeEmpty())
+			}
+		})
+		It("Never disables a notification without a ConfigMap", func() {
+			reader = newPreferencesReader("")
+			optedOut, err := reader.isOptedOut(testconst.Context, mockClient, nil, "cluster-a", "disabled-notification", "", "", ocmagentv1alpha1.SeverityInfo, testconst.NewTestAlert(false, false))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(optedOut).To(BeFalse())
+		})
+		It("Records the opt-out of a cluster once per audit interval", func() {
+			mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, preferencesConfigMap(map[string]string{
+				"cluster-a": "disabledTemplates: [disabled-notification]",
+				"cluster-b": "disabledTemplates: [disabled-notification]",
+			}))
+			auditBackend := &testAuditBackend{}
+			audit.SetBackends(auditBackend)
+			defer audit.SetBackends()
+			for _, clusterID := range []string{"cluster-a", "cluster-a", "cluster-b"} {
+				optedOut, err := reader.isOptedOut(testconst.Context, mockClient, nil, clusterID, "disabled-notification", "", "", ocmagentv1alpha1.SeverityInfo, testconst.NewTestAlert(false, false))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(optedOut).To(BeTrue())
+			}
+			Expect(auditBackend.records).To(HaveLen(2))
+			Expect(auditBackend.records[0].ClusterID).To(Equal("cluster-a"))
+			Expect(auditBackend.records[1].ClusterID).To(Equal("cluster-b"))
+		})
+	})
+})
@@ -3,11 +3,10 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
-
-	log "github.com/sirupsen/logrus"
 )
 
 type ReadyzHandler struct {
+	leader LeaderChecker
 }
 
 // ready probe endpoint response
@@ -26,6 +25,11 @@ func (h *ReadyzHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	// only the leader is ready when leader election is enabled
+	if !isLeader(h.leader) {
+		http.Error(w, "Not the leader", http.StatusServiceUnavailable)
+		return
+	}
 	var err error
 	// write response
 	w.Header().Set("Content-Type", "application/json")
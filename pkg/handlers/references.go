@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/sirupsen/logrus"
+)
+
+// ReferenceGeneratorURL names the generator URL of an alert in the list of annotations promoted to references
+const ReferenceGeneratorURL = "generatorURL"
+
+// alertReferences promotes links of the alerts to the doc references of their service logs. Its zero value promotes
+// none, the service logs only referencing the links of their notification.
+type alertReferences struct {
+	// annotations are the names of the alert annotations holding the links, in the order they are referenced
+	annotations []string
+	// allowedHosts are the hosts the links can point to, e.g. docs.openshift.com or *.openshift.com
+	allowedHosts []string
+}
+
+// WithAlertReferences makes the handler reference the links held by the given annotations of the alerts in their
+// service logs, when they point to one of the allowed hosts
+func (h *WebhookReceiverHandler) WithAlertReferences(annotations, allowedHosts []string) *WebhookReceiverHandler {
+	h.references = alertReferences{annotations: annotations, allowedHosts: allowedHosts}
+	return h
+}
+
+// WithAlertReferences makes the handler reference the links held by the given annotations of the alerts in their
+// service logs, when they point to one of the allowed hosts
+func (h *WebhookRHOBSReceiverHandler) WithAlertReferences(annotations, allowedHosts []string) *WebhookRHOBSReceiverHandler {
+	h.references = alertReferences{annotations: annotations, allowedHosts: allowedHosts}
+	return h
+}
+
+// merge returns the references of the notification followed by the allowed links of the alert, each link being
+// referenced once
+func (r alertReferences) merge(references []oav1alpha1.NotificationReferenceType, alert template.Alert) []oav1alpha1.NotificationReferenceType {
+	if len(r.annotations) == 0 || len(r.allowedHosts) == 0 {
+		return references
+	}
+	merged := make([]oav1alpha1.NotificationReferenceType, 0, len(references)+len(r.annotations))
+	seen := map[string]bool{}
+	add := func(link string) {
+		key := normalizeReference(link)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		merged = append(merged, oav1alpha1.NotificationReferenceType(link))
+	}
+	for _, ref := range references {
+		add(string(ref))
+	}
+	for _, name := range r.annotations {
+		link := alert.Annotations[name]
+		if name == ReferenceGeneratorURL {
+			link = alert.GeneratorURL
+		}
+		if link == "" {
+			continue
+		}
+		if !r.allowed(link) {
+			// Links to internal hosts must never reach the customer
+			log.WithFields(logrus.Fields{LogFieldAlertname: alert.Labels[AMLabelAlertName], "annotation": name}).Debug("not referencing a link to a host which is not allowed")
+			continue
+		}
+		add(link)
+	}
+	return merged
+}
+
+// allowed returns whether the link is an absolute http(s) URL to one of the allowed hosts
+func (r alertReferences) allowed(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Hostname() == "" || u.User != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range r.allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed {
+			return true
+		}
+		if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeReference returns the form of a link two references are compared by, ignoring the case of its scheme
+// and host and a trailing slash
+func normalizeReference(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return u.String()
+}
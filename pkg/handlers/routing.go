@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/openshift/ocm-agent/pkg/metrics"
+)
+
+const (
+	// AnnotationMatchers declares the alerts routed to the notifications of a template without naming it in their
+	// managed_notification_template label. Its value is a JSON object mapping a notification name to a list of
+	// Alertmanager label matchers, e.g. ["alertname=\"KubePersistentVolumeFillingUp\"", "namespace=~\"openshift-.*\""].
+	// An alert is routed to a notification when it matches all of its matchers.
+	AnnotationMatchers = "ocmagent.managed.openshift.io/matchers"
+
+	// EventReasonAmbiguousAlert is recorded on the templates of the notifications an alert matches when it matches
+	// more than one
+	EventReasonAmbiguousAlert = "AmbiguousAlert"
+)
+
+// ambiguousAlertError is returned when an alert matches the matchers of several notifications
+type ambiguousAlertError struct {
+	notifications []string
+}
+
+func (e *ambiguousAlertError) Error() string {
+	return fmt.Sprintf("alert matches the matchers of several notifications: %s", strings.Join(e.notifications, ", "))
+}
+
+// notificationMatchers returns the label matchers declared for the notifications of a template by its annotations.
+// The notifications whose matchers can't be parsed are left out, so they are only routed to by name.
+func notificationMatchers(annotations map[string]string) map[string]labels.Matchers {
+	value, ok := annotations[AnnotationMatchers]
+	if !ok {
+		return nil
+	}
+	var matchersByNotification map[string][]string
+	err := json.Unmarshal([]byte(value), &matchersByNotification)
+	if err != nil {
+		log.WithError(err).Warning("unable to parse the matchers annotation, ignoring it")
+		return nil
+	}
+	parsed := make(map[string]labels.Matchers, len(matchersByNotification))
+	for name, values := range matchersByNotification {
+		if len(values) == 0 {
+			// A notification without matchers would match every alert
+			log.WithField(LogFieldNotificationName, name).Warning("notification declares no matchers, ignoring it")
+			continue
+		}
+		matchers := make(labels.Matchers, 0, len(values))
+		for _, v := range values {
+			m, err := labels.ParseMatcher(v)
+			if err != nil {
+				log.WithError(err).WithField(LogFieldNotificationName, name).Warning("unable to parse a matcher of the notification, ignoring its matchers")
+				matchers = nil
+				break
+			}
+			matchers = append(matchers, m)
+		}
+		if matchers != nil {
+			parsed[name] = matchers
+		}
+	}
+	return parsed
+}
+
+// matchNotification returns the notification whose matchers the alert matches, and the ManagedNotification holding
+// it. An *ambiguousAlertError is returned when the alert matches several notifications.
+func matchNotification(alert template.Alert, mnl *oav1alpha1.ManagedNotificationList) (*oav1alpha1.Notification, *oav1alpha1.ManagedNotification, error) {
+	lset := make(model.LabelSet, len(alert.Labels))
+	for k, v := range alert.Labels {
+		lset[model.LabelName(k)] = model.LabelValue(v)
+	}
+
+	var notification *oav1alpha1.Notification
+	var managedNotification *oav1alpha1.ManagedNotification
+	var matched []string
+	for i := range mnl.Items {
+		mn := &mnl.Items[i]
+		for name, matchers := range notificationMatchers(mn.Annotations) {
+			if !matchers.Matches(lset) {
+				continue
+			}
+			n, err := mn.GetNotificationForName(name)
+			if err != nil || n == nil {
+				log.WithField(LogFieldNotificationName, name).Warning("matchers are declared for a notification which does not exist in " + mn.Name)
+				continue
+			}
+			notification, managedNotification = n, mn
+			matched = append(matched, name)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil, nil, fmt.Errorf("alert matches the matchers of no notification")
+	case 1:
+		return notification, managedNotification, nil
+	default:
+		sort.Strings(matched)
+		return nil, nil, &ambiguousAlertError{notifications: matched}
+	}
+}
+
+// alertJobKey returns the name of the notification of the alert, so the alerts sharing its record are processed one
+// after the other. The alerts routed by matchers are keyed by the notification they match, or by their alertname when
+// they match none or several as they are not notified.
+func alertJobKey(alert template.Alert, mnl *oav1alpha1.ManagedNotificationList) string {
+	if name, ok := alert.Labels[AMLabelTemplateName]; ok {
+		return name
+	}
+	if alert.Labels[AMLabelManagedNotification] != "false" {
+		if notification, _, err := matchNotification(alert, mnl); err == nil {
+			return notification.Name
+		}
+	}
+	return alert.Labels[AMLabelAlertName]
+}
+
+// alertNotification returns the notification of the alert and the ManagedNotification holding it. Alerts naming
+// their notification with the managed_notification_template label are routed to it, the others to the notification
+// whose matchers they match, unless they opt out with the send_managed_notification label set to false.
+func (h *WebhookReceiverHandler) alertNotification(alert template.Alert, mnl *oav1alpha1.ManagedNotificationList) (*oav1alpha1.Notification, *oav1alpha1.ManagedNotification, error) {
+	_, named := alert.Labels[AMLabelTemplateName]
+	if !named && alert.Labels[AMLabelManagedNotification] != "false" {
+		if name, err := alertName(alert); err == nil {
+			notification, mn, err := matchNotification(alert, mnl)
+			if err == nil {
+				log.WithFields(logrus.Fields{LogFieldAlertname: *name, LogFieldNotificationName: notification.Name}).Debug("alert routed to notification by its matchers")
+				return notification, mn, nil
+			}
+			if ambiguous, ok := err.(*ambiguousAlertError); ok {
+				log.WithError(err).WithField(LogFieldAlertname, *name).Error("not sending a notification for an alert matching several notifications")
+				metrics.CountAmbiguousAlert(*name)
+				for _, n := range ambiguous.notifications {
+					if _, mn, err := getNotification(n, mnl); err == nil {
+						recordEvent(h.recorder, mn, corev1.EventTypeWarning, EventReasonAmbiguousAlert,
+							"alert %s matches the matchers of several notifications: %s", *name, strings.Join(ambiguous.notifications, ", "))
+					}
+				}
+				return nil, nil, err
+			}
+			// Alerts matching no notification are rejected like any alert which does not name its notification
+		}
+	}
+
+	// Should this alert be handled?
+	if !isValidAlert(alert, false) {
+		log.WithField(LogFieldAlert, fmt.Sprintf("%+v", alert)).Info("alert does not meet valid criteria")
+		// The alert can only be reported on a ManagedNotification if it names an existing template
+		if _, mn, err := getNotification(alert.Labels[AMLabelTemplateName], mnl); err == nil {
+			recordEvent(h.recorder, mn, corev1.EventTypeWarning, EventReasonInvalidAlert, "alert %s does not meet valid criteria", alert.Labels[AMLabelAlertName])
+		}
+		return nil, nil, fmt.Errorf("alert does not meet valid criteria")
+	}
+
+	// Can the alert be mapped to an existing notification definition?
+	notification, managedNotifications, err := getNotification(alert.Labels[AMLabelTemplateName], mnl)
+	if err != nil {
+		log.WithError(err).WithField(LogFieldAlert, fmt.Sprintf("%+v", alert)).Warning("an alert fired with no associated notification template definition")
+		metrics.CountTemplateNotFound(alert.Labels[AMLabelTemplateName])
+		return nil, nil, err
+	}
+	return notification, managedNotifications, nil
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/alertmanager/template"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	ocmagentv1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+
+	testconst "github.com/openshift/ocm-agent/pkg/consts/test"
+)
+
+// newMatchedManagedNotification returns a ManagedNotification holding the test notification under the given name,
+// routed to by the given matchers annotation
+func newMatchedManagedNotification(name, matchers string) ocmagentv1alpha1.ManagedNotification {
+	notification := testconst.TestNotification
+	notification.Name = name
+	return ocmagentv1alpha1.ManagedNotification{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{AnnotationMatchers: matchers},
+		},
+		Spec: ocmagentv1alpha1.ManagedNotificationSpec{
+			Notifications: []ocmagentv1alpha1.Notification{notification},
+		},
+	}
+}
+
+var _ = Describe("Alert routing", func() {
+	var (
+		webhookReceiverHandler *WebhookReceiverHandler
+		testAlert              template.Alert
+		mnl                    *ocmagentv1alpha1.ManagedNotificationList
+	)
+
+	BeforeEach(func() {
+		webhookReceiverHandler = &WebhookReceiverHandler{}
+		testAlert = template.Alert{
+			Labels: map[string]string{
+				"alertname": "KubePersistentVolumeFillingUp",
+				"namespace": "openshift-monitoring",
+			},
+		}
+		mnl = &ocmagentv1alpha1.ManagedNotificationList{
+			Items: []ocmagentv1alpha1.ManagedNotification{
+				newMatchedManagedNotification("volume-filling-up", `{"volume-filling-up": ["alertname=\"KubePersistentVolumeFillingUp\"", "namespace=~\"openshift-.*\""]}`),
+			},
+		}
+	})
+
+	Context("When parsing the matchers of a template", func() {
+		It("Parses the matchers of each notification", func() {
+			matchers := notificationMatchers(map[string]string{AnnotationMatchers: `{"a": ["alertname=\"A\""], "b": ["severity!=\"info\"", "namespace=~\"openshift-.*\""]}`})
+			Expect(matchers).To(HaveLen(2))
+			Expect(matchers["a"]).To(HaveLen(1))
+			Expect(matchers["b"]).To(HaveLen(2))
+		})
+		It("Ignores a template without the annotation", func() {
+			Expect(notificationMatchers(map[string]string{})).To(BeEmpty())
+		})
+		It("Ignores an annotation which is not valid JSON", func() {
+			Expect(notificationMatchers(map[string]string{AnnotationMatchers: `["alertname=\"A\""]`})).To(BeEmpty())
+		})
+		It("Ignores the notifications with an invalid matcher or without matchers", func() {
+			matchers := notificationMatchers(map[string]string{AnnotationMatchers: `{"a": ["alertname=\"A\""], "b": ["alertname=\"B\"", "not a matcher"], "c": []}`})
+			Expect(matchers).To(HaveLen(1))
+			Expect(matchers).To(HaveKey("a"))
+		})
+	})
+
+	Context("When an alert does not name its notification", func() {
+		It("Routes the alert to the notification whose matchers it matches", func() {
+			notification, mn, err := webhookReceiverHandler.alertNotification(testAlert, mnl)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(notification.Name).To(Equal("volume-filling-up"))
+			Expect(mn.Name).To(Equal("volume-filling-up"))
+		})
+		It("Does not route the alert when a regex matcher does not match", func() {
+			testAlert.Labels["namespace"] = "my-app"
+			_, _, err := webhookReceiverHandler.alertNotification(testAlert, mnl)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Does not route the alert when a negative matcher does not match", func() {
+			mnl.Items[0].Annotations[AnnotationMatchers] = `{"volume-filling-up": ["alertname=\"KubePersistentVolumeFillingUp\"", "severity!=\"info\""]}`
+			testAlert.Labels["severity"] = "info"
+			_, _, err := webhookReceiverHandler.alertNotification(testAlert, mnl)
+			Expect(err).To(HaveOccurred())
+			testAlert.Labels["severity"] = "warning"
+			notification, _, err := webhookReceiverHandler.alertNotification(testAlert, mnl)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(notification.Name).To(Equal("volume-filling-up"))
+		})
+		It("Does not route an alert opting out of notifications", func() {
+			testAlert.Labels[AMLabelManagedNotification] = "false"
+			_, _, err := webhookReceiverHandler.alertNotification(testAlert, mnl)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Ignores matchers declared for a notification which does not exist", func() {
+			mnl.Items[0].Annotations[AnnotationMatchers] = `{"missing": ["alertname=\"KubePersistentVolumeFillingUp\""]}`
+			_, _, err := webhookReceiverHandler.alertNotification(testAlert, mnl)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When an alert names its notification", func() {
+		It("Routes the alert to the notification it names rather than by matchers", func() {
+			mnl.Items = append(mnl.Items, testconst.TestManagedNotification)
+			testAlert.Labels[AMLabelTemplateName] = testconst.TestNotificationName
+			testAlert.Labels[AMLabelManagedNotification] = "true"
+			notification, _, err := webhookReceiverHandler.alertNotification(testAlert, mnl)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(notification.Name).To(Equal(testconst.TestNotificationName))
+		})
+	})
+
+	Context("When grouping the alerts of a request", func() {
+		It("Keys an alert routed by matchers by the notification it matches", func() {
+			Expect(alertJobKey(testAlert, mnl)).To(Equal("volume-filling-up"))
+		})
+		It("Keys an alert naming its notification by its name", func() {
+			testAlert.Labels[AMLabelTemplateName] = testconst.TestNotificationName
+			Expect(alertJobKey(testAlert, mnl)).To(Equal(testconst.TestNotificationName))
+		})
+		It("Keys an alert matching no notification by its alertname", func() {
+			testAlert.Labels["namespace"] = "my-app"
+			Expect(alertJobKey(testAlert, mnl)).To(Equal("KubePersistentVolumeFillingUp"))
+		})
+	})
+
+	Context("When an alert matches the matchers of several notifications", func() {
+		BeforeEach(func() {
+			mnl.Items = append(mnl.Items, newMatchedManagedNotification("openshift-alerts", `{"openshift-alerts": ["namespace=~\"openshift-.*\""]}`))
+		})
+		It("Sends no notification and records an event on each template", func() {
+			recorder := record.NewFakeRecorder(2)
+			webhookReceiverHandler.WithEventRecorder(recorder)
+			_, _, err := webhookReceiverHandler.alertNotification(testAlert, mnl)
+			Expect(err).To(BeAssignableToTypeOf(&ambiguousAlertError{}))
+			Expect(err.(*ambiguousAlertError).notifications).To(Equal([]string{"openshift-alerts", "volume-filling-up"}))
+			Expect(<-recorder.Events).To(HavePrefix("Warning " + EventReasonAmbiguousAlert))
+			Expect(<-recorder.Events).To(HavePrefix("Warning " + EventReasonAmbiguousAlert))
+		})
+	})
+})
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AMLabelSeverity is the label of the severity of an alert, e.g. warning or critical
+	AMLabelSeverity = "severity"
+
+	// AnnotationSeverity derives the severity of the service logs of a template from the alerts. Its value is a JSON
+	// object mapping a notification name to its options, e.g.
+	// {"mapping": {"critical": "Error"}, "escalation": {"afterResends": 3, "severity": "Fatal"}}.
+	AnnotationSeverity = "ocmagent.managed.openshift.io/severity"
+)
+
+// severityOptions derive the severity of the service logs of a notification from its alert
+type severityOptions struct {
+	// Mapping maps the severity label of an alert to the severity of its service logs, it takes precedence over the
+	// mapping of the handler
+	Mapping map[string]oav1alpha1.NotificationSeverity `json:"mapping,omitempty"`
+	// Escalation raises the severity of the service logs of an alert which keeps firing
+	Escalation *severityEscalation `json:"escalation,omitempty"`
+}
+
+// severityEscalation raises the severity of the service logs sent again for an alert once it fired for the given
+// number of resend intervals
+type severityEscalation struct {
+	AfterResends int                             `json:"afterResends"`
+	Severity     oav1alpha1.NotificationSeverity `json:"severity"`
+}
+
+// WithSeverityMapping maps the severity label of the alerts to the severity of their service logs, the severity of
+// the notification being used for the alerts whose severity is not mapped
+func (h *WebhookReceiverHandler) WithSeverityMapping(m map[string]string) *WebhookReceiverHandler {
+	h.severities = severityMapping(m)
+	return h
+}
+
+// WithSeverityMapping maps the severity label of the alerts to the severity of their service logs, the severity of
+// the notification being used for the alerts whose severity is not mapped
+func (h *WebhookRHOBSReceiverHandler) WithSeverityMapping(m map[string]string) *WebhookRHOBSReceiverHandler {
+	h.severities = severityMapping(m)
+	return h
+}
+
+// severityMapping returns the mapping of alert severities to service log severities
+func severityMapping(m map[string]string) map[string]oav1alpha1.NotificationSeverity {
+	severities := make(map[string]oav1alpha1.NotificationSeverity, len(m))
+	for label, severity := range m {
+		severities[label] = oav1alpha1.NotificationSeverity(severity)
+	}
+	return severities
+}
+
+// IsValidSeverity returns whether the severity is one of the severities of service logs
+func IsValidSeverity(severity string) bool {
+	_, ok := severityRanks[oav1alpha1.NotificationSeverity(severity)]
+	return ok
+}
+
+// notificationSeverityOptions returns the severity options set for a notification by the annotations of its template.
+// The mappings and escalation to a severity which is not one of the severities of service logs are left out.
+func notificationSeverityOptions(annotations map[string]string, name string) severityOptions {
+	value, ok := annotations[AnnotationSeverity]
+	if !ok {
+		return severityOptions{}
+	}
+	var optionsByNotification map[string]severityOptions
+	err := json.Unmarshal([]byte(value), &optionsByNotification)
+	if err != nil {
+		log.WithError(err).WithField(LogFieldNotificationName, name).Warning("unable to parse the severity annotation, ignoring it")
+		return severityOptions{}
+	}
+	options := optionsByNotification[name]
+	for label, severity := range options.Mapping {
+		if !IsValidSeverity(string(severity)) {
+			log.WithFields(logrus.Fields{LogFieldNotificationName: name, AMLabelSeverity: label}).Warningf("unknown service log severity %q in the severity annotation, ignoring it", severity)
+			delete(options.Mapping, label)
+		}
+	}
+	if options.Escalation != nil && !IsValidSeverity(string(options.Escalation.Severity)) {
+		log.WithField(LogFieldNotificationName, name).Warningf("unknown service log severity %q in the escalation of the severity annotation, ignoring it", options.Escalation.Severity)
+		options.Escalation = nil
+	}
+	return options
+}
+
+// alertSeverity returns the severity of the service log sent for the alert. The severity label of the alert is
+// mapped by the annotations of the template, then by the mapping of the handler, falling back to the severity of the
+// notification. A firing alert is escalated once its record counts as many service logs sent as its escalation
+// requires.
+func alertSeverity(mapping map[string]oav1alpha1.NotificationSeverity, annotations map[string]string, name string,
+	severity oav1alpha1.NotificationSeverity, sent int, alert template.Alert, firing bool) oav1alpha1.NotificationSeverity {
+	options := notificationSeverityOptions(annotations, name)
+	if label, ok := alert.Labels[AMLabelSeverity]; ok {
+		if s, ok := options.Mapping[label]; ok && s != "" {
+			severity = s
+		} else if s, ok := mapping[label]; ok && s != "" {
+			severity = s
+		}
+	}
+
+	e := options.Escalation
+	if !firing || e == nil || e.AfterResends < 1 || sent < e.AfterResends {
+		return severity
+	}
+	log.WithFields(logrus.Fields{LogFieldNotificationName: name, LogFieldAlertname: alert.Labels[AMLabelAlertName]}).
+		Info("escalating the severity of the notification of an alert which keeps firing")
+	return e.Severity
+}
+
+// firingServiceLogCount returns the number of service logs the record of a notification counts while its alert is
+// firing, none once it resolved as the next firing alert starts a new incident
+func firingServiceLogCount(mn *oav1alpha1.ManagedNotification, name string) int {
+	if !isFiringRecorded(mn, name) {
+		return 0
+	}
+	status, _ := mn.Status.GetNotificationRecord(name)
+	return int(status.ServiceLogSentCount)
+}
+
+// isFiringRecorded returns whether the record of a notification tells its alert is firing
+func isFiringRecorded(mn *oav1alpha1.ManagedNotification, name string) bool {
+	status, err := mn.Status.GetNotificationRecord(name)
+	if err != nil || status == nil {
+		return false
+	}
+	firing := status.Conditions.GetCondition(oav1alpha1.ConditionAlertFiring)
+	return firing != nil && firing.Status == corev1.ConditionTrue
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/alertmanager/template"
+	corev1 "k8s.io/api/core/v1"
+
+	ocmagentv1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+
+	testconst "github.com/openshift/ocm-agent/pkg/consts/test"
+)
+
+var _ = Describe("Service log severity", func() {
+	var (
+		testAlert   template.Alert
+		mapping     map[string]ocmagentv1alpha1.NotificationSeverity
+		annotations map[string]string
+	)
+
+	BeforeEach(func() {
+		testAlert = template.Alert{
+			Labels:   map[string]string{"alertname": "TestAlert", "severity": "critical"},
+			StartsAt: time.Now().Add(-time.Hour),
+		}
+		mapping = severityMapping(map[string]string{"warning": "Warning", "critical": "Error"})
+		annotations = map[string]string{}
+	})
+
+	Context("When mapping the severity of an alert", func() {
+		It("Uses the severity of the notification without mapping", func() {
+			Expect(alertSeverity(nil, annotations, "test", ocmagentv1alpha1.SeverityInfo, 0, testAlert, true)).To(Equal(ocmagentv1alpha1.SeverityInfo))
+		})
+		It("Maps the severity label of the alert", func() {
+			Expect(alertSeverity(mapping, annotations, "test", ocmagentv1alpha1.SeverityInfo, 0, testAlert, true)).To(Equal(ocmagentv1alpha1.SeverityError))
+		})
+		It("Uses the severity of the notification for an alert whose severity is not mapped", func() {
+			testAlert.Labels["severity"] = "none"
+			Expect(alertSeverity(mapping, annotations, "test", ocmagentv1alpha1.SeverityInfo, 0, testAlert, true)).To(Equal(ocmagentv1alpha1.SeverityInfo))
+		})
+		It("Prefers the mapping of the notification", func() {
+			annotations[AnnotationSeverity] = `{"test": {"mapping": {"critical": "Fatal"}}}`
+			Expect(alertSeverity(mapping, annotations, "test", ocmagentv1alpha1.SeverityInfo, 0, testAlert, true)).To(Equal(ocmagentv1alpha1.SeverityFatal))
+			Expect(alertSeverity(mapping, annotations, "other", ocmagentv1alpha1.SeverityInfo, 0, testAlert, true)).To(Equal(ocmagentv1alpha1.SeverityError))
+		})
+		It("Ignores an invalid annotation", func() {
+			annotations[AnnotationSeverity] = `{"test": "Fatal"}`
+			Expect(alertSeverity(mapping, annotations, "test", ocmagentv1alpha1.SeverityInfo, 0, testAlert, true)).To(Equal(ocmagentv1alpha1.SeverityError))
+		})
+	})
+
+	Context("When an alert keeps firing", func() {
+		BeforeEach(func() {
+			annotations[AnnotationSeverity] = `{"test": {"escalation": {"afterResends": 2, "severity": "Fatal"}}}`
+		})
+		It("Escalates the severity once the record counts the service logs of the escalation", func() {
+			Expect(alertSeverity(mapping, annotations, "test", ocmagentv1alpha1.SeverityInfo, 2, testAlert, true)).To(Equal(ocmagentv1alpha1.SeverityFatal))
+		})
+		It("Does not escalate the severity before", func() {
+			Expect(alertSeverity(mapping, annotations, "test", ocmagentv1alpha1.SeverityInfo, 1, testAlert, true)).To(Equal(ocmagentv1alpha1.SeverityError))
+		})
+		It("Does not escalate the severity of a long firing alert with few service logs sent", func() {
+			testAlert.StartsAt = time.Now().Add(-100 * time.Hour)
+			Expect(alertSeverity(mapping, annotations, "test", ocmagentv1alpha1.SeverityInfo, 0, testAlert, true)).To(Equal(ocmagentv1alpha1.SeverityError))
+		})
+		It("Does not escalate the severity of a resolved alert", func() {
+			Expect(alertSeverity(mapping, annotations, "test", ocmagentv1alpha1.SeverityInfo, 2, testAlert, false)).To(Equal(ocmagentv1alpha1.SeverityError))
+		})
+		It("Counts the service logs of the record while the alert is firing", func() {
+			mn := testconst.TestManagedNotification.DeepCopy()
+			mn.Status.NotificationRecords[0].ServiceLogSentCount = 3
+			Expect(firingServiceLogCount(mn, testconst.TestNotificationName)).To(Equal(3))
+			mn.Status.NotificationRecords[0].Conditions[0].Status = corev1.ConditionFalse
+			Expect(firingServiceLogCount(mn, testconst.TestNotificationName)).To(Equal(0))
+			Expect(firingServiceLogCount(&testconst.TestManagedNotificationWithoutStatus, testconst.TestNotificationName)).To(Equal(0))
+		})
+	})
+
+	Context("When validating the severities", func() {
+		It("Accepts the severities of service logs", func() {
+			for _, s := range []string{"Debug", "Info", "Warning", "Error", "Fatal"} {
+				Expect(IsValidSeverity(s)).To(BeTrue())
+			}
+			Expect(IsValidSeverity("critical")).To(BeFalse())
+			Expect(IsValidSeverity("")).To(BeFalse())
+		})
+		It("Ignores the mappings and escalation of the annotation to an unknown severity", func() {
+			annotations[AnnotationSeverity] = `{"test": {"mapping": {"critical": "Critical", "warning": "Warning"}, "escalation": {"afterResends": 1, "severity": "Urgent"}}}`
+			options := notificationSeverityOptions(annotations, "test")
+			Expect(options.Mapping).To(Equal(map[string]ocmagentv1alpha1.NotificationSeverity{"warning": ocmagentv1alpha1.SeverityWarning}))
+			Expect(options.Escalation).To(BeNil())
+			Expect(alertSeverity(mapping, annotations, "test", ocmagentv1alpha1.SeverityInfo, 5, testAlert, true)).To(Equal(ocmagentv1alpha1.SeverityError))
+		})
+	})
+})
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/openshift/ocm-agent/pkg/metrics"
+	"github.com/openshift/ocm-agent/pkg/suppression"
+)
+
+// EventReasonAlertSuppressed is recorded on the template of a firing alert whose notification is suppressed by a
+// suppression rule, e.g. during a maintenance window
+const EventReasonAlertSuppressed = "AlertSuppressed"
+
+// WithSuppression makes the handler suppress the notifications of the firing alerts matching an active suppression
+// rule, the alerts still firing being notified once no rule suppresses them
+func (h *WebhookReceiverHandler) WithSuppression(s *suppression.Suppressor) *WebhookReceiverHandler {
+	h.suppressor = s
+	return h
+}
+
+// WithSuppression makes the handler suppress the notifications of the firing alerts matching an active suppression
+// rule, the alerts still firing being notified once no rule suppresses them
+func (h *WebhookRHOBSReceiverHandler) WithSuppression(s *suppression.Suppressor) *WebhookRHOBSReceiverHandler {
+	h.suppressor = s
+	return h
+}
+
+// ProcessReleasedAlerts processes the suppressed alerts which are no longer suppressed like the alerts of a request
+func (h *WebhookReceiverHandler) ProcessReleasedAlerts(ctx context.Context, alerts []template.Alert) {
+	h.processAMReceiver(AMReceiverData{Status: string(model.AlertFiring), Alerts: alerts}, ctx)
+}
+
+// ProcessReleasedAlerts processes the suppressed alerts which are no longer suppressed like the alerts of a request
+func (h *WebhookRHOBSReceiverHandler) ProcessReleasedAlerts(ctx context.Context, alerts []template.Alert) {
+	h.processAMReceiver(AMReceiverData{Status: string(model.AlertFiring), Alerts: alerts}, ctx)
+}
+
+// isSuppressed returns whether the notification of a firing alert is suppressed, recording the suppression on the
+// template of the notification
+func isSuppressed(s *suppression.Suppressor, recorder record.EventRecorder, obj runtime.Object, notificationName string, alert template.Alert) bool {
+	if s == nil {
+		return false
+	}
+	rule, until, ok := s.Suppress(alert, time.Now())
+	if !ok {
+		return false
+	}
+	fields := logrus.Fields{LogFieldNotificationName: notificationName, LogFieldAlertname: alert.Labels[AMLabelAlertName], "rule": rule}
+	if until.IsZero() {
+		log.WithFields(fields).Info("not sending a notification as a suppression rule is active")
+		recordEvent(recorder, obj, corev1.EventTypeNormal, EventReasonAlertSuppressed,
+			"not sending %s for alert %s as suppression rule %s is active", notificationName, alert.Labels[AMLabelAlertName], rule)
+	} else {
+		log.WithFields(fields).WithField("until", until).Info("not sending a notification during a suppression window")
+		recordEvent(recorder, obj, corev1.EventTypeNormal, EventReasonAlertSuppressed,
+			"not sending %s for alert %s until the window of suppression rule %s ends at %s", notificationName, alert.Labels[AMLabelAlertName], rule, until.UTC().Format(time.RFC3339))
+	}
+	metrics.CountAlertSuppressed(notificationName, rule)
+	return true
+}
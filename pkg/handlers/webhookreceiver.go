@@ -12,14 +12,17 @@ import (
 	"github.com/openshift/ocm-agent/pkg/config"
 
 	"github.com/prometheus/alertmanager/template"
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 
 	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/openshift/ocm-agent/pkg/consts"
 	"github.com/openshift/ocm-agent/pkg/metrics"
+	"github.com/openshift/ocm-agent/pkg/ocm"
+	"github.com/openshift/ocm-agent/pkg/sink"
 
 	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -32,12 +35,33 @@ func NewWebhookReceiverHandler(c client.Client, o OCMClient) *WebhookReceiverHan
 	}
 }
 
+// WithEventRecorder makes the handler record the outcome of alerts as events on their ManagedNotification
+func (h *WebhookReceiverHandler) WithEventRecorder(r record.EventRecorder) *WebhookReceiverHandler {
+	h.recorder = r
+	return h
+}
+
+// WithSinks makes the sinks of the registry available to the notifications selecting them
+func (h *WebhookReceiverHandler) WithSinks(r *sink.Registry) *WebhookReceiverHandler {
+	h.sinks = r
+	return h
+}
+
+// WithLimitedSupport makes the handler place the cluster into limited support for the notifications declaring it
+func (h *WebhookReceiverHandler) WithLimitedSupport(l LimitedSupportClient) *WebhookReceiverHandler {
+	h.limitedSupport = l
+	return h
+}
+
 func (h *WebhookReceiverHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// validate request
 	if r != nil && r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if rejectUnlessLeader(h.leader, w) {
+		return
+	}
 	var err error
 	var alertData AMReceiverData
 	err = json.NewDecoder(r.Body).Decode(&alertData)
@@ -79,20 +103,32 @@ func (h *WebhookReceiverHandler) processAMReceiver(d AMReceiverData, ctx context
 		return &AMReceiverResponse{Error: err, Status: "unable to list managed notifications", Code: http.StatusInternalServerError}
 	}
 
-	// Handle each firing alert
+	// Handle the firing alerts, then the resolved ones, the alerts of the same notification one after the other
+	var jobs []alertJob
 	for _, alert := range d.Alerts.Firing() {
-		err = h.processAlert(alert, mnl, true)
-		if err != nil {
-			log.WithError(err).Error("a firing alert could not be successfully processed")
-		}
+		alert := alert
+		jobs = append(jobs, alertJob{key: alertJobKey(alert, mnl), process: func(ctx context.Context) error {
+			err := h.processAlert(ctx, alert, mnl, true)
+			if err != nil {
+				logAlertError(err, "a firing alert could not be successfully processed")
+			}
+			return nil
+		}})
 	}
-
-	// Handle resolved alerts
 	for _, alert := range d.Alerts.Resolved() {
-		err = h.processAlert(alert, mnl, false)
-		if err != nil {
-			log.WithError(err).Error("a resolved alert could not be successfully processed")
-		}
+		alert := alert
+		jobs = append(jobs, alertJob{key: alertJobKey(alert, mnl), process: func(ctx context.Context) error {
+			err := h.processAlert(ctx, alert, mnl, false)
+			if err != nil {
+				logAlertError(err, "a resolved alert could not be successfully processed")
+			}
+			return nil
+		}})
+	}
+	err = h.pool.run(ctx, jobs)
+	if err != nil {
+		log.WithError(err).Error("unable to process all alerts before the deadline")
+		return &AMReceiverResponse{Error: err, Status: "unable to process all alerts before the deadline", Code: http.StatusServiceUnavailable}
 	}
 
 	return &AMReceiverResponse{Error: nil, Status: "ok", Code: http.StatusOK}
@@ -100,19 +136,28 @@ func (h *WebhookReceiverHandler) processAMReceiver(d AMReceiverData, ctx context
 
 // processAlert handles the pre-check verification and sending of a notification for a particular alert
 // and returns an error if that process completed successfully or false otherwise
-func (h *WebhookReceiverHandler) processAlert(alert template.Alert, mnl *oav1alpha1.ManagedNotificationList, firing bool) error {
-	// Should this alert be handled?
-	if !isValidAlert(alert, false) {
-		log.WithField(LogFieldAlert, fmt.Sprintf("%+v", alert)).Info("alert does not meet valid criteria")
-		return fmt.Errorf("alert does not meet valid criteria")
+func (h *WebhookReceiverHandler) processAlert(ctx context.Context, alert template.Alert, mnl *oav1alpha1.ManagedNotificationList, firing bool) error {
+	// A resolved alert no longer needs to be notified once its suppression ends
+	if !firing && h.suppressor != nil {
+		h.suppressor.Resolve(alert)
 	}
 
-	// Can the alert be mapped to an existing notification definition?
-	notification, managedNotifications, err := getNotification(alert.Labels[AMLabelTemplateName], mnl)
+	// Which notification, if any, is the alert for?
+	notification, managedNotifications, err := h.alertNotification(alert, mnl)
 	if err != nil {
-		log.WithError(err).WithField(LogFieldAlert, fmt.Sprintf("%+v", alert)).Warning("an alert fired with no associated notification template definition")
 		return err
 	}
+	// The alerts of other notifications of the template are processed concurrently, its annotations are updated on a copy
+	managedNotifications = managedNotifications.DeepCopy()
+
+	clusterID := viper.GetString(config.ExternalClusterID)
+	// The alert is notified once no suppression rule is active for it, the limited support applies all the same
+	if firing && isSuppressed(h.suppressor, h.recorder, managedNotifications, notification.Name, alert) {
+		return h.updateLimitedSupport(ctx, notification.Name, managedNotifications, clusterID, firing)
+	}
+
+	sent := firingServiceLogCount(managedNotifications, notification.Name)
+	severity := alertSeverity(h.severities, managedNotifications.Annotations, notification.Name, notification.Severity, sent, alert, firing)
 
 	// Has a servicelog already been sent and we are within the notification's "do-not-resend" window?
 	canBeSent, err := managedNotifications.CanBeSent(notification.Name, firing)
@@ -122,11 +167,17 @@ func (h *WebhookReceiverHandler) processAlert(alert template.Alert, mnl *oav1alp
 	}
 	if !canBeSent {
 		if firing {
-			log.WithFields(log.Fields{"notification": notification.Name,
+			log.WithFields(logrus.Fields{"notification": notification.Name,
 				LogFieldResendInterval: notification.ResendWait,
 			}).Info("not sending a notification as one was already sent recently")
+			recordEvent(h.recorder, managedNotifications, corev1.EventTypeNormal, EventReasonServiceLogSuppressed,
+				"not sending %s for alert %s as one was already sent in the last %d hours", notification.Name, alert.Labels[AMLabelAlertName], notification.ResendWait)
 		} else {
-			log.WithFields(log.Fields{"notification": notification.Name}).Info("not sending a resolve notification if it was not firing or resolved body is empty")
+			log.WithFields(logrus.Fields{"notification": notification.Name}).Info("not sending a resolve notification if it was not firing or resolved body is empty")
+			if !isFiringRecorded(managedNotifications, notification.Name) {
+				// The firing alert was not recorded when it was suppressed or the cluster opted out of its notification
+				return h.updateLimitedSupport(ctx, notification.Name, managedNotifications, clusterID, firing)
+			}
 			s, err := managedNotifications.Status.GetNotificationRecord(notification.Name)
 			// If a status history exists but can't be fetched, this is an irregular situation
 			if err != nil {
@@ -134,40 +185,110 @@ func (h *WebhookReceiverHandler) processAlert(alert template.Alert, mnl *oav1alp
 			}
 			firingStatus := s.Conditions.GetCondition(oav1alpha1.ConditionAlertFiring).Status
 			if firingStatus == corev1.ConditionTrue {
+				// The limited support placed by the firing alert must be removed even without a resolved SL
+				err = h.updateLimitedSupport(ctx, notification.Name, managedNotifications, viper.GetString(config.ExternalClusterID), firing)
+				if err != nil {
+					return err
+				}
 				// Update the notification status for the resolved alert without sending resolved SL
-				_, err := h.updateNotificationStatus(notification, managedNotifications, firing)
+				_, err := h.updateNotificationStatus(ctx, notification, managedNotifications, firing)
 				if err != nil {
-					log.WithFields(log.Fields{LogFieldNotificationName: notification.Name, LogFieldManagedNotification: managedNotifications.Name}).WithError(err).Error("unable to update notification status")
+					log.WithFields(logrus.Fields{LogFieldNotificationName: notification.Name, LogFieldManagedNotification: managedNotifications.Name}).WithError(err).Error("unable to update notification status")
 					return err
 				}
+				h.endIncidentEventStream(ctx, managedNotifications, notification.Name)
 			}
 		}
 		// This is not an error state
 		return nil
 	}
-	// Send the servicelog for the alert
-	log.WithFields(log.Fields{LogFieldNotificationName: notification.Name}).Info("will send servicelog for notification")
-	err = h.ocm.SendServiceLog(notification.Summary, notification.ActiveDesc, notification.ResolvedDesc, viper.GetString(config.ExternalClusterID), notification.Severity, notification.LogType, notification.References, firing)
+	// Place or remove the limited support first, doing so is idempotent and can be retried with the whole alert
+	err = h.updateLimitedSupport(ctx, notification.Name, managedNotifications, clusterID, firing)
 	if err != nil {
-		log.WithError(err).WithFields(log.Fields{LogFieldNotificationName: notification.Name, LogFieldIsFiring: true}).Error("unable to send a notification")
-		metrics.SetResponseMetricFailure("service_logs")
 		return err
 	}
-	// Reset the metric if we got correct Response from OCM
-	metrics.ResetMetric(metrics.MetricResponseFailure)
-
-	// Count the service log sent by the template name
+	// Never notify a cluster which opted out of the notification, the limited support applies all the same
 	if firing {
-		metrics.CountServiceLogSent(notification.Name, "firing")
-	} else {
-		metrics.CountServiceLogSent(notification.Name, "resolved")
+		optedOut, err := h.preferences.isOptedOut(ctx, h.c, managedNotifications, clusterID, notification.Name, notification.Summary, notification.LogType, severity, alert)
+		if err != nil || optedOut {
+			return err
+		}
 	}
-	// Update the notification status to indicate a servicelog has been sent
-	m, err := h.updateNotificationStatus(notification, managedNotifications, firing)
+	// The resolved service log tells how long the issue lasted
+	resolvedDesc := withIncidentDuration(notification.ResolvedDesc, alert)
+	sinks := notificationSinks(managedNotifications.Annotations, notification.Name)
+	if h.ocm == nil {
+		// The service_logs service is not enabled
+		sinks = withoutSink(sinks, sink.ServiceLog)
+	}
+	var intent string
+	var postedSince time.Time
+	if containsSink(sinks, sink.ServiceLog) {
+		// The service logs of an incident share the event stream recorded when it started firing
+		streamID, err := h.incidentEventStream(ctx, managedNotifications, notification.Name, clusterID, alert, firing)
+		if err != nil {
+			log.WithError(err).WithFields(logrus.Fields{LogFieldNotificationName: notification.Name, LogFieldIsFiring: firing}).Error("unable to record the event stream of the incident")
+			return err
+		}
+		req := ocm.ServiceLogRequest{
+			ClusterID:         clusterID,
+			Summary:           notification.Summary,
+			FiringDesc:        notification.ActiveDesc,
+			ResolveDesc:       resolvedDesc,
+			Severity:          severity,
+			LogType:           notification.LogType,
+			References:        h.references.merge(notification.References, alert),
+			Firing:            firing,
+			EventStreamID:     streamID,
+			ServiceLogOptions: notificationServiceLogOptions(managedNotifications.Annotations, notification.Name),
+		}
+		// Never post a service log which a previous attempt posted without recording it
+		intent, postedSince, err = h.beginServiceLog(ctx, managedNotifications, notification.Name, req)
+		if err != nil {
+			log.WithError(err).WithFields(logrus.Fields{LogFieldNotificationName: notification.Name, LogFieldIsFiring: firing}).Error("unable to send a notification")
+			return err
+		}
+		if postedSince.IsZero() {
+			// Send the servicelog for the alert
+			log.WithFields(logrus.Fields{LogFieldNotificationName: notification.Name}).Info("will send servicelog for notification")
+			res, err := h.ocm.SendServiceLog(ctx, req)
+			auditServiceLog(managedNotifications, notification.Name, clusterID, alert, firing, res, err)
+			if err != nil {
+				log.WithError(err).WithFields(logrus.Fields{LogFieldNotificationName: notification.Name, LogFieldIsFiring: true}).Error("unable to send a notification")
+				metrics.SetResponseMetricFailure("service_logs")
+				return err
+			}
+			// Reset the metric if we got correct Response from OCM
+			metrics.ResetMetric(metrics.MetricResponseFailure)
+
+			// Count the service log sent by the template name
+			if firing {
+				metrics.CountServiceLogSent(notification.Name, "firing")
+			} else {
+				metrics.CountServiceLogSent(notification.Name, "resolved")
+			}
+		}
+	}
+	// Deliver the notification to the other sinks selected for it
+	msg := newSinkMessage(notification.Name, clusterID, notification.Summary, notification.ActiveDesc, resolvedDesc, severity, firing)
+	err = deliverToSinks(ctx, h.sinks, sinks, msg)
 	if err != nil {
-		log.WithFields(log.Fields{LogFieldNotificationName: notification.Name, LogFieldManagedNotification: managedNotifications.Name}).WithError(err).Error("unable to update notification status")
+		log.WithError(err).WithFields(logrus.Fields{LogFieldNotificationName: notification.Name, LogFieldIsFiring: firing}).Error("unable to deliver a notification")
 		return err
 	}
+	// Update the notification status to indicate a servicelog has been sent, even if the request is cancelled meanwhile
+	rctx, cancel := recordContext()
+	defer cancel()
+	// A service log posted by a previous attempt may have been recorded since by the resolution of its intent
+	m, err := h.recordNotificationStatus(rctx, notification, managedNotifications, firing, postedSince)
+	if err != nil {
+		log.WithFields(logrus.Fields{LogFieldNotificationName: notification.Name, LogFieldManagedNotification: managedNotifications.Name}).WithError(err).Error("unable to update notification status")
+		return err
+	}
+	if !firing {
+		h.endIncidentEventStream(rctx, managedNotifications, notification.Name)
+	}
+	h.endServiceLog(rctx, managedNotifications, intent)
 	status, err := m.Status.GetNotificationRecord(notification.Name)
 	if err != nil {
 		return err
@@ -178,6 +299,37 @@ func (h *WebhookReceiverHandler) processAlert(alert template.Alert, mnl *oav1alp
 	return nil
 }
 
+// updateLimitedSupport places the cluster into limited support for a firing alert, or removes it for a resolved
+// alert, when the notification declares a limited support reason
+func (h *WebhookReceiverHandler) updateLimitedSupport(ctx context.Context, name string, mn *oav1alpha1.ManagedNotification, clusterID string, firing bool) error {
+	if h.limitedSupport == nil {
+		return nil
+	}
+	reason := notificationLimitedSupportReason(mn.Annotations, name)
+	if reason == nil {
+		return nil
+	}
+	var err error
+	state := "firing"
+	if firing {
+		log.WithFields(logrus.Fields{LogFieldNotificationName: name, LogFieldLimitedSupportSummary: reason.Summary}).Info("will place cluster into limited support for notification")
+		err = h.limitedSupport.PlaceLimitedSupport(ctx, clusterID, *reason)
+	} else {
+		state = "resolved"
+		log.WithFields(logrus.Fields{LogFieldNotificationName: name, LogFieldLimitedSupportSummary: reason.Summary}).Info("will remove limited support for notification")
+		err = h.limitedSupport.RemoveLimitedSupport(ctx, clusterID, *reason)
+	}
+	if err != nil {
+		log.WithError(err).WithFields(logrus.Fields{LogFieldNotificationName: name, LogFieldIsFiring: firing}).Error("unable to update limited support")
+		metrics.SetResponseMetricFailure(config.LimitedSupportService)
+		return err
+	}
+	// Reset the metric if we got correct Response from OCM
+	metrics.ResetMetric(metrics.MetricResponseFailure)
+	metrics.CountLimitedSupportSent(name, state)
+	return nil
+}
+
 // getNotification returns the notification from the ManagedNotification bundle if one exists, or error if one does not
 func getNotification(name string, m *oav1alpha1.ManagedNotificationList) (*oav1alpha1.Notification, *oav1alpha1.ManagedNotification, error) {
 	for _, mn := range m.Items {
@@ -189,20 +341,30 @@ func getNotification(name string, m *oav1alpha1.ManagedNotificationList) (*oav1a
 	return nil, nil, fmt.Errorf("matching managed notification not found for %s", name)
 }
 
-func (h *WebhookReceiverHandler) updateNotificationStatus(n *oav1alpha1.Notification, mn *oav1alpha1.ManagedNotification, firing bool) (*oav1alpha1.ManagedNotification, error) {
+func (h *WebhookReceiverHandler) updateNotificationStatus(ctx context.Context, n *oav1alpha1.Notification, mn *oav1alpha1.ManagedNotification, firing bool) (*oav1alpha1.ManagedNotification, error) {
+	return h.recordNotificationStatus(ctx, n, mn, firing, time.Time{})
+}
+
+// recordNotificationStatus updates the notification status like updateNotificationStatus, unless a service log of the
+// notification was recorded since the given time. The latest version of the template is checked, so a service log
+// posted by a previous attempt is recorded once even when several processes find its intent.
+func (h *WebhookReceiverHandler) recordNotificationStatus(ctx context.Context, n *oav1alpha1.Notification, mn *oav1alpha1.ManagedNotification, firing bool, since time.Time) (*oav1alpha1.ManagedNotification, error) {
 	var m *oav1alpha1.ManagedNotification
 
 	// Update lastSent timestamp
 	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		m = &oav1alpha1.ManagedNotification{}
 
-		err := h.c.Get(context.TODO(), client.ObjectKey{
+		err := h.c.Get(ctx, client.ObjectKey{
 			Namespace: mn.Namespace,
 			Name:      mn.Name,
 		}, m)
 		if err != nil {
 			return err
 		}
+		if !since.IsZero() && notificationRecordedSince(m, n.Name, since) {
+			return nil
+		}
 
 		timeNow := &v1.Time{Time: time.Now()}
 		status, err := m.Status.GetNotificationRecord(n.Name)
@@ -257,7 +419,7 @@ func (h *WebhookReceiverHandler) updateNotificationStatus(n *oav1alpha1.Notifica
 
 		m.Status.NotificationRecords.SetNotificationRecord(*status)
 
-		err = h.c.Status().Update(context.TODO(), m)
+		err = h.c.Status().Update(ctx, m)
 
 		return err
 	})
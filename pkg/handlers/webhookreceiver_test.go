@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -19,15 +21,23 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/prometheus/alertmanager/template"
+	"github.com/spf13/viper"
 
 	corev1 "k8s.io/api/core/v1"
 	k8serrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 
 	ocmagentv1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
 
+	"github.com/openshift/ocm-agent/pkg/audit"
+	"github.com/openshift/ocm-agent/pkg/config"
 	testconst "github.com/openshift/ocm-agent/pkg/consts/test"
 	webhookreceivermock "github.com/openshift/ocm-agent/pkg/handlers/mocks"
+	"github.com/openshift/ocm-agent/pkg/ocm"
+	"github.com/openshift/ocm-agent/pkg/sink"
+	sinkmocks "github.com/openshift/ocm-agent/pkg/sink/mocks"
+	"github.com/openshift/ocm-agent/pkg/suppression"
 	clientmocks "github.com/openshift/ocm-agent/pkg/util/test/generated/mocks/client"
 )
 
@@ -37,6 +47,87 @@ func (fn RoundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
 	return fn(r)
 }
 
+type testAuditBackend struct {
+	records []audit.Record
+}
+
+func (b *testAuditBackend) Write(r audit.Record) error {
+	b.records = append(b.records, r)
+	return nil
+}
+
+// serviceLogRequestMatcher matches the service log requests for a notification, whatever the cluster
+type serviceLogRequestMatcher struct {
+	notification ocmagentv1alpha1.Notification
+	firing       bool
+}
+
+// serviceLogRequestFor returns a matcher of the service log requests for the notification and firing state
+func serviceLogRequestFor(n ocmagentv1alpha1.Notification, firing bool) gomock.Matcher {
+	return serviceLogRequestMatcher{notification: n, firing: firing}
+}
+
+func (m serviceLogRequestMatcher) Matches(x interface{}) bool {
+	r, ok := x.(ocm.ServiceLogRequest)
+	if !ok {
+		return false
+	}
+	return r.Summary == m.notification.Summary &&
+		r.FiringDesc == m.notification.ActiveDesc &&
+		r.ResolveDesc == m.notification.ResolvedDesc &&
+		r.Severity == m.notification.Severity &&
+		r.LogType == m.notification.LogType &&
+		reflect.DeepEqual(r.References, m.notification.References) &&
+		r.Firing == m.firing
+}
+
+func (m serviceLogRequestMatcher) String() string {
+	return fmt.Sprintf("is the service log request of notification %s with firing %t", m.notification.Name, m.firing)
+}
+
+// newResendableManagedNotificationList returns a ManagedNotification whose notification was sent before its resend window
+func newResendableManagedNotificationList(annotations map[string]string) *ocmagentv1alpha1.ManagedNotificationList {
+	return &ocmagentv1alpha1.ManagedNotificationList{
+		Items: []ocmagentv1alpha1.ManagedNotification{
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: annotations,
+				},
+				Spec: ocmagentv1alpha1.ManagedNotificationSpec{
+					Notifications: []ocmagentv1alpha1.Notification{
+						testconst.TestNotification,
+					},
+				},
+				Status: ocmagentv1alpha1.ManagedNotificationStatus{
+					NotificationRecords: ocmagentv1alpha1.NotificationRecords{
+						ocmagentv1alpha1.NotificationRecord{
+							Name:                testconst.TestNotificationName,
+							ServiceLogSentCount: 0,
+							Conditions: []ocmagentv1alpha1.NotificationCondition{
+								{
+									Type:               ocmagentv1alpha1.ConditionAlertFiring,
+									Status:             corev1.ConditionTrue,
+									LastTransitionTime: &metav1.Time{Time: time.Now()},
+								},
+								{
+									Type:               ocmagentv1alpha1.ConditionAlertResolved,
+									Status:             corev1.ConditionFalse,
+									LastTransitionTime: &metav1.Time{Time: time.Now()},
+								},
+								{
+									Type:               ocmagentv1alpha1.ConditionServiceLogSent,
+									Status:             corev1.ConditionTrue,
+									LastTransitionTime: &metav1.Time{Time: time.Now().Add(time.Duration(-90) * time.Minute)},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
 var _ = Describe("Webhook Handlers", func() {
 
 	var (
@@ -191,19 +282,27 @@ var _ = Describe("Webhook Handlers", func() {
 		Context("Check if an alert is valid or not", func() {
 			It("Reports error if alert does not have alertname label", func() {
 				delete(testAlert.Labels, "alertname")
-				err := webhookReceiverHandler.processAlert(testAlert, testconst.TestManagedNotificationList, true)
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testconst.TestManagedNotificationList, true)
 				Expect(err).Should(HaveOccurred())
 			})
 			It("Reports error if alert does not have managed_notification_template label", func() {
 				delete(testAlert.Labels, "managed_notification_template")
-				err := webhookReceiverHandler.processAlert(testAlert, testconst.TestManagedNotificationList, true)
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testconst.TestManagedNotificationList, true)
 				Expect(err).Should(HaveOccurred())
 			})
 			It("Reports error if alert does not have send_managed_notification label", func() {
 				delete(testAlert.Labels, "send_managed_notification")
-				err := webhookReceiverHandler.processAlert(testAlert, testconst.TestManagedNotificationList, true)
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testconst.TestManagedNotificationList, true)
 				Expect(err).Should(HaveOccurred())
 			})
+			It("Records an event on the notification template of an invalid alert", func() {
+				recorder := record.NewFakeRecorder(1)
+				webhookReceiverHandler.WithEventRecorder(recorder)
+				delete(testAlert.Labels, "send_managed_notification")
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testconst.TestManagedNotificationList, true)
+				Expect(err).Should(HaveOccurred())
+				Expect(<-recorder.Events).To(HavePrefix("Warning " + EventReasonInvalidAlert))
+			})
 		})
 		Context("Check if a valid alert can be mapped to existing notification template definition or not", func() {
 			BeforeEach(func() {
@@ -220,7 +319,7 @@ var _ = Describe("Webhook Handlers", func() {
 			})
 			It("Reports failure if cannot fetch notification for a valid alert", func() {
 				testManagedNotificationList = &ocmagentv1alpha1.ManagedNotificationList{}
-				err := webhookReceiverHandler.processAlert(testAlert, testManagedNotificationList, true)
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
 				Expect(err).ToNot(BeNil())
 			})
 		})
@@ -263,8 +362,11 @@ var _ = Describe("Webhook Handlers", func() {
 						},
 					},
 				}
-				err := webhookReceiverHandler.processAlert(testAlert, testManagedNotificationList, true)
+				recorder := record.NewFakeRecorder(1)
+				webhookReceiverHandler.WithEventRecorder(recorder)
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
 				Expect(err).ShouldNot(HaveOccurred())
+				Expect(<-recorder.Events).To(HavePrefix("Normal " + EventReasonServiceLogSuppressed))
 			})
 			It("Should send service log for a firing alert if one hasn't already sent after resend time and update notification", func() {
 				testManagedNotificationList = &ocmagentv1alpha1.ManagedNotificationList{
@@ -304,21 +406,12 @@ var _ = Describe("Webhook Handlers", func() {
 					},
 				}
 				gomock.InOrder(
-					mockOCMClient.EXPECT().SendServiceLog(
-						testconst.TestNotification.Summary,
-						testconst.TestNotification.ActiveDesc,
-						testconst.TestNotification.ResolvedDesc,
-						gomock.Any(), // cluster id
-						testconst.TestNotification.Severity,
-						testconst.TestNotification.LogType,
-						testconst.TestNotification.References,
-						true, // firing
-					),
+					mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), serviceLogRequestFor(testconst.TestNotification, true)),
 					mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
 					mockClient.EXPECT().Status().Return(mockStatusWriter),
 					mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
 				)
-				err := webhookReceiverHandler.processAlert(testAlert, testManagedNotificationList, true)
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
 				Expect(err).ShouldNot(HaveOccurred())
 			})
 			It("Should not send servicelog if the alert was not in firing state and is resolved", func() {
@@ -358,7 +451,7 @@ var _ = Describe("Webhook Handlers", func() {
 						},
 					},
 				}
-				err := webhookReceiverHandler.processAlert(testAlert, testManagedNotificationList, false)
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, false)
 				Expect(err).ShouldNot(HaveOccurred())
 			})
 			It("Should not send resolved servicelog if the resolved body is empty", func() {
@@ -403,7 +496,7 @@ var _ = Describe("Webhook Handlers", func() {
 					mockClient.EXPECT().Status().Return(mockStatusWriter),
 					mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
 				)
-				err := webhookReceiverHandler.processAlert(testAlertResolved, testManagedNotificationList, false)
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlertResolved, testManagedNotificationList, false)
 				Expect(err).ShouldNot(HaveOccurred())
 			})
 			It("Should report error if not able to send service log", func() {
@@ -444,14 +537,346 @@ var _ = Describe("Webhook Handlers", func() {
 					},
 				}
 				gomock.InOrder(
-					mockOCMClient.EXPECT().SendServiceLog(
-						testconst.TestNotification.Summary,
-						testconst.TestNotification.ActiveDesc,
-						testconst.TestNotification.ResolvedDesc,
-						gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), true).Return(k8serrs.NewInternalError(fmt.Errorf("a fake error"))),
+					mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), serviceLogRequestFor(testconst.TestNotification, true)).Return(nil, k8serrs.NewInternalError(fmt.Errorf("a fake error"))),
 				)
-				err := webhookReceiverHandler.processAlert(testAlert, testManagedNotificationList, true)
+				auditBackend := &testAuditBackend{}
+				audit.SetBackends(auditBackend)
+				defer audit.SetBackends()
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
 				Expect(err).Should(HaveOccurred())
+				Expect(auditBackend.records).To(HaveLen(1))
+				Expect(auditBackend.records[0].Outcome).To(Equal(audit.OutcomeFailed))
+				Expect(auditBackend.records[0].Template).To(Equal(testconst.TestNotificationName))
+			})
+			Context("Check if a notification is delivered to the sinks it selects", func() {
+				var (
+					mockSink *sinkmocks.MockSink
+					sinks    *sink.Registry
+				)
+				BeforeEach(func() {
+					mockSink = sinkmocks.NewMockSink(mockCtrl)
+					sinks = sink.NewRegistry()
+					sinks.Register("internal", sink.TypeWebhook, mockSink, 0, sink.DefaultDeliveryTimeout)
+					webhookReceiverHandler.WithSinks(sinks)
+				})
+				It("Should only deliver to the sink when the service log is not selected", func() {
+					testManagedNotificationList = newResendableManagedNotificationList(map[string]string{AnnotationSinks: `{"test-notification":["internal"]}`})
+					gomock.InOrder(
+						mockSink.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, m sink.Message) error {
+							Expect(m.Notification).To(Equal(testconst.TestNotificationName))
+							Expect(m.Summary).To(Equal(ServiceLogActivePrefix + ": " + testconst.TestNotification.Summary))
+							Expect(m.Firing).To(BeTrue())
+							return nil
+						}),
+						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
+						mockClient.EXPECT().Status().Return(mockStatusWriter),
+						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+					)
+					err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+				It("Should update the notification when the service log is sent and the sink fails", func() {
+					testManagedNotificationList = newResendableManagedNotificationList(map[string]string{AnnotationSinks: `{"test-notification":["service_logs","internal"]}`})
+					gomock.InOrder(
+						mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), serviceLogRequestFor(testconst.TestNotification, true)),
+						mockSink.EXPECT().Send(gomock.Any(), gomock.Any()).Return(fmt.Errorf("a fake error")),
+						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
+						mockClient.EXPECT().Status().Return(mockStatusWriter),
+						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+					)
+					err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+				It("Should report error if the notification could not be delivered anywhere", func() {
+					testManagedNotificationList = newResendableManagedNotificationList(map[string]string{AnnotationSinks: `{"test-notification":["internal","dummy"]}`})
+					mockSink.EXPECT().Send(gomock.Any(), gomock.Any()).Return(fmt.Errorf("a fake error"))
+					err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+					Expect(err).Should(HaveOccurred())
+				})
+			})
+			It("Should send the service log with the options of the notification", func() {
+				testManagedNotificationList = newResendableManagedNotificationList(map[string]string{
+					AnnotationServiceLogOptions: `{"test-notification":{"internalOnly":true,"serviceName":"test-service","username":"sre","createdBy":"ocm-agent"}}`,
+				})
+				gomock.InOrder(
+					mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), serviceLogRequestFor(testconst.TestNotification, true)).DoAndReturn(func(ctx context.Context, r ocm.ServiceLogRequest) (*ocm.ServiceLogResponse, error) {
+						Expect(r.ServiceLogOptions).To(Equal(ocm.ServiceLogOptions{InternalOnly: true, ServiceName: "test-service", Username: "sre", CreatedBy: "ocm-agent"}))
+						return nil, nil
+					}),
+					mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
+					mockClient.EXPECT().Status().Return(mockStatusWriter),
+					mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+				)
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+			It("Should send the service log with the severity mapped from the alert", func() {
+				testManagedNotificationList = newResendableManagedNotificationList(nil)
+				webhookReceiverHandler.WithSeverityMapping(map[string]string{"warning": "Warning"})
+				testAlert.Labels["severity"] = "warning"
+				gomock.InOrder(
+					mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, r ocm.ServiceLogRequest) (*ocm.ServiceLogResponse, error) {
+						Expect(r.Severity).To(Equal(ocmagentv1alpha1.SeverityWarning))
+						return nil, nil
+					}),
+					mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
+					mockClient.EXPECT().Status().Return(mockStatusWriter),
+					mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+				)
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+			It("Should reference the allowed links of the alert in the service log", func() {
+				testManagedNotificationList = newResendableManagedNotificationList(nil)
+				webhookReceiverHandler.WithAlertReferences([]string{"runbook_url"}, []string{"runbooks.example.com"})
+				testAlert.Annotations = map[string]string{"runbook_url": "https://runbooks.example.com/TestAlertName.md"}
+				gomock.InOrder(
+					mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, r ocm.ServiceLogRequest) (*ocm.ServiceLogResponse, error) {
+						Expect(r.References).To(HaveExactElements(append(append([]ocmagentv1alpha1.NotificationReferenceType{}, testconst.TestNotification.References...), "https://runbooks.example.com/TestAlertName.md")))
+						return nil, nil
+					}),
+					mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
+					mockClient.EXPECT().Status().Return(mockStatusWriter),
+					mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+				)
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+			It("Should not send the service log of an alert suppressed by a rule", func() {
+				path := filepath.Join(GinkgoT().TempDir(), "suppression.yaml")
+				Expect(os.WriteFile(path, []byte("rules:\n- name: maintenance\n  matchers: ['alertname=\"TestAlertName\"']\n"), 0600)).To(Succeed())
+				suppressor, err := suppression.NewSuppressor(path, time.Hour)
+				Expect(err).ToNot(HaveOccurred())
+				recorder := record.NewFakeRecorder(1)
+				webhookReceiverHandler.WithSuppression(suppressor).WithEventRecorder(recorder)
+				testManagedNotificationList = newResendableManagedNotificationList(nil)
+				err = webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(<-recorder.Events).To(HavePrefix("Normal " + EventReasonAlertSuppressed))
+				Expect(suppressor.Pending()).To(Equal(1))
+			})
+			It("Should not send nor record the service log of a notification the cluster opted out of", func() {
+				viper.Set(config.ExternalClusterID, "test-cluster")
+				defer viper.Set(config.ExternalClusterID, "")
+				auditBackend := &testAuditBackend{}
+				audit.SetBackends(auditBackend)
+				defer audit.SetBackends()
+				webhookReceiverHandler.WithNotificationPreferences("preferences")
+				testManagedNotificationList = newResendableManagedNotificationList(nil)
+				mockClient.EXPECT().Get(gomock.Any(), client.ObjectKey{Namespace: OCMAgentNamespaceName, Name: "preferences"}, gomock.Any()).Return(nil).SetArg(2, corev1.ConfigMap{
+					Data: map[string]string{"test-cluster": "disabledTemplates: [test-notification]"},
+				})
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(auditBackend.records).To(HaveLen(1))
+				Expect(auditBackend.records[0].Outcome).To(Equal(audit.OutcomeOptedOut))
+				Expect(auditBackend.records[0].ClusterID).To(Equal("test-cluster"))
+			})
+			Context("Check if the service logs of an incident share its event stream", func() {
+				BeforeEach(func() {
+					testAlert.Fingerprint = "test-fingerprint"
+					testAlert.StartsAt = time.Now()
+				})
+				It("Should record the event stream of a new incident before sending its service log", func() {
+					testManagedNotificationList = newResendableManagedNotificationList(nil)
+					streamID := eventStreamID("", testconst.TestNotificationName, testAlert)
+					gomock.InOrder(
+						mockClient.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+							Expect(obj.GetAnnotations()).To(HaveKeyWithValue(AnnotationEventStreams, `{"test-notification":"`+streamID+`"}`))
+							return nil
+						}),
+						mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, r ocm.ServiceLogRequest) (*ocm.ServiceLogResponse, error) {
+							Expect(r.EventStreamID).To(Equal(streamID))
+							return nil, nil
+						}),
+						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
+						mockClient.EXPECT().Status().Return(mockStatusWriter),
+						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+					)
+					err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+				It("Should send the service log of a firing alert again with the event stream of its incident", func() {
+					testManagedNotificationList = newResendableManagedNotificationList(map[string]string{
+						AnnotationEventStreams: `{"test-notification":"test-stream"}`,
+					})
+					// The alert fired again since the incident started
+					testAlert.StartsAt = time.Now().Add(time.Minute)
+					gomock.InOrder(
+						mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, r ocm.ServiceLogRequest) (*ocm.ServiceLogResponse, error) {
+							Expect(r.EventStreamID).To(Equal("test-stream"))
+							return nil, nil
+						}),
+						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
+						mockClient.EXPECT().Status().Return(mockStatusWriter),
+						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+					)
+					err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+				It("Should send the resolved service log with the event stream of its incident and forget it", func() {
+					testManagedNotificationList = newResendableManagedNotificationList(map[string]string{
+						AnnotationEventStreams: `{"test-notification":"test-stream"}`,
+					})
+					gomock.InOrder(
+						mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, r ocm.ServiceLogRequest) (*ocm.ServiceLogResponse, error) {
+							Expect(r.Firing).To(BeFalse())
+							Expect(r.EventStreamID).To(Equal("test-stream"))
+							return nil, nil
+						}),
+						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
+						mockClient.EXPECT().Status().Return(mockStatusWriter),
+						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+						mockClient.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+							Expect(obj.GetAnnotations()).ToNot(HaveKey(AnnotationEventStreams))
+							return nil
+						}),
+					)
+					err := webhookReceiverHandler.processAlert(testconst.Context, testAlertResolved, testManagedNotificationList, false)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+				It("Should send the resolved service log without event stream when its incident was not recorded", func() {
+					testManagedNotificationList = newResendableManagedNotificationList(nil)
+					gomock.InOrder(
+						mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, r ocm.ServiceLogRequest) (*ocm.ServiceLogResponse, error) {
+							Expect(r.EventStreamID).To(BeEmpty())
+							return nil, nil
+						}),
+						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
+						mockClient.EXPECT().Status().Return(mockStatusWriter),
+						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+					)
+					err := webhookReceiverHandler.processAlert(testconst.Context, testAlertResolved, testManagedNotificationList, false)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+			})
+			It("Should record a sent service log even if the request is cancelled meanwhile", func() {
+				testManagedNotificationList = newResendableManagedNotificationList(nil)
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				notCancelled := func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					Expect(ctx.Err()).ToNot(HaveOccurred())
+					return nil
+				}
+				gomock.InOrder(
+					mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Any()).DoAndReturn(func(sctx context.Context, r ocm.ServiceLogRequest) (*ocm.ServiceLogResponse, error) {
+						Expect(sctx).To(Equal(ctx))
+						cancel()
+						return nil, nil
+					}),
+					mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(notCancelled).SetArg(2, testManagedNotificationList.Items[0]),
+					mockClient.EXPECT().Status().Return(mockStatusWriter),
+					mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+				)
+				err := webhookReceiverHandler.processAlert(ctx, testAlert, testManagedNotificationList, true)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+			Context("Check if the cluster is placed into limited support", func() {
+				var (
+					mockLimitedSupportClient *webhookreceivermock.MockLimitedSupportClient
+					testReason               ocm.LimitedSupportReason
+				)
+				BeforeEach(func() {
+					mockLimitedSupportClient = webhookreceivermock.NewMockLimitedSupportClient(mockCtrl)
+					webhookReceiverHandler.WithLimitedSupport(mockLimitedSupportClient)
+					testReason = ocm.LimitedSupportReason{Summary: "test summary", Details: "test details"}
+					testManagedNotificationList = newResendableManagedNotificationList(map[string]string{
+						AnnotationLimitedSupport: `{"test-notification":{"summary":"test summary","details":"test details"}}`,
+					})
+				})
+				It("Should place the cluster into limited support before sending the service log", func() {
+					gomock.InOrder(
+						mockLimitedSupportClient.EXPECT().PlaceLimitedSupport(gomock.Any(), gomock.Any(), testReason).Return(nil),
+						mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), serviceLogRequestFor(testconst.TestNotification, true)),
+						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
+						mockClient.EXPECT().Status().Return(mockStatusWriter),
+						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+					)
+					err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+				It("Should not send the service log if the cluster could not be placed into limited support", func() {
+					mockLimitedSupportClient.EXPECT().PlaceLimitedSupport(gomock.Any(), gomock.Any(), testReason).Return(fmt.Errorf("a fake error"))
+					err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+					Expect(err).Should(HaveOccurred())
+				})
+				It("Should remove the limited support when the alert is resolved", func() {
+					gomock.InOrder(
+						mockLimitedSupportClient.EXPECT().RemoveLimitedSupport(gomock.Any(), gomock.Any(), testReason).Return(nil),
+						mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), serviceLogRequestFor(testconst.TestNotification, false)),
+						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
+						mockClient.EXPECT().Status().Return(mockStatusWriter),
+						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+					)
+					err := webhookReceiverHandler.processAlert(testconst.Context, testAlertResolved, testManagedNotificationList, false)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+				It("Should remove the limited support when the alert is resolved without a resolved service log", func() {
+					testManagedNotificationList.Items[0].Spec.Notifications = []ocmagentv1alpha1.Notification{testconst.NotificationWithoutResolvedBody}
+					gomock.InOrder(
+						mockLimitedSupportClient.EXPECT().RemoveLimitedSupport(gomock.Any(), gomock.Any(), testReason).Return(nil),
+						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
+						mockClient.EXPECT().Status().Return(mockStatusWriter),
+						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+					)
+					err := webhookReceiverHandler.processAlert(testconst.Context, testAlertResolved, testManagedNotificationList, false)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+				Context("When the notification is suppressed or the cluster opted out of it", func() {
+					// Neither a suppressed alert nor an opted out one is notified, both follow the same limited support rule
+					silences := []struct {
+						name  string
+						setup func()
+					}{
+						{"suppressed", func() {
+							path := filepath.Join(GinkgoT().TempDir(), "suppression.yaml")
+							Expect(os.WriteFile(path, []byte("rules:\n- name: maintenance\n  matchers: ['alertname=\"TestAlertName\"']\n"), 0600)).To(Succeed())
+							suppressor, err := suppression.NewSuppressor(path, time.Hour)
+							Expect(err).ToNot(HaveOccurred())
+							webhookReceiverHandler.WithSuppression(suppressor)
+						}},
+						{"opted out", func() {
+							webhookReceiverHandler.WithNotificationPreferences("preferences")
+							mockClient.EXPECT().Get(gomock.Any(), client.ObjectKey{Namespace: OCMAgentNamespaceName, Name: "preferences"}, gomock.Any()).Return(nil).SetArg(2, corev1.ConfigMap{
+								Data: map[string]string{"test-cluster": "disabledTemplates: [test-notification]"},
+							})
+						}},
+					}
+					BeforeEach(func() {
+						viper.Set(config.ExternalClusterID, "test-cluster")
+					})
+					AfterEach(func() {
+						viper.Set(config.ExternalClusterID, "")
+					})
+					for _, silence := range silences {
+						silence := silence
+						It("Should place the cluster into limited support until the alert resolves without notifying it when "+silence.name, func() {
+							silence.setup()
+							testManagedNotificationList.Items[0].Status.NotificationRecords = nil
+							gomock.InOrder(
+								mockLimitedSupportClient.EXPECT().PlaceLimitedSupport(gomock.Any(), "test-cluster", testReason).Return(nil),
+								mockLimitedSupportClient.EXPECT().RemoveLimitedSupport(gomock.Any(), "test-cluster", testReason).Return(nil),
+							)
+							err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+							Expect(err).ShouldNot(HaveOccurred())
+							// The firing alert was not recorded, the resolved one has nothing to notify
+							Expect(isFiringRecorded(&testManagedNotificationList.Items[0], testconst.TestNotificationName)).To(BeFalse())
+							err = webhookReceiverHandler.processAlert(testconst.Context, testAlertResolved, testManagedNotificationList, false)
+							Expect(err).ShouldNot(HaveOccurred())
+						})
+					}
+				})
+				It("Should only place the cluster into limited support when the service_logs service is disabled", func() {
+					webhookReceiverHandler.ocm = nil
+					gomock.InOrder(
+						mockLimitedSupportClient.EXPECT().PlaceLimitedSupport(gomock.Any(), gomock.Any(), testReason).Return(nil),
+						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
+						mockClient.EXPECT().Status().Return(mockStatusWriter),
+						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+					)
+					err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
 			})
 			It("Should report error if not able to update NotificationStatus", func() {
 				testManagedNotificationList = &ocmagentv1alpha1.ManagedNotificationList{
@@ -491,16 +916,12 @@ var _ = Describe("Webhook Handlers", func() {
 					},
 				}
 				gomock.InOrder(
-					mockOCMClient.EXPECT().SendServiceLog(
-						testconst.TestNotification.Summary,
-						testconst.TestNotification.ActiveDesc,
-						testconst.TestNotification.ResolvedDesc,
-						gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), true).Return(nil),
+					mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), serviceLogRequestFor(testconst.TestNotification, true)).Return(nil, nil),
 					mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testManagedNotificationList.Items[0]),
 					mockClient.EXPECT().Status().Return(mockStatusWriter),
 					mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(k8serrs.NewInternalError(fmt.Errorf("a fake error"))),
 				)
-				err := webhookReceiverHandler.processAlert(testAlert, testManagedNotificationList, true)
+				err := webhookReceiverHandler.processAlert(testconst.Context, testAlert, testManagedNotificationList, true)
 				Expect(err).Should(HaveOccurred())
 			})
 		})
@@ -512,7 +933,7 @@ var _ = Describe("Webhook Handlers", func() {
 			gomock.InOrder(
 				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(fakeError),
 			)
-			_, err := webhookReceiverHandler.updateNotificationStatus(&testconst.TestNotification, &testconst.TestManagedNotification, true)
+			_, err := webhookReceiverHandler.updateNotificationStatus(testconst.Context, &testconst.TestNotification, &testconst.TestManagedNotification, true)
 			Expect(err).ShouldNot(BeNil())
 		})
 		When("Getting NotificationRecord for which status does not exist", func() {
@@ -528,7 +949,7 @@ var _ = Describe("Webhook Handlers", func() {
 							return nil
 						}),
 				)
-				_, err := webhookReceiverHandler.updateNotificationStatus(&ocmagentv1alpha1.Notification{Name: "randomnotification"}, &testconst.TestManagedNotificationWithoutStatus, true)
+				_, err := webhookReceiverHandler.updateNotificationStatus(testconst.Context, &ocmagentv1alpha1.Notification{Name: "randomnotification"}, &testconst.TestManagedNotificationWithoutStatus, true)
 				Expect(err).Should(BeNil())
 				Expect(&testconst.TestManagedNotificationWithoutStatus).ToNot(BeNil())
 			})
@@ -546,7 +967,7 @@ var _ = Describe("Webhook Handlers", func() {
 							return nil
 						}),
 				)
-				_, err := webhookReceiverHandler.updateNotificationStatus(&testconst.TestNotification, &testconst.TestManagedNotification, true)
+				_, err := webhookReceiverHandler.updateNotificationStatus(testconst.Context, &testconst.TestNotification, &testconst.TestManagedNotification, true)
 				Expect(err).Should(BeNil())
 			})
 			It("should send service log for alert resolved when no longer firing", func() {
@@ -561,7 +982,7 @@ var _ = Describe("Webhook Handlers", func() {
 							return nil
 						}),
 				)
-				_, err := webhookReceiverHandler.updateNotificationStatus(&testconst.TestNotification, &testconst.TestManagedNotification, false)
+				_, err := webhookReceiverHandler.updateNotificationStatus(testconst.Context, &testconst.TestNotification, &testconst.TestManagedNotification, false)
 				Expect(err).Should(BeNil())
 			})
 		})
@@ -571,7 +992,7 @@ var _ = Describe("Webhook Handlers", func() {
 				mockClient.EXPECT().Status().Return(mockStatusWriter),
 				mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
 			)
-			_, err := webhookReceiverHandler.updateNotificationStatus(&testconst.TestNotification, &testconst.TestManagedNotification, true)
+			_, err := webhookReceiverHandler.updateNotificationStatus(testconst.Context, &testconst.TestNotification, &testconst.TestManagedNotification, true)
 			Expect(err).Should(BeNil())
 		})
 	})
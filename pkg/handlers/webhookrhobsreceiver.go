@@ -5,17 +5,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 
 	"github.com/prometheus/alertmanager/template"
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 
 	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 
+	"github.com/openshift/ocm-agent/pkg/audit"
 	"github.com/openshift/ocm-agent/pkg/consts"
 	"github.com/openshift/ocm-agent/pkg/metrics"
+	"github.com/openshift/ocm-agent/pkg/ocm"
+	"github.com/openshift/ocm-agent/pkg/sink"
+	"github.com/openshift/ocm-agent/pkg/suppression"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -25,8 +32,22 @@ const (
 )
 
 type WebhookRHOBSReceiverHandler struct {
-	c   client.Client
-	ocm OCMClient
+	c         client.Client
+	ocm       OCMClient
+	recorder  record.EventRecorder
+	sinks     *sink.Registry
+	validator HostedClusterValidator
+
+	recordShards int
+	recordLocks  keyedMutex
+	migration    *recordMigration
+	idempotent   bool
+	leader       LeaderChecker
+	pool         alertPool
+	severities   map[string]oav1alpha1.NotificationSeverity
+	references   alertReferences
+	suppressor   *suppression.Suppressor
+	preferences  *preferencesReader
 }
 
 func NewWebhookRHOBSReceiverHandler(c client.Client, o OCMClient) *WebhookRHOBSReceiverHandler {
@@ -36,12 +57,28 @@ func NewWebhookRHOBSReceiverHandler(c client.Client, o OCMClient) *WebhookRHOBSR
 	}
 }
 
+// WithEventRecorder makes the handler record the outcome of alerts as events on their ManagedFleetNotification
+// and ManagedFleetNotificationRecord
+func (h *WebhookRHOBSReceiverHandler) WithEventRecorder(r record.EventRecorder) *WebhookRHOBSReceiverHandler {
+	h.recorder = r
+	return h
+}
+
+// WithSinks makes the sinks of the registry available to the notifications selecting them
+func (h *WebhookRHOBSReceiverHandler) WithSinks(r *sink.Registry) *WebhookRHOBSReceiverHandler {
+	h.sinks = r
+	return h
+}
+
 func (h *WebhookRHOBSReceiverHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// validate request
 	if r != nil && r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if rejectUnlessLeader(h.leader, w) {
+		return
+	}
 	var err error
 	var alertData AMReceiverData
 	err = json.NewDecoder(r.Body).Decode(&alertData)
@@ -72,57 +109,140 @@ func (h *WebhookRHOBSReceiverHandler) ServeHTTP(w http.ResponseWriter, r *http.R
 func (h *WebhookRHOBSReceiverHandler) processAMReceiver(d AMReceiverData, ctx context.Context) *AMReceiverResponse {
 	log.WithField("AMReceiverData", fmt.Sprintf("%+v", d)).Info("Process alert data")
 
-	// Handle each firing alert
-	for _, alert := range d.Alerts.Firing() {
-		// Can we find a notification template for this alert?
-		templateName := alert.Labels[AMLabelTemplateName]
-		mfn := oav1alpha1.ManagedFleetNotification{}
-		//TODO: fix
-		err := h.c.Get(ctx, client.ObjectKey{
-			Namespace: OCMAgentNamespaceName,
-			Name:      templateName,
-		}, &mfn)
-		if err != nil {
-			log.WithError(err).Error("unable to locate corresponding notification template")
-			return &AMReceiverResponse{Error: err,
-				Status: fmt.Sprintf("unable to find ManagedFleetNotification %s", templateName),
-				Code:   http.StatusInternalServerError}
-		}
-
-		// Filter actionable alert based on Label
-		if !isValidAlert(alert, true) {
-			log.WithField(LogFieldAlert, fmt.Sprintf("%+v", alert)).Info("alert does not meet valid criteria")
-			continue
+	// A resolved alert no longer waits for its suppression rules to stop matching it
+	if h.suppressor != nil {
+		for _, alert := range d.Alerts.Resolved() {
+			h.suppressor.Resolve(alert)
 		}
+	}
 
-		err = h.processAlert(alert, mfn)
-		if err != nil {
-			log.WithError(err).Error("a firing alert could not be successfully processed")
-		}
+	// Handle each firing alert, the alerts of the same management cluster one after the other as they share records.
+	// The failure of an alert does not prevent the others from being processed.
+	var (
+		mutex    sync.Mutex
+		retryErr error
+	)
+	var jobs []alertJob
+	for _, alert := range d.Alerts.Firing() {
+		alert := alert
+		jobs = append(jobs, alertJob{key: alert.Labels[AMLabelAlertMCID], process: func(ctx context.Context) error {
+			err := h.processFiringAlert(ctx, alert)
+			if err != nil {
+				mutex.Lock()
+				if retryErr == nil {
+					retryErr = err
+				}
+				mutex.Unlock()
+			}
+			return nil
+		}})
+	}
+	err := h.pool.run(ctx, jobs)
+	if err != nil {
+		log.WithError(err).Error("unable to process all alerts before the deadline")
+		return &AMReceiverResponse{Error: err, Status: "unable to process all alerts before the deadline", Code: http.StatusServiceUnavailable}
+	}
+	if retryErr != nil {
+		// The alerts already notified are not notified again when Alertmanager resends them, within their resend wait
+		return &AMReceiverResponse{Error: retryErr, Status: "unable to process all alerts, they are left for Alertmanager to send again", Code: http.StatusServiceUnavailable}
 	}
 	return &AMReceiverResponse{Error: nil, Status: "ok", Code: http.StatusOK}
 }
 
+// processFiringAlert processes a firing alert with its notification template. The failures which could succeed when
+// Alertmanager sends the alert again are returned, the others are logged.
+func (h *WebhookRHOBSReceiverHandler) processFiringAlert(ctx context.Context, alert template.Alert) error {
+	// Can we find a notification template for this alert? Fleet alerts are not routed by matchers, they have to name it
+	templateName, ok := alert.Labels[AMLabelTemplateName]
+	if !ok || templateName == "" {
+		log.WithField(LogFieldAlert, fmt.Sprintf("%+v", alert)).Info("fleet alert names no notification template")
+		return nil
+	}
+	mfn := oav1alpha1.ManagedFleetNotification{}
+	err := h.c.Get(ctx, client.ObjectKey{
+		Namespace: OCMAgentNamespaceName,
+		Name:      templateName,
+	}, &mfn)
+	if errors.IsNotFound(err) {
+		// Sending the alert again would not help, the template has to be created
+		log.WithError(err).WithField(LogFieldNotificationName, templateName).Warning("an alert fired with no associated notification template definition")
+		metrics.CountTemplateNotFound(templateName)
+		audit.Write(audit.Record{
+			ClusterID:        alert.Labels[AMLabelAlertHCID],
+			Template:         templateName,
+			Firing:           true,
+			AlertFingerprint: alert.Fingerprint,
+			Outcome:          audit.OutcomeTemplateNotFound,
+			Error:            err.Error(),
+		})
+		return nil
+	}
+	if err != nil {
+		logAlertError(err, "unable to locate corresponding notification template")
+		return fmt.Errorf("unable to fetch ManagedFleetNotification %s: %w", templateName, err)
+	}
+
+	// Filter actionable alert based on Label
+	if !isValidAlert(alert, true) {
+		log.WithField(LogFieldAlert, fmt.Sprintf("%+v", alert)).Info("alert does not meet valid criteria")
+		recordEvent(h.recorder, &mfn, corev1.EventTypeWarning, EventReasonInvalidAlert, "alert %s does not meet valid criteria", alert.Labels[AMLabelAlertName])
+		return nil
+	}
+
+	// Never notify a cluster which OCM does not know, or which is not managed by the reporting management cluster
+	known, err := h.isKnownCluster(ctx, alert, &mfn)
+	if err != nil {
+		return err
+	}
+	if !known {
+		return nil
+	}
+
+	// The alert is notified once no suppression rule is active for it
+	if isSuppressed(h.suppressor, h.recorder, &mfn, mfn.Spec.FleetNotification.Name, alert) {
+		return nil
+	}
+
+	// The records are migrated to the shard count before the first alert reads them
+	err = h.ensureRecordsMigrated(ctx)
+	if err != nil {
+		logAlertError(err, "unable to migrate the managedFleetNotificationRecords")
+		return err
+	}
+
+	err = h.processAlert(ctx, alert, mfn)
+	if err != nil {
+		logAlertError(err, "a firing alert could not be successfully processed")
+	}
+	return nil
+}
+
 // processAlert handles the pre-check verification and sending of a notification for a particular alert
 // and returns an error if that process completed successfully or false otherwise
-func (h *WebhookRHOBSReceiverHandler) processAlert(alert template.Alert, mfn oav1alpha1.ManagedFleetNotification) error {
+func (h *WebhookRHOBSReceiverHandler) processAlert(ctx context.Context, alert template.Alert, mfn oav1alpha1.ManagedFleetNotification) error {
 	fn := mfn.Spec.FleetNotification
 	mcID := alert.Labels[AMLabelAlertMCID]
 	hcID := alert.Labels[AMLabelAlertHCID]
 
-	// Fetch the ManagedFleetNotificationRecord, or create it if it does not already exist
+	// Alerts of the same management cluster are handled one at a time, so they never decide to send a notification
+	// from a record which is about to be updated by another alert
+	unlock := h.recordLocks.lock(mcID)
+	defer unlock()
+
+	// Fetch the ManagedFleetNotificationRecord holding the hosted cluster, or create it if it does not already exist
+	recordName := fleetRecordName(mcID, hcID, h.recordShards)
 	mfnr := &oav1alpha1.ManagedFleetNotificationRecord{}
-	err := h.c.Get(context.Background(), client.ObjectKey{
+	err := h.c.Get(ctx, client.ObjectKey{
 		Namespace: OCMAgentNamespaceName,
-		Name:      mcID,
+		Name:      recordName,
 	}, mfnr)
 	if err != nil {
 		if !errors.IsNotFound(err) {
 			log.WithError(err).Error("unable to fetch managedFleetNotificationRecord")
-			return fmt.Errorf("unable to fetch managedFleetNotificationRecord for %s", mcID)
+			return fmt.Errorf("unable to fetch managedFleetNotificationRecord %s for %s", recordName, mcID)
 		}
 		// create ManagedFleetNotificationRecord if not found
-		mfnr, err = h.createManagedFleetNotificationRecord(mcID)
+		mfnr, err = h.createManagedFleetNotificationRecord(ctx, recordName, mcID)
 		if err != nil {
 			log.WithError(err).Error("unable to create managedFleetNotificationRecord")
 			return err
@@ -133,36 +253,25 @@ func (h *WebhookRHOBSReceiverHandler) processAlert(alert template.Alert, mfn oav
 	// set an initial status.
 	if mfnr.Status.ManagementCluster == "" {
 		// Set an initial status
-		mfnr.Status.ManagementCluster = mcID
-		mfnr.Status.NotificationRecordByName = []oav1alpha1.NotificationRecordByName{}
-
 		// Ensure that we can set the initial status successfully
 		// (Just in case the rest of the function logic fails)
-		err = h.c.Status().Update(context.TODO(), mfnr)
+		err = h.updateRecordStatus(ctx, mfnr, func(mfnr *oav1alpha1.ManagedFleetNotificationRecord) error {
+			if mfnr.Status.ManagementCluster == "" {
+				mfnr.Status.ManagementCluster = mcID
+				mfnr.Status.NotificationRecordByName = []oav1alpha1.NotificationRecordByName{}
+			}
+			return nil
+		})
 		if err != nil {
 			log.WithError(err).Error("unable to set initial managedFleetNotificationRecord status")
 			return err
 		}
 	}
 
-	// Fetch notificationRecordByName and ADD if it doesn't exist
-	nfr, err := mfnr.GetNotificationRecordByName(mcID, fn.Name)
+	// Add the records of the notification and of the hosted cluster if they don't exist
+	err = ensureRecordItem(mfnr, fn, hcID)
 	if err != nil {
-		//  add NotificationRecordByName
-		nfr, err = addNotificationRecordByName(fn.Name, fn.ResendWait, hcID, mfnr)
-		if err != nil {
-			return err
-		}
-	}
-
-	// Check if we already have a notification record for this hosted cluster
-	_, err = mfnr.GetNotificationRecordItem(mcID, fn.Name, hcID)
-	if err != nil {
-		// A notification record doesn't exist, so create one
-		_, err = mfnr.AddNotificationRecordItem(hcID, nfr)
-		if err != nil {
-			return err
-		}
+		return err
 	}
 
 	// Check if a service log can be sent
@@ -173,46 +282,104 @@ func (h *WebhookRHOBSReceiverHandler) processAlert(alert template.Alert, mfn oav
 	}
 	// There's no need to send a service log, so just return
 	if !canBeSent {
-		log.WithFields(log.Fields{"notification": fn.Name,
+		log.WithFields(logrus.Fields{"notification": fn.Name,
 			LogFieldResendInterval: fn.ResendWait,
 		}).Info("not sending a notification as one was already sent recently")
+		recordEvent(h.recorder, mfnr, corev1.EventTypeNormal, EventReasonServiceLogSuppressed,
+			"not sending %s to hosted cluster %s as one was already sent in the last %d hours", fn.Name, hcID, fn.ResendWait)
 		return nil
 	}
 
-	// Send the servicelog for the alert
-	log.WithFields(log.Fields{LogFieldNotificationName: fn.Name}).Info("will send servicelog for notification")
-	err = h.ocm.SendServiceLog(fn.Summary, fn.NotificationMessage, "", hcID, fn.Severity, fn.LogType, fn.References, true)
-	if err != nil {
-		log.WithError(err).WithFields(log.Fields{LogFieldNotificationName: fn.Name, LogFieldIsFiring: true}).Error("unable to send a notification")
-		metrics.SetResponseMetricFailure("service_logs")
+	// The severity escalates with the service logs already sent to the hosted cluster
+	var sent int
+	if item, err := mfnr.GetNotificationRecordItem(mcID, fn.Name, hcID); err == nil && item != nil {
+		sent = item.ServiceLogSentCount
+	}
+	severity := alertSeverity(h.severities, mfn.Annotations, fn.Name, fn.Severity, sent, alert, true)
+
+	// Never notify a hosted cluster which opted out of the notification
+	optedOut, err := h.preferences.isOptedOut(ctx, h.c, &mfn, hcID, fn.Name, fn.Summary, fn.LogType, severity, alert)
+	if err != nil || optedOut {
 		return err
 	}
 
-	// Reset the metric if we got correct Response from OCM
-	metrics.ResetMetric(metrics.MetricResponseFailure)
+	sinks := notificationSinks(mfn.Annotations, fn.Name)
+	if h.ocm == nil {
+		// The service_logs service is not enabled
+		sinks = withoutSink(sinks, sink.ServiceLog)
+	}
+	var intent string
+	if containsSink(sinks, sink.ServiceLog) {
+		req := ocm.ServiceLogRequest{
+			ClusterID:         hcID,
+			Summary:           fn.Summary,
+			FiringDesc:        fn.NotificationMessage,
+			Severity:          severity,
+			LogType:           fn.LogType,
+			References:        h.references.merge(fn.References, alert),
+			Firing:            true,
+			EventStreamID:     eventStreamID(hcID, fn.Name, alert),
+			ServiceLogOptions: notificationServiceLogOptions(mfn.Annotations, fn.Name),
+		}
+		// Never post a service log which a previous attempt posted without recording it
+		var posted bool
+		intent, posted, err = h.beginServiceLog(ctx, mfnr, fn, req)
+		if err != nil {
+			log.WithError(err).WithFields(logrus.Fields{LogFieldNotificationName: fn.Name, LogFieldIsFiring: true}).Error("unable to send a notification")
+			return err
+		}
+		if !posted {
+			// Send the servicelog for the alert
+			log.WithFields(logrus.Fields{LogFieldNotificationName: fn.Name}).Info("will send servicelog for notification")
+			res, err := h.ocm.SendServiceLog(ctx, req)
+			auditServiceLog(&mfn, fn.Name, hcID, alert, true, res, err)
+			if err != nil {
+				log.WithError(err).WithFields(logrus.Fields{LogFieldNotificationName: fn.Name, LogFieldIsFiring: true}).Error("unable to send a notification")
+				metrics.SetResponseMetricFailure("service_logs")
+				return err
+			}
 
-	// Count the service log sent by the template name
-	metrics.CountServiceLogSent(fn.Name, "firing")
+			// Reset the metric if we got correct Response from OCM
+			metrics.ResetMetric(metrics.MetricResponseFailure)
 
-	ri, err := mfnr.UpdateNotificationRecordItem(fn.Name, hcID)
-	if err != nil || ri == nil {
-		log.WithFields(log.Fields{LogFieldNotificationName: fn.Name, LogFieldManagedNotification: mfn.Name}).WithError(err).Error("unable to update notification status in CR")
+			// Count the service log sent by the template name
+			metrics.CountServiceLogSent(fn.Name, "firing")
+		}
+	}
+	// Deliver the notification to the other sinks selected for it
+	msg := newSinkMessage(fn.Name, hcID, fn.Summary, fn.NotificationMessage, "", severity, true)
+	err = deliverToSinks(ctx, h.sinks, sinks, msg)
+	if err != nil {
+		log.WithError(err).WithFields(logrus.Fields{LogFieldNotificationName: fn.Name, LogFieldIsFiring: true}).Error("unable to deliver a notification")
 		return err
 	}
 
-	err = h.c.Status().Update(context.TODO(), mfnr)
+	// The notification was sent, it is recorded even if the request is cancelled in the meantime
+	rctx, cancel := recordContext()
+	defer cancel()
+	// The record is read again if it changed since it was fetched, the items of the notification and hosted cluster
+	// may have been pruned in the meantime
+	err = h.updateRecordStatus(rctx, mfnr, func(mfnr *oav1alpha1.ManagedFleetNotificationRecord) error {
+		err := ensureRecordItem(mfnr, fn, hcID)
+		if err != nil {
+			return err
+		}
+		_, err = mfnr.UpdateNotificationRecordItem(fn.Name, hcID)
+		return err
+	})
 	if err != nil {
-		log.WithFields(log.Fields{LogFieldNotificationName: fn.Name, LogFieldManagedNotification: mfn.Name}).WithError(err).Error("unable to update notification status on cluster")
+		log.WithFields(logrus.Fields{LogFieldNotificationName: fn.Name, LogFieldManagedNotification: mfn.Name}).WithError(err).Error("unable to update notification status on cluster")
 		return err
 	}
+	h.endServiceLog(rctx, mfnr, intent)
 	return nil
 }
 
 // create ManagedFleetNotificationRecord
-func (h *WebhookRHOBSReceiverHandler) createManagedFleetNotificationRecord(mcID string) (*oav1alpha1.ManagedFleetNotificationRecord, error) {
+func (h *WebhookRHOBSReceiverHandler) createManagedFleetNotificationRecord(ctx context.Context, name, mcID string) (*oav1alpha1.ManagedFleetNotificationRecord, error) {
 	mfnr := &oav1alpha1.ManagedFleetNotificationRecord{
 		ObjectMeta: v1.ObjectMeta{
-			Name:      mcID,
+			Name:      name,
 			Namespace: OCMAgentNamespaceName,
 		},
 		Status: oav1alpha1.ManagedFleetNotificationRecordStatus{
@@ -220,7 +387,7 @@ func (h *WebhookRHOBSReceiverHandler) createManagedFleetNotificationRecord(mcID
 			NotificationRecordByName: nil,
 		},
 	}
-	err := h.c.Create(context.Background(), mfnr)
+	err := h.c.Create(ctx, mfnr)
 	if err != nil {
 		return nil, err
 	}
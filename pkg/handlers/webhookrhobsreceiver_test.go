@@ -2,6 +2,10 @@ package handlers
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -11,6 +15,7 @@ import (
 	"github.com/prometheus/alertmanager/template"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -18,11 +23,30 @@ import (
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/openshift/ocm-agent/pkg/audit"
 	testconst "github.com/openshift/ocm-agent/pkg/consts/test"
 	webhookreceivermock "github.com/openshift/ocm-agent/pkg/handlers/mocks"
+	"github.com/openshift/ocm-agent/pkg/ocm"
+	"github.com/openshift/ocm-agent/pkg/sink"
+	sinkmocks "github.com/openshift/ocm-agent/pkg/sink/mocks"
+	"github.com/openshift/ocm-agent/pkg/suppression"
 	clientmocks "github.com/openshift/ocm-agent/pkg/util/test/generated/mocks/client"
 )
 
+// fleetServiceLogRequest returns the service log request of the firing alert for the fleet notification
+func fleetServiceLogRequest(fn oav1alpha1.FleetNotification, alert template.Alert) ocm.ServiceLogRequest {
+	return ocm.ServiceLogRequest{
+		ClusterID:     testconst.TestHostedClusterID,
+		Summary:       fn.Summary,
+		FiringDesc:    fn.NotificationMessage,
+		Severity:      fn.Severity,
+		LogType:       fn.LogType,
+		References:    fn.References,
+		Firing:        true,
+		EventStreamID: eventStreamID(testconst.TestHostedClusterID, fn.Name, alert),
+	}
+}
+
 var _ = Describe("RHOBS Webhook Handlers", func() {
 
 	var (
@@ -72,12 +96,12 @@ var _ = Describe("RHOBS Webhook Handlers", func() {
 							return nil
 						}),
 					// Send the SL
-					mockOCMClient.EXPECT().SendServiceLog(testFN.Summary, testFN.NotificationMessage, "", testconst.TestHostedClusterID, gomock.Any(), gomock.Any(), gomock.Any(), true),
+					mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Eq(fleetServiceLogRequest(testFN, testAlert))),
 					mockClient.EXPECT().Status().Return(mockStatusWriter),
 					mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
 				)
 
-				err := testHandler.processAlert(testAlert, testMFN)
+				err := testHandler.processAlert(testconst.Context, testAlert, testMFN)
 				Expect(err).ShouldNot(HaveOccurred())
 			})
 		})
@@ -96,12 +120,12 @@ var _ = Describe("RHOBS Webhook Handlers", func() {
 						mockClient.EXPECT().Status().Return(mockStatusWriter),
 						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
 						// Send the SL
-						mockOCMClient.EXPECT().SendServiceLog(testFN.Summary, testFN.NotificationMessage, "", testconst.TestHostedClusterID, gomock.Any(), gomock.Any(), gomock.Any(), true),
+						mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Eq(fleetServiceLogRequest(testFN, testAlert))),
 						mockClient.EXPECT().Status().Return(mockStatusWriter),
 						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
 					)
 
-					err := testHandler.processAlert(testAlert, testMFN)
+					err := testHandler.processAlert(testconst.Context, testAlert, testMFN)
 					Expect(err).ShouldNot(HaveOccurred())
 				})
 			})
@@ -110,14 +134,34 @@ var _ = Describe("RHOBS Webhook Handlers", func() {
 					// Fetch the MFNR
 					mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR),
 					// Send the SL
-					mockOCMClient.EXPECT().SendServiceLog(testFN.Summary, testFN.NotificationMessage, "", testconst.TestHostedClusterID, gomock.Any(), gomock.Any(), gomock.Any(), true),
+					mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Eq(fleetServiceLogRequest(testFN, testAlert))),
 					mockClient.EXPECT().Status().Return(mockStatusWriter),
 					mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
 				)
 
-				err := testHandler.processAlert(testAlert, testMFN)
+				err := testHandler.processAlert(testconst.Context, testAlert, testMFN)
 				Expect(err).ShouldNot(HaveOccurred())
 			})
+			Context("When the notification only selects a sink", func() {
+				It("Delivers to the sink instead of sending a SL", func() {
+					mockSink := sinkmocks.NewMockSink(mockCtrl)
+					sinks := sink.NewRegistry()
+					sinks.Register("internal", sink.TypeSlack, mockSink, 0, sink.DefaultDeliveryTimeout)
+					testHandler.WithSinks(sinks)
+					testMFN.Annotations = map[string]string{AnnotationSinks: `{"` + testFN.Name + `":["internal"]}`}
+					gomock.InOrder(
+						// Fetch the MFNR
+						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR),
+						// Deliver to the sink
+						mockSink.EXPECT().Send(gomock.Any(), newSinkMessage(testFN.Name, testconst.TestHostedClusterID, testFN.Summary, testFN.NotificationMessage, "", testFN.Severity, true)).Return(nil),
+						mockClient.EXPECT().Status().Return(mockStatusWriter),
+						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+					)
+
+					err := testHandler.processAlert(testconst.Context, testAlert, testMFN)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+			})
 			Context("When a notification record doesn't exist", func() {
 				It("Creates one", func() {
 					// Let's add a notification record, but named differently to the one we want,
@@ -133,7 +177,7 @@ var _ = Describe("RHOBS Webhook Handlers", func() {
 						// Fetch the MFNR
 						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR),
 						// Send the SL
-						mockOCMClient.EXPECT().SendServiceLog(testFN.Summary, testFN.NotificationMessage, "", testconst.TestHostedClusterID, gomock.Any(), gomock.Any(), gomock.Any(), true),
+						mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Eq(fleetServiceLogRequest(testFN, testAlert))),
 						mockClient.EXPECT().Status().Return(mockStatusWriter),
 						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
 							func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, co ...client.UpdateOptions) error {
@@ -143,7 +187,7 @@ var _ = Describe("RHOBS Webhook Handlers", func() {
 								return nil
 							}),
 					)
-					err := testHandler.processAlert(testAlert, testMFN)
+					err := testHandler.processAlert(testconst.Context, testAlert, testMFN)
 					Expect(err).ShouldNot(HaveOccurred())
 				})
 			})
@@ -167,7 +211,7 @@ var _ = Describe("RHOBS Webhook Handlers", func() {
 						// Fetch the MFNR
 						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR),
 						// Send the SL
-						mockOCMClient.EXPECT().SendServiceLog(testFN.Summary, testFN.NotificationMessage, "", testconst.TestHostedClusterID, gomock.Any(), gomock.Any(), gomock.Any(), true),
+						mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Eq(fleetServiceLogRequest(testFN, testAlert))),
 						mockClient.EXPECT().Status().Return(mockStatusWriter),
 						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
 							func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, co ...client.UpdateOptions) error {
@@ -177,7 +221,35 @@ var _ = Describe("RHOBS Webhook Handlers", func() {
 								return nil
 							}),
 					)
-					err := testHandler.processAlert(testAlert, testMFN)
+					err := testHandler.processAlert(testconst.Context, testAlert, testMFN)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+				It("Escalates the severity once the item counts the service logs of the escalation", func() {
+					testMFN.Annotations = map[string]string{AnnotationSeverity: `{"` + testFN.Name + `": {"escalation": {"afterResends": 2, "severity": "Fatal"}}}`}
+					testMFNR.Status.NotificationRecordByName = []oav1alpha1.NotificationRecordByName{
+						{
+							NotificationName: testconst.TestNotificationName,
+							ResendWait:       24,
+							NotificationRecordItems: []oav1alpha1.NotificationRecordItem{
+								{
+									HostedClusterID:     testconst.TestHostedClusterID,
+									ServiceLogSentCount: 2,
+									LastTransitionTime:  testTime,
+								},
+							},
+						},
+					}
+					escalated := fleetServiceLogRequest(testFN, testAlert)
+					escalated.Severity = oav1alpha1.SeverityFatal
+					gomock.InOrder(
+						// Fetch the MFNR
+						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR),
+						// Send the SL
+						mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Eq(escalated)),
+						mockClient.EXPECT().Status().Return(mockStatusWriter),
+						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+					)
+					err := testHandler.processAlert(testconst.Context, testAlert, testMFN)
 					Expect(err).ShouldNot(HaveOccurred())
 				})
 			})
@@ -194,7 +266,7 @@ var _ = Describe("RHOBS Webhook Handlers", func() {
 						// Fetch the MFNR
 						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR),
 						// Send the SL
-						mockOCMClient.EXPECT().SendServiceLog(testFN.Summary, testFN.NotificationMessage, "", testconst.TestHostedClusterID, gomock.Any(), gomock.Any(), gomock.Any(), true),
+						mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Eq(fleetServiceLogRequest(testFN, testAlert))),
 						mockClient.EXPECT().Status().Return(mockStatusWriter),
 						mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
 							func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, co ...client.UpdateOptions) error {
@@ -203,7 +275,7 @@ var _ = Describe("RHOBS Webhook Handlers", func() {
 								return nil
 							}),
 					)
-					err := testHandler.processAlert(testAlert, testMFN)
+					err := testHandler.processAlert(testconst.Context, testAlert, testMFN)
 					Expect(err).ShouldNot(HaveOccurred())
 				})
 			})
@@ -228,10 +300,356 @@ var _ = Describe("RHOBS Webhook Handlers", func() {
 						mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR),
 					)
 
-					err := testHandler.processAlert(testAlert, testMFN)
+					recorder := record.NewFakeRecorder(1)
+					testHandler.WithEventRecorder(recorder)
+					err := testHandler.processAlert(testconst.Context, testAlert, testMFN)
 					Expect(err).ShouldNot(HaveOccurred())
+					Expect(<-recorder.Events).To(HavePrefix("Normal " + EventReasonServiceLogSuppressed))
 				})
 			})
 		})
 	})
+
+	Context("When an alert does not name its template", func() {
+		It("Does not route it by the matchers of the ManagedFleetNotifications", func() {
+			testMFN.Annotations = map[string]string{AnnotationMatchers: `{"test-notification": ["alertname=\"TestAlertName\""]}`}
+			delete(testAlert.Labels, AMLabelTemplateName)
+			testAlert.Status = "firing"
+			// No template is fetched, nothing happens
+			response := testHandler.processAMReceiver(AMReceiverData{Alerts: template.Alerts{testAlert}}, context.Background())
+			Expect(response.Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	Context("When a suppression rule matches an alert", func() {
+		var suppressor *suppression.Suppressor
+
+		BeforeEach(func() {
+			path := filepath.Join(GinkgoT().TempDir(), "suppression.yaml")
+			Expect(os.WriteFile(path, []byte("rules:\n- name: maintenance\n  matchers: ['alertname=\"TestAlertName\"']\n"), 0600)).To(Succeed())
+			var err error
+			suppressor, err = suppression.NewSuppressor(path, time.Hour)
+			Expect(err).ToNot(HaveOccurred())
+			testHandler.WithSuppression(suppressor)
+			testAlert.Status = "firing"
+		})
+
+		It("Does not notify the firing alert until the rule no longer suppresses it", func() {
+			gomock.InOrder(
+				// Fetch the MFN, nothing else happens
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFN),
+			)
+			response := testHandler.processAMReceiver(AMReceiverData{Alerts: template.Alerts{testAlert}}, context.Background())
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(suppressor.Pending()).To(Equal(1))
+		})
+		It("Forgets the suppressed alert once it is resolved", func() {
+			mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFN)
+			testHandler.processAMReceiver(AMReceiverData{Alerts: template.Alerts{testAlert}}, context.Background())
+			Expect(suppressor.Pending()).To(Equal(1))
+
+			resolvedAlert := testAlert
+			resolvedAlert.Status = "resolved"
+			response := testHandler.processAMReceiver(AMReceiverData{Alerts: template.Alerts{resolvedAlert}}, context.Background())
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(suppressor.Pending()).To(Equal(0))
+		})
+	})
+
+	Context("When the template of an alert can't be fetched", func() {
+		var otherAlert template.Alert
+
+		BeforeEach(func() {
+			otherAlert = testconst.NewTestAlert(false, true)
+			otherAlert.Labels[AMLabelTemplateName] = "missing-template"
+			otherAlert.Status = "firing"
+			testAlert.Status = "firing"
+			// The other alert is not valid, nothing happens once its template is fetched
+			delete(testAlert.Labels, AMLabelAlertSourceName)
+		})
+
+		It("Processes the other alerts of the request when the template does not exist", func() {
+			gomock.InOrder(
+				mockClient.EXPECT().Get(gomock.Any(), client.ObjectKey{Namespace: OCMAgentNamespaceName, Name: "missing-template"}, gomock.Any()).Return(
+					errors.NewNotFound(schema.GroupResource{Group: oav1alpha1.GroupVersion.Group, Resource: "ManagedFleetNotification"}, "missing-template")),
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFN),
+			)
+			auditBackend := &testAuditBackend{}
+			audit.SetBackends(auditBackend)
+			defer audit.SetBackends()
+
+			response := testHandler.processAMReceiver(AMReceiverData{Alerts: template.Alerts{otherAlert, testAlert}}, context.Background())
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(auditBackend.records).To(HaveLen(1))
+			Expect(auditBackend.records[0].Outcome).To(Equal(audit.OutcomeTemplateNotFound))
+			Expect(auditBackend.records[0].Template).To(Equal("missing-template"))
+			Expect(auditBackend.records[0].ClusterID).To(Equal(testconst.TestHostedClusterID))
+		})
+
+		It("Processes the other alerts of the request and asks for a retry when the template can't be fetched", func() {
+			gomock.InOrder(
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("a fake error")),
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFN),
+			)
+			response := testHandler.processAMReceiver(AMReceiverData{Alerts: template.Alerts{otherAlert, testAlert}}, context.Background())
+			Expect(response.Code).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+
+	Context("When verifying the hosted cluster of an alert", func() {
+		var mockValidator *webhookreceivermock.MockHostedClusterValidator
+
+		BeforeEach(func() {
+			mockValidator = webhookreceivermock.NewMockHostedClusterValidator(mockCtrl)
+			testHandler.WithHostedClusterValidator(mockValidator)
+		})
+
+		It("Accepts a hosted cluster of the management cluster", func() {
+			mockValidator.EXPECT().ValidateHostedCluster(gomock.Any(), testconst.TestManagedClusterID, testconst.TestHostedClusterID).Return(nil)
+			known, err := testHandler.isKnownCluster(testconst.Context, testAlert, &testMFN)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(known).To(BeTrue())
+		})
+		It("Does not notify a hosted cluster unknown to OCM", func() {
+			mockValidator.EXPECT().ValidateHostedCluster(gomock.Any(), testconst.TestManagedClusterID, testconst.TestHostedClusterID).Return(fmt.Errorf("hosted cluster: %w", ocm.ErrClusterNotFound))
+			gomock.InOrder(
+				// Fetch the MFN, nothing else happens
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFN),
+			)
+			auditBackend := &testAuditBackend{}
+			audit.SetBackends(auditBackend)
+			defer audit.SetBackends()
+
+			testAlert.Status = "firing"
+			response := testHandler.processAMReceiver(AMReceiverData{Alerts: template.Alerts{testAlert}}, context.Background())
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(auditBackend.records).To(HaveLen(1))
+			Expect(auditBackend.records[0].Outcome).To(Equal(audit.OutcomeUnknownCluster))
+			Expect(auditBackend.records[0].ClusterID).To(Equal(testconst.TestHostedClusterID))
+		})
+		It("Does not notify a hosted cluster of another management cluster", func() {
+			mockValidator.EXPECT().ValidateHostedCluster(gomock.Any(), testconst.TestManagedClusterID, testconst.TestHostedClusterID).Return(fmt.Errorf("hosted cluster: %w", ocm.ErrNotInManagementCluster))
+			known, err := testHandler.isKnownCluster(testconst.Context, testAlert, &testMFN)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(known).To(BeFalse())
+		})
+		It("Asks for a retry when the hosted cluster can't be verified", func() {
+			mockValidator.EXPECT().ValidateHostedCluster(gomock.Any(), testconst.TestManagedClusterID, testconst.TestHostedClusterID).Return(fmt.Errorf("a fake error"))
+			gomock.InOrder(
+				// Fetch the MFN, nothing else happens
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFN),
+			)
+			auditBackend := &testAuditBackend{}
+			audit.SetBackends(auditBackend)
+			defer audit.SetBackends()
+
+			testAlert.Status = "firing"
+			response := testHandler.processAMReceiver(AMReceiverData{Alerts: template.Alerts{testAlert}}, context.Background())
+			Expect(response.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(auditBackend.records).To(BeEmpty())
+		})
+	})
+
+	Context("When the record changed since it was fetched", func() {
+		It("Updates the latest version of the record", func() {
+			conflict := errors.NewConflict(schema.GroupResource{Group: oav1alpha1.GroupVersion.Group, Resource: "ManagedFleetNotificationRecord"},
+				testconst.TestManagedClusterID, fmt.Errorf("the object has been modified"))
+			// The record was pruned by the record collector in the meantime
+			latestMFNR := testconst.NewManagedFleetNotificationRecord()
+			latestMFNR.ResourceVersion = "2"
+			gomock.InOrder(
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFNR),
+				mockOCMClient.EXPECT().SendServiceLog(gomock.Any(), gomock.Any()),
+				mockClient.EXPECT().Status().Return(mockStatusWriter),
+				mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).Return(conflict),
+				mockClient.EXPECT().Get(gomock.Any(), client.ObjectKey{Namespace: OCMAgentNamespaceName, Name: testconst.TestManagedClusterID}, gomock.Any()).Return(nil).SetArg(2, latestMFNR),
+				mockClient.EXPECT().Status().Return(mockStatusWriter),
+				mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, opts ...client.SubResourceUpdateOption) error {
+						Expect(mfnr.ResourceVersion).To(Equal("2"))
+						item, err := mfnr.GetNotificationRecordItem(testconst.TestManagedClusterID, testconst.TestNotificationName, testconst.TestHostedClusterID)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(item.ServiceLogSentCount).To(Equal(1))
+						return nil
+					}),
+			)
+			err := testHandler.processAlert(testconst.Context, testAlert, testMFN)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("When alerts of the same management cluster are handled concurrently", func() {
+		It("Handles them one at a time", func() {
+			var locks keyedMutex
+			unlock := locks.lock(testconst.TestManagedClusterID)
+			locked := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				unlockOther := locks.lock(testconst.TestManagedClusterID)
+				close(locked)
+				unlockOther()
+			}()
+			// Another management cluster is not blocked
+			locks.lock("other-management-cluster-id")()
+			Consistently(locked, 100*time.Millisecond).ShouldNot(BeClosed())
+			unlock()
+			Eventually(locked).Should(BeClosed())
+		})
+		It("Forgets the keys which are no longer locked", func() {
+			var locks keyedMutex
+			unlock := locks.lock(testconst.TestManagedClusterID)
+			waiting := make(chan struct{})
+			unlocked := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				close(waiting)
+				locks.lock(testconst.TestManagedClusterID)()
+				close(unlocked)
+			}()
+			<-waiting
+			unlock()
+			Eventually(unlocked).Should(BeClosed())
+			locks.mutex.Lock()
+			defer locks.mutex.Unlock()
+			Expect(locks.locks).To(BeEmpty())
+		})
+	})
+
+	Context("When the records are sharded", func() {
+		var (
+			shardName  string
+			legacyMFNR oav1alpha1.ManagedFleetNotificationRecord
+		)
+		BeforeEach(func() {
+			testHandler.WithRecordShards(4)
+			shardName = fleetRecordName(testconst.TestManagedClusterID, testconst.TestHostedClusterID, 4)
+			legacyMFNR = testconst.NewManagedFleetNotificationRecord()
+			legacyMFNR.Status.NotificationRecordByName = []oav1alpha1.NotificationRecordByName{
+				{
+					NotificationName: testconst.TestNotificationName,
+					ResendWait:       24,
+					NotificationRecordItems: []oav1alpha1.NotificationRecordItem{
+						{HostedClusterID: "another-hosted-cluster-id", ServiceLogSentCount: 1, LastTransitionTime: &metav1.Time{Time: time.Now()}},
+						{HostedClusterID: testconst.TestHostedClusterID, ServiceLogSentCount: 3, LastTransitionTime: &metav1.Time{Time: time.Now().Add(-10 * time.Minute)}},
+					},
+				},
+			}
+		})
+		It("Names the shards after the management cluster", func() {
+			Expect(shardName).To(HavePrefix(testconst.TestManagedClusterID + "-shard-"))
+			Expect(fleetRecordName(testconst.TestManagedClusterID, testconst.TestHostedClusterID, 4)).To(Equal(shardName))
+			Expect(fleetRecordName(testconst.TestManagedClusterID, testconst.TestHostedClusterID, 1)).To(Equal(testconst.TestManagedClusterID))
+		})
+		listRecords := func(records ...oav1alpha1.ManagedFleetNotificationRecord) *gomock.Call {
+			return mockClient.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, list *oav1alpha1.ManagedFleetNotificationRecordList, opts ...client.ListOption) error {
+					list.Items = records
+					return nil
+				})
+		}
+		It("Migrates the record items to their shard", func() {
+			otherShard := fleetRecordName(testconst.TestManagedClusterID, "another-hosted-cluster-id", 4)
+			Expect(otherShard).ToNot(Equal(shardName))
+			updated := map[string]*oav1alpha1.ManagedFleetNotificationRecord{}
+			listRecords(legacyMFNR)
+			// Each shard is created and saved with its items, then the items are removed from the single record
+			mockClient.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+			mockClient.EXPECT().Status().Return(mockStatusWriter).Times(3)
+			mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, opts ...client.SubResourceUpdateOption) error {
+					updated[mfnr.Name] = mfnr.DeepCopy()
+					return nil
+				}).Times(3)
+			err := testHandler.ensureRecordsMigrated(testconst.Context)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			// The items are saved in their shard with their resend state
+			item, err := updated[shardName].GetNotificationRecordItem(testconst.TestManagedClusterID, testconst.TestNotificationName, testconst.TestHostedClusterID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(item.ServiceLogSentCount).To(Equal(3))
+			Expect(updated[otherShard].HasNotificationRecordItem(testconst.TestManagedClusterID, testconst.TestNotificationName, "another-hosted-cluster-id")).To(BeTrue())
+			// and removed from the single record
+			Expect(updated[testconst.TestManagedClusterID].Status.NotificationRecordByName[0].NotificationRecordItems).To(BeEmpty())
+
+			// The records are migrated once
+			err = testHandler.ensureRecordsMigrated(testconst.Context)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("Migrates the record items back to a single record", func() {
+			testHandler.WithRecordShards(1)
+			shardMFNR := legacyMFNR.DeepCopy()
+			shardMFNR.Name = shardName
+			shardMFNR.Status.NotificationRecordByName[0].NotificationRecordItems = shardMFNR.Status.NotificationRecordByName[0].NotificationRecordItems[1:]
+			singleMFNR := testconst.NewManagedFleetNotificationRecord()
+			singleMFNR.Status.NotificationRecordByName = []oav1alpha1.NotificationRecordByName{}
+			listRecords(singleMFNR, *shardMFNR)
+			gomock.InOrder(
+				// Save the single record with the item
+				mockClient.EXPECT().Status().Return(mockStatusWriter),
+				mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, opts ...client.SubResourceUpdateOption) error {
+						Expect(mfnr.Name).To(Equal(testconst.TestManagedClusterID))
+						item, err := mfnr.GetNotificationRecordItem(testconst.TestManagedClusterID, testconst.TestNotificationName, testconst.TestHostedClusterID)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(item.ServiceLogSentCount).To(Equal(3))
+						return nil
+					}),
+				// Remove the item from the shard
+				mockClient.EXPECT().Status().Return(mockStatusWriter),
+				mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, opts ...client.SubResourceUpdateOption) error {
+						Expect(mfnr.Name).To(Equal(shardName))
+						Expect(mfnr.HasNotificationRecordItem(testconst.TestManagedClusterID, testconst.TestNotificationName, testconst.TestHostedClusterID)).To(BeFalse())
+						return nil
+					}),
+			)
+			err := testHandler.ensureRecordsMigrated(testconst.Context)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("Keeps the item already in the shard", func() {
+			shardMFNR := testconst.NewManagedFleetNotificationRecord()
+			shardMFNR.Name = shardName
+			shardMFNR.Status.NotificationRecordByName = []oav1alpha1.NotificationRecordByName{
+				{
+					NotificationName: testconst.TestNotificationName,
+					ResendWait:       24,
+					NotificationRecordItems: []oav1alpha1.NotificationRecordItem{
+						{HostedClusterID: testconst.TestHostedClusterID, ServiceLogSentCount: 5, LastTransitionTime: &metav1.Time{Time: time.Now()}},
+					},
+				},
+			}
+			legacyMFNR.Status.NotificationRecordByName[0].NotificationRecordItems = legacyMFNR.Status.NotificationRecordByName[0].NotificationRecordItems[1:]
+			listRecords(legacyMFNR, shardMFNR)
+			gomock.InOrder(
+				mockClient.EXPECT().Status().Return(mockStatusWriter),
+				mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, mfnr *oav1alpha1.ManagedFleetNotificationRecord, opts ...client.SubResourceUpdateOption) error {
+						Expect(mfnr.Name).To(Equal(shardName))
+						item, err := mfnr.GetNotificationRecordItem(testconst.TestManagedClusterID, testconst.TestNotificationName, testconst.TestHostedClusterID)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(item.ServiceLogSentCount).To(Equal(5))
+						return nil
+					}),
+				mockClient.EXPECT().Status().Return(mockStatusWriter),
+				mockStatusWriter.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil),
+			)
+			err := testHandler.ensureRecordsMigrated(testconst.Context)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("Asks for a retry and migrates again when the records can't be listed", func() {
+			gomock.InOrder(
+				// Fetch the MFN, no record is read
+				mockClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).SetArg(2, testMFN),
+				mockClient.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("a fake error")),
+			)
+			testAlert.Status = "firing"
+			response := testHandler.processAMReceiver(AMReceiverData{Alerts: template.Alerts{testAlert}}, context.Background())
+			Expect(response.Code).To(Equal(http.StatusServiceUnavailable))
+
+			// The next alert migrates the records
+			listRecords()
+			err := testHandler.ensureRecordsMigrated(testconst.Context)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
 })
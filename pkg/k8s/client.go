@@ -3,9 +3,17 @@ package k8s
 import (
 	oav1alpha1 "github.com/openshift/ocm-agent-operator/api/v1alpha1"
 
+	"github.com/openshift/ocm-agent/pkg/consts"
+	"github.com/openshift/ocm-agent/pkg/logging"
+	"github.com/sirupsen/logrus"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -13,22 +21,59 @@ import (
 const GroupName = "ocmagent.managed.openshift.io"
 const GroupVersion = "v1alpha1"
 
+// EventSourceComponent is the component events recorded by OCM Agent are attributed to
+const EventSourceComponent = "ocm-agent"
+
 var SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: GroupVersion}
 
+var log = logging.Subsystem(logging.SubsystemK8s)
+
 // NewClient builds and returns a k8s client or error if the client can't be configured
 func NewClient() (client.Client, error) {
 	cfg, err := ctrl.GetConfig()
 	if err != nil {
 		return nil, err
 	}
-	scheme := runtime.NewScheme()
-	_ = addKnownTypes(scheme)
+	log.WithField("Host", cfg.Host).Debug("Creating k8s client")
+	// Requests are also bounded by the context of the alert they are made for
+	cfg.Timeout = consts.KubernetesRequestTimeout
 	c, err := client.New(cfg, client.Options{
-		Scheme: scheme,
+		Scheme: newScheme(),
 	})
 	return c, err
 }
 
+// NewEventRecorder builds an event recorder attributing events to OCM Agent, or returns error if
+// the underlying clientset can't be configured
+func NewEventRecorder() (record.EventRecorder, error) {
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// The correlator aggregates similar events and drops bursts per object so a noisy alert can't flood etcd
+	broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
+		BurstSize:            consts.EventBurstSize,
+		QPS:                  consts.EventQPS,
+		MaxEvents:            consts.EventAggregationMaxEvents,
+		MaxIntervalInSeconds: consts.EventAggregationIntervalSeconds,
+	})
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	broadcaster.StartEventWatcher(func(e *corev1.Event) {
+		log.WithFields(logrus.Fields{"Object": e.InvolvedObject.Name, "Reason": e.Reason}).Debug(e.Message)
+	})
+	return broadcaster.NewRecorder(newScheme(), corev1.EventSource{Component: EventSourceComponent}), nil
+}
+
+func newScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = addKnownTypes(scheme)
+	return scheme
+}
+
 func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&oav1alpha1.ManagedNotification{},
@@ -0,0 +1,84 @@
+package k8s
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/openshift/ocm-agent/pkg/consts"
+)
+
+// LeaderElector elects a single leader among the replicas of OCM Agent with a Lease
+type LeaderElector struct {
+	identity string
+	config   leaderelection.LeaderElectionConfig
+	leading  atomic.Bool
+}
+
+// NewLeaderElector returns an elector campaigning for the Lease of the given namespace and name under the identity,
+// usually the name of the pod. onStartedLeading is run in its own goroutine each time the leadership is acquired,
+// its context is cancelled when the leadership is lost.
+func NewLeaderElector(namespace, name, identity string, onStartedLeading func(ctx context.Context)) (*LeaderElector, error) {
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, namespace, name, clientset.CoreV1(), clientset.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: identity})
+	if err != nil {
+		return nil, err
+	}
+
+	l := &LeaderElector{identity: identity}
+	l.config = leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   consts.LeaderElectionLeaseDuration,
+		RenewDeadline:   consts.LeaderElectionRenewDeadline,
+		RetryPeriod:     consts.LeaderElectionRetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.WithField("Identity", identity).Info("Started leading")
+				l.leading.Store(true)
+				if onStartedLeading != nil {
+					onStartedLeading(ctx)
+				}
+			},
+			OnStoppedLeading: func() {
+				log.WithField("Identity", identity).Info("Stopped leading")
+				l.leading.Store(false)
+			},
+			OnNewLeader: func(leader string) {
+				log.WithFields(logrus.Fields{"Identity": identity, "Leader": leader}).Info("New leader elected")
+			},
+		},
+	}
+	return l, nil
+}
+
+// Run campaigns for the leadership until the context is done, the leadership is campaigned for again when it is lost
+func (l *LeaderElector) Run(ctx context.Context) error {
+	elector, err := leaderelection.NewLeaderElector(l.config)
+	if err != nil {
+		return err
+	}
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+	return nil
+}
+
+// IsLeader returns whether the process currently holds the leadership
+func (l *LeaderElector) IsLeader() bool {
+	return l.leading.Load()
+}
@@ -1,15 +1,44 @@
 package logging
 
 import (
+	"fmt"
 	"os"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// SubsystemServe is the logger used by the serve command itself
+	SubsystemServe = "serve"
+	// SubsystemHandlers is the logger used by the webhook and probe handlers
+	SubsystemHandlers = "handlers"
+	// SubsystemOCM is the logger used when talking to OCM
+	SubsystemOCM = "ocm"
+	// SubsystemK8s is the logger used when talking to the Kubernetes API
+	SubsystemK8s = "k8s"
+)
+
 var (
 	DebugLogLevel = logrus.DebugLevel
+
+	// baseLevel is the level every subsystem reverts to once a runtime override expires
+	baseLevel = logrus.InfoLevel
+
+	mutex      sync.Mutex
+	subsystems = map[string]*logrus.Logger{}
+	overrides  = map[string]*time.Timer{}
+	generation = map[string]uint64{}
 )
 
+func init() {
+	for _, name := range []string{SubsystemServe, SubsystemHandlers, SubsystemOCM, SubsystemK8s} {
+		subsystems[name] = NewLogger()
+	}
+}
+
 // NewLogger initializes logging with Info level logging as default
 func NewLogger() (logger *logrus.Logger) {
 	logger = &logrus.Logger{
@@ -23,3 +52,94 @@ func NewLogger() (logger *logrus.Logger) {
 	})
 	return logger
 }
+
+// Subsystem returns the shared logger for the named subsystem. Unknown names fall back to
+// the serve logger so that a typo never results in a nil logger.
+func Subsystem(name string) *logrus.Logger {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if l, ok := subsystems[name]; ok {
+		return l
+	}
+	return subsystems[SubsystemServe]
+}
+
+// Subsystems returns the sorted names of all subsystems whose level can be changed
+func Subsystems() []string {
+	mutex.Lock()
+	defer mutex.Unlock()
+	names := make([]string, 0, len(subsystems))
+	for name := range subsystems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetBaseLevel sets the level of every subsystem and the level they revert to after a runtime override
+func SetBaseLevel(level logrus.Level) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	baseLevel = level
+	for name, l := range subsystems {
+		if _, overridden := overrides[name]; !overridden {
+			l.SetLevel(level)
+		}
+	}
+}
+
+// SetLevel changes the level of a single subsystem, or of all subsystems if subsystem is empty.
+// The change is reverted to the base level once ttl has elapsed.
+func SetLevel(subsystem string, level logrus.Level, ttl time.Duration) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var names []string
+	if subsystem == "" {
+		for name := range subsystems {
+			names = append(names, name)
+		}
+	} else {
+		if _, ok := subsystems[subsystem]; !ok {
+			return fmt.Errorf("unknown log subsystem %s", subsystem)
+		}
+		names = []string{subsystem}
+	}
+
+	for _, name := range names {
+		if t, ok := overrides[name]; ok {
+			t.Stop()
+		}
+		subsystems[name].SetLevel(level)
+		generation[name]++
+		name, gen := name, generation[name]
+		overrides[name] = time.AfterFunc(ttl, func() {
+			revertLevel(name, gen)
+		})
+	}
+	return nil
+}
+
+// Levels returns the current level of every subsystem
+func Levels() map[string]string {
+	mutex.Lock()
+	defer mutex.Unlock()
+	levels := make(map[string]string, len(subsystems))
+	for name, l := range subsystems {
+		levels[name] = l.GetLevel().String()
+	}
+	return levels
+}
+
+// revertLevel restores a subsystem to the base level once its override has expired. An override
+// that was replaced before its timer could be stopped is identified by its generation and ignored.
+func revertLevel(name string, gen uint64) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if generation[name] != gen {
+		return
+	}
+	delete(overrides, name)
+	subsystems[name].SetLevel(baseLevel)
+	subsystems[SubsystemServe].WithField("subsystem", name).Infof("Log level override expired, reverted to %s", baseLevel)
+}
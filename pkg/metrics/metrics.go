@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/openshift/ocm-agent/pkg/consts"
@@ -51,6 +52,91 @@ var (
 			Help: "A total number of service log being sent based on managedNotification template",
 		}, []string{"ocm_service", "template"})
 
+	metricSinkDelivery = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ocm_agent_sink_delivery_total",
+			Help: "A count of notifications delivered to a sink by outcome",
+		}, []string{"sink", "type", "outcome"})
+
+	MetricSinkFailure = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ocm_agent_sink_failure",
+			Help: "Indicates that the last delivery to a sink failed after all retries",
+		}, []string{"sink"})
+
+	metricOCMRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ocm_agent_ocm_requests_total",
+			Help: "A count of requests sent to OCM by method, path and response code",
+		}, []string{"method", "path", "code"})
+
+	metricOCMRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "ocm_agent_ocm_request_duration_seconds",
+			Help:    "The duration of the requests sent to OCM by method and path",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "path"})
+
+	metricTemplateNotFound = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ocm_agent_template_not_found_total",
+			Help: "A count of alerts not notified as their notification template does not exist",
+		}, []string{"template"})
+
+	metricAmbiguousAlert = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ocm_agent_ambiguous_alert_total",
+			Help: "A count of alerts not notified as they match the matchers of several notifications",
+		}, []string{"alertname"})
+
+	metricAlertSuppressed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ocm_agent_alert_suppressed_total",
+			Help: "A count of firing alerts not notified as a suppression rule was active by template and rule",
+		}, []string{"template", "rule"})
+
+	MetricSuppressedAlertsPending = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ocm_agent_suppressed_alerts_pending",
+			Help: "The number of suppressed alerts waiting to be notified once no suppression rule is active",
+		})
+
+	metricNotificationOptedOut = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ocm_agent_notification_opted_out_total",
+			Help: "A count of notifications not sent as the preferences of their cluster disable them by template and reason",
+		}, []string{"template", "reason"})
+
+	metricUnknownCluster = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ocm_agent_unknown_cluster_total",
+			Help: "A count of alerts not notified as their cluster is unknown to OCM or managed by another management cluster",
+		}, []string{"template", "reason"})
+
+	metricServiceLogDuplicateSkipped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ocm_agent_service_log_duplicate_skipped_total",
+			Help: "A count of service logs not sent again as OCM already held them after a failed attempt",
+		}, []string{"template"})
+
+	MetricFleetRecordItems = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ocm_agent_fleet_notification_record_items",
+			Help: "The number of hosted cluster items in a ManagedFleetNotificationRecord",
+		}, []string{"record"})
+
+	MetricFleetRecordSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ocm_agent_fleet_notification_record_size_bytes",
+			Help: "The JSON encoded size of a ManagedFleetNotificationRecord",
+		}, []string{"record"})
+
+	metricFleetRecordItemsPruned = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ocm_agent_fleet_notification_record_items_pruned_total",
+			Help: "A count of hosted cluster items pruned from the ManagedFleetNotificationRecords by reason",
+		}, []string{"reason"})
+
 	metricsList = []prometheus.Collector{
 		metricRequestsTotal,
 		metricFailedRequestsTotal,
@@ -59,6 +145,20 @@ var (
 		MetricResponseFailure,
 		metricServiceLogSent,
 		metricServiceLogSentTotal,
+		metricSinkDelivery,
+		MetricSinkFailure,
+		metricOCMRequests,
+		metricOCMRequestDuration,
+		metricTemplateNotFound,
+		metricAmbiguousAlert,
+		metricAlertSuppressed,
+		MetricSuppressedAlertsPending,
+		metricNotificationOptedOut,
+		metricUnknownCluster,
+		metricServiceLogDuplicateSkipped,
+		MetricFleetRecordItems,
+		MetricFleetRecordSize,
+		metricFleetRecordItemsPruned,
 	}
 )
 
@@ -138,6 +238,15 @@ func CountServiceLogSent(template, state string) {
 	}).Inc()
 }
 
+// CountLimitedSupportSent counts the limited support reasons placed (firing) and removed (resolved) by notification template
+func CountLimitedSupportSent(template, state string) {
+	metricServiceLogSent.With(prometheus.Labels{
+		"ocm_service": "limited_support",
+		"template":    template,
+		"state":       state,
+	}).Inc()
+}
+
 // SetTotalServiceLogCount used to set the total sent service log number based on the managedNotification status
 func SetTotalServiceLogCount(template string, count int32) {
 	metricServiceLogSentTotal.With(prometheus.Labels{
@@ -146,6 +255,105 @@ func SetTotalServiceLogCount(template string, count int32) {
 	}).Set(float64(count))
 }
 
+// CountSinkDelivery counts the notifications delivered to a sink by outcome
+func CountSinkDelivery(sink, sinkType, outcome string) {
+	metricSinkDelivery.With(prometheus.Labels{
+		"sink":    sink,
+		"type":    sinkType,
+		"outcome": outcome,
+	}).Inc()
+}
+
+// SetSinkFailure sets the metric when the delivery to a sink has failed
+func SetSinkFailure(sink string) {
+	MetricSinkFailure.With(prometheus.Labels{
+		"sink": sink,
+	}).Set(float64(1))
+}
+
+// ResetSinkFailure clears the failure metric of a sink once a delivery succeeded
+func ResetSinkFailure(sink string) {
+	MetricSinkFailure.Delete(prometheus.Labels{
+		"sink": sink,
+	})
+}
+
+// ObserveOCMRequest records a request sent to OCM, code is the response status code or "error" if none was received
+func ObserveOCMRequest(method, path, code string, duration time.Duration) {
+	metricOCMRequests.With(prometheus.Labels{
+		"method": method,
+		"path":   path,
+		"code":   code,
+	}).Inc()
+	metricOCMRequestDuration.With(prometheus.Labels{
+		"method": method,
+		"path":   path,
+	}).Observe(duration.Seconds())
+}
+
+// CountTemplateNotFound counts the alerts whose notification template does not exist
+func CountTemplateNotFound(template string) {
+	metricTemplateNotFound.With(prometheus.Labels{
+		"template": template,
+	}).Inc()
+}
+
+// CountAmbiguousAlert counts the alerts matching the matchers of several notifications
+func CountAmbiguousAlert(alertname string) {
+	metricAmbiguousAlert.With(prometheus.Labels{
+		"alertname": alertname,
+	}).Inc()
+}
+
+// CountAlertSuppressed counts the firing alerts whose notification was suppressed by template name and rule
+func CountAlertSuppressed(template, rule string) {
+	metricAlertSuppressed.With(prometheus.Labels{
+		"template": template,
+		"rule":     rule,
+	}).Inc()
+}
+
+// CountNotificationOptedOut counts the notifications disabled by the preferences of their cluster by template name,
+// reason is template, log_type or severity
+func CountNotificationOptedOut(template, reason string) {
+	metricNotificationOptedOut.With(prometheus.Labels{
+		"template": template,
+		"reason":   reason,
+	}).Inc()
+}
+
+// CountUnknownCluster counts the alerts whose cluster is unknown, reason is not_found or wrong_management_cluster
+func CountUnknownCluster(template, reason string) {
+	metricUnknownCluster.With(prometheus.Labels{
+		"template": template,
+		"reason":   reason,
+	}).Inc()
+}
+
+// CountServiceLogDuplicateSkipped counts the service logs found in OCM instead of being sent again by template name
+func CountServiceLogDuplicateSkipped(template string) {
+	metricServiceLogDuplicateSkipped.With(prometheus.Labels{
+		"template": template,
+	}).Inc()
+}
+
+// SetFleetRecordSize sets the number of items and the size in bytes of a fleet record
+func SetFleetRecordSize(record string, items, size int) {
+	MetricFleetRecordItems.With(prometheus.Labels{
+		"record": record,
+	}).Set(float64(items))
+	MetricFleetRecordSize.With(prometheus.Labels{
+		"record": record,
+	}).Set(float64(size))
+}
+
+// CountFleetRecordItemsPruned counts the items pruned from the fleet records, reason is cluster_deleted or expired
+func CountFleetRecordItemsPruned(reason string, count int) {
+	metricFleetRecordItemsPruned.With(prometheus.Labels{
+		"reason": reason,
+	}).Add(float64(count))
+}
+
 // ResetMetric reset the metric with Gauge values
 func ResetMetric(m *prometheus.GaugeVec) {
 	m.Reset()
@@ -0,0 +1,81 @@
+package ocm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type lookupCacheEntry[V any] struct {
+	value     V
+	err       error
+	expiresAt time.Time
+}
+
+// lookupCache caches the clusters looked up in OCM by ID. Found clusters are cached for the TTL, clusters which are
+// not found are cached for the negative TTL. Other errors are never cached.
+type lookupCache[V any] struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	lookup      func(ctx context.Context, id string) (V, error)
+
+	mutex   sync.Mutex
+	entries map[string]lookupCacheEntry[V]
+}
+
+func newLookupCache[V any](ttl, negativeTTL time.Duration, lookup func(ctx context.Context, id string) (V, error)) *lookupCache[V] {
+	return &lookupCache[V]{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		lookup:      lookup,
+		entries:     map[string]lookupCacheEntry[V]{},
+	}
+}
+
+// get returns the cluster with the given ID, from the cache when possible
+func (c *lookupCache[V]) get(ctx context.Context, id string) (V, error) {
+	var none V
+	if id == "" {
+		return none, fmt.Errorf("cluster ID is empty")
+	}
+	c.mutex.Lock()
+	entry, ok := c.entries[id]
+	c.mutex.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.value, entry.err
+	}
+
+	value, err := c.lookup(ctx, id)
+	switch {
+	case err == nil:
+		entry = lookupCacheEntry[V]{value: value, expiresAt: time.Now().Add(c.ttl)}
+	case errors.Is(err, ErrClusterNotFound):
+		entry = lookupCacheEntry[V]{err: err, expiresAt: time.Now().Add(c.negativeTTL)}
+	default:
+		return none, err
+	}
+	c.mutex.Lock()
+	c.entries[id] = entry
+	c.mutex.Unlock()
+	return entry.value, entry.err
+}
+
+// state returns the content of the cache by ID, the fields of a found cluster being filled by describe. It is meant
+// for the debug state endpoint.
+func (c *lookupCache[V]) state(describe func(value V, fields map[string]interface{})) map[string]interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	state := make(map[string]interface{}, len(c.entries))
+	for id, entry := range c.entries {
+		s := map[string]interface{}{"ExpiresAt": entry.expiresAt}
+		if entry.err != nil {
+			s["Error"] = entry.err.Error()
+		} else {
+			describe(entry.value, s)
+		}
+		state[id] = s
+	}
+	return state
+}
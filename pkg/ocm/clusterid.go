@@ -0,0 +1,47 @@
+package ocm
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	sdk "github.com/openshift-online/ocm-sdk-go"
+)
+
+// ErrClusterNotFound is returned when no subscription in OCM matches the external cluster ID
+var ErrClusterNotFound = errors.New("cluster not found in OCM")
+
+// ClusterIdentity holds the IDs of a cluster in OCM
+type ClusterIdentity struct {
+	ExternalID     string
+	InternalID     string
+	SubscriptionID string
+}
+
+// ClusterIDResolver resolves external cluster IDs to their OCM identity. Found clusters are cached for the TTL,
+// clusters which are not found are cached for the negative TTL. Other errors are never cached.
+type ClusterIDResolver struct {
+	cache *lookupCache[*ClusterIdentity]
+}
+
+// NewClusterIDResolver returns a resolver looking up clusters with the given connection
+func NewClusterIDResolver(conn *sdk.Connection, ttl, negativeTTL time.Duration) *ClusterIDResolver {
+	return &ClusterIDResolver{
+		cache: newLookupCache(ttl, negativeTTL, func(ctx context.Context, externalID string) (*ClusterIdentity, error) {
+			return GetClusterIdentityByExternalID(ctx, externalID, conn)
+		}),
+	}
+}
+
+// Resolve returns the OCM identity of the cluster with the given external ID
+func (r *ClusterIDResolver) Resolve(ctx context.Context, externalID string) (*ClusterIdentity, error) {
+	return r.cache.get(ctx, externalID)
+}
+
+// State returns the content of the cache, it is meant for the debug state endpoint
+func (r *ClusterIDResolver) State() interface{} {
+	return r.cache.state(func(identity *ClusterIdentity, fields map[string]interface{}) {
+		fields["InternalID"] = identity.InternalID
+		fields["SubscriptionID"] = identity.SubscriptionID
+	})
+}
@@ -0,0 +1,96 @@
+package ocm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cluster ID resolver", func() {
+
+	const testExternalID = "test-external-id"
+
+	var (
+		lookups      int
+		lookupErr    error
+		testIdentity *ClusterIdentity
+		resolver     *ClusterIDResolver
+	)
+
+	newResolver := func(ttl, negativeTTL time.Duration) *ClusterIDResolver {
+		return &ClusterIDResolver{
+			cache: newLookupCache(ttl, negativeTTL, func(ctx context.Context, externalID string) (*ClusterIdentity, error) {
+				lookups++
+				if lookupErr != nil {
+					return nil, lookupErr
+				}
+				return testIdentity, nil
+			}),
+		}
+	}
+
+	BeforeEach(func() {
+		lookups = 0
+		lookupErr = nil
+		testIdentity = &ClusterIdentity{ExternalID: testExternalID, InternalID: "test-internal-id", SubscriptionID: "test-subscription-id"}
+		resolver = newResolver(time.Hour, time.Hour)
+	})
+
+	It("Caches a found cluster", func() {
+		for i := 0; i < 2; i++ {
+			identity, err := resolver.Resolve(context.Background(), testExternalID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(identity).To(Equal(testIdentity))
+		}
+		Expect(lookups).To(Equal(1))
+	})
+	It("Looks the cluster up again once the TTL has expired", func() {
+		resolver = newResolver(0, time.Hour)
+		_, _ = resolver.Resolve(context.Background(), testExternalID)
+		_, _ = resolver.Resolve(context.Background(), testExternalID)
+		Expect(lookups).To(Equal(2))
+	})
+	It("Caches a cluster which is not found", func() {
+		lookupErr = fmt.Errorf("cluster with external id %s: %w", testExternalID, ErrClusterNotFound)
+		for i := 0; i < 2; i++ {
+			_, err := resolver.Resolve(context.Background(), testExternalID)
+			Expect(errors.Is(err, ErrClusterNotFound)).To(BeTrue())
+		}
+		Expect(lookups).To(Equal(1))
+	})
+	It("Does not cache other errors", func() {
+		lookupErr = fmt.Errorf("connection refused")
+		_, err := resolver.Resolve(context.Background(), testExternalID)
+		Expect(err).To(HaveOccurred())
+		lookupErr = nil
+		identity, err := resolver.Resolve(context.Background(), testExternalID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(identity).To(Equal(testIdentity))
+		Expect(lookups).To(Equal(2))
+	})
+	It("Rejects an empty cluster ID", func() {
+		_, err := resolver.Resolve(context.Background(), "")
+		Expect(err).To(HaveOccurred())
+		Expect(lookups).To(Equal(0))
+	})
+	It("Escapes the quotes of the external ID in the subscription search", func() {
+		Expect(subscriptionSearch(testExternalID)).To(Equal("external_cluster_id = 'test-external-id'"))
+		Expect(subscriptionSearch("x' or external_cluster_id != '")).To(Equal("external_cluster_id = 'x'' or external_cluster_id != '''"))
+	})
+	It("Escapes the quotes of the values in the service log search", func() {
+		since := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		Expect(ServiceLogSearch(testExternalID, "Issue: test", "", since)).To(Equal(
+			"cluster_uuid = 'test-external-id' and summary = 'Issue: test' and created_at >= '2026-01-02T03:04:05Z'"))
+		Expect(ServiceLogSearch(testExternalID, "it's down", "x' or '1' = '1", since)).To(Equal(
+			"cluster_uuid = 'test-external-id' and summary = 'it''s down' and created_at >= '2026-01-02T03:04:05Z' and event_stream_id = 'x'' or ''1'' = ''1'"))
+	})
+	It("Exposes the cache content", func() {
+		_, _ = resolver.Resolve(context.Background(), testExternalID)
+		state := resolver.State().(map[string]interface{})
+		Expect(state).To(HaveKey(testExternalID))
+	})
+})
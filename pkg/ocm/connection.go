@@ -1,17 +1,25 @@
 package ocm
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	sdk "github.com/openshift-online/ocm-sdk-go"
-	log "github.com/sirupsen/logrus"
+	sdklogging "github.com/openshift-online/ocm-sdk-go/logging"
+
+	"github.com/openshift/ocm-agent/pkg/logging"
 )
 
+var log = logging.Subsystem(logging.SubsystemOCM)
+
 // ConnectionBuilder contains the information and logic needed to build a connection to OCM. Don't
 // create instances of this type directly; use the NewConnection function instead.
 type ConnectionBuilder struct {
-	logger           *sdk.Logger
+	logger           sdklogging.Logger
 	transportWrapper sdk.TransportWrapper
+	network          NetworkConfig
 }
 
 // NewConnection creates a builder that can then be used to configure and build an OCM connection.
@@ -20,21 +28,33 @@ func NewConnection() *ConnectionBuilder {
 	return &ConnectionBuilder{}
 }
 
-// Build uses the information stored in the builder to create a new OCM connection.
+// Build uses the information stored in the builder to create a new OCM connection authenticated with
+// the cluster pull secret, as done in traditional OSD/ROSA mode.
 func (b *ConnectionBuilder) Build(baseUrl string, clusterId string, accessToken string) (result *sdk.Connection, err error) {
-	builder := sdk.NewConnectionBuilder()
-
-	// Hard-code some values
-	builder.URL(baseUrl)
+	builder, err := b.sdkBuilder(baseUrl)
+	if err != nil {
+		return nil, fmt.Errorf("Can't create connection: %v", err)
+	}
 	authToken := fmt.Sprintf("%v:%v", clusterId, accessToken)
 	builder.Tokens(authToken)
 
-	if b.logger != nil {
-		builder.Logger(*b.logger)
+	// Create the connection:
+	result, err = builder.Build()
+	if err != nil {
+		return result, fmt.Errorf("Can't create connection: %v", err)
 	}
-	if b.transportWrapper != nil {
-		builder.TransportWrapper(b.transportWrapper)
+
+	return result, nil
+}
+
+// BuildWithClient uses the information stored in the builder to create a new OCM connection authenticated
+// with client credentials, as done in fleet mode.
+func (b *ConnectionBuilder) BuildWithClient(baseUrl string, clientID string, clientSecret string) (result *sdk.Connection, err error) {
+	builder, err := b.sdkBuilder(baseUrl)
+	if err != nil {
+		return nil, fmt.Errorf("Can't create connection: %v", err)
 	}
+	builder.Client(clientID, clientSecret)
 
 	// Create the connection:
 	result, err = builder.Build()
@@ -45,7 +65,30 @@ func (b *ConnectionBuilder) Build(baseUrl string, clusterId string, accessToken
 	return result, nil
 }
 
-func (b *ConnectionBuilder) Logger(logger *sdk.Logger) *ConnectionBuilder {
+// sdkBuilder returns an OCM SDK connection builder with the options shared by every mode
+func (b *ConnectionBuilder) sdkBuilder(baseUrl string) (*sdk.ConnectionBuilder, error) {
+	builder := sdk.NewConnectionBuilder()
+
+	// Hard-code some values
+	builder.URL(baseUrl)
+	builder.Insecure(false)
+
+	if b.logger != nil {
+		builder.Logger(b.logger)
+	}
+	if b.transportWrapper != nil {
+		builder.TransportWrapper(b.transportWrapper)
+	}
+	// Added last so it is the innermost wrapper, replacing the transport created by the SDK
+	networkWrapper, err := b.network.transportWrapper()
+	if err != nil {
+		return nil, err
+	}
+	builder.TransportWrapper(networkWrapper)
+	return builder, nil
+}
+
+func (b *ConnectionBuilder) Logger(logger sdklogging.Logger) *ConnectionBuilder {
 	b.logger = logger
 	return b
 }
@@ -55,24 +98,66 @@ func (b *ConnectionBuilder) TransportWrapper(wrapper sdk.TransportWrapper) *Conn
 	return b
 }
 
+// Network sets the proxy and TLS configuration of the connection
+func (b *ConnectionBuilder) Network(config NetworkConfig) *ConnectionBuilder {
+	b.network = config
+	return b
+}
+
 // Adapted from https://github.com/gdbranco/rosa/blob/9c5d9a00eef233a7989aca5ddca6762dc0f4d01d/pkg/ocm/clusters.go#L371
-func GetInternalIDByExternalID(externalID string, ocm *sdk.Connection) (string, error) {
+func GetInternalIDByExternalID(ctx context.Context, externalID string, ocm *sdk.Connection) (string, error) {
+	identity, err := GetClusterIdentityByExternalID(ctx, externalID, ocm)
+	if err != nil {
+		return "", err
+	}
+	return identity.InternalID, nil
+}
+
+// GetClusterIdentityByExternalID looks up the subscription of the cluster with the given external ID, an error
+// wrapping ErrClusterNotFound is returned when there is none
+func GetClusterIdentityByExternalID(ctx context.Context, externalID string, ocm *sdk.Connection) (*ClusterIdentity, error) {
 	log.Debugf("Getting internal ID from external ID %s", externalID)
-	query := fmt.Sprintf("external_cluster_id = '%s'", externalID)
 	response, err := ocm.AccountsMgmt().V1().Subscriptions().List().
-		Search(query).
+		Search(subscriptionSearch(externalID)).
 		Page(1).
 		Size(1).
-		Send()
+		SendContext(ctx)
 	if err != nil {
 		log.Error(err)
-		return "", err
+		return nil, err
 	}
 	if response.Total() < 1 {
 		log.Errorf("Cluster with external id %s not found in OCM database.", externalID)
-		return "", fmt.Errorf("Cluster with external id %s not found in OCM database.", externalID)
+		return nil, fmt.Errorf("cluster with external id %s: %w", externalID, ErrClusterNotFound)
 	}
 	sub := response.Items().Slice()[0]
 
-	return sub.ClusterID(), nil
+	return &ClusterIdentity{
+		ExternalID:     externalID,
+		InternalID:     sub.ClusterID(),
+		SubscriptionID: sub.ID(),
+	}, nil
+}
+
+// subscriptionSearch returns the search of the subscription of the cluster with the given external ID. The ID comes
+// from the labels of an alert in fleet mode, quotes are escaped so it can't alter the search.
+func subscriptionSearch(externalID string) string {
+	return fmt.Sprintf("external_cluster_id = '%s'", quoteSearchValue(externalID))
+}
+
+// ServiceLogSearch returns the search of the service logs of the cluster with the given external ID, summary as posted
+// and event stream ID if any, created since the given time. The values come from the alert and the notification
+// template, quotes are escaped so they can't alter the search.
+func ServiceLogSearch(clusterID, summary, eventStreamID string, since time.Time) string {
+	search := fmt.Sprintf("cluster_uuid = '%s' and summary = '%s' and created_at >= '%s'",
+		quoteSearchValue(clusterID), quoteSearchValue(summary), since.UTC().Format(time.RFC3339))
+	if eventStreamID != "" {
+		search += fmt.Sprintf(" and event_stream_id = '%s'", quoteSearchValue(eventStreamID))
+	}
+	return search
+}
+
+// quoteSearchValue escapes the quotes of a value interpolated between quotes in an OCM search
+func quoteSearchValue(v string) string {
+	return strings.ReplaceAll(v, "'", "''")
 }
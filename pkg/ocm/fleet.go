@@ -0,0 +1,121 @@
+package ocm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sdk "github.com/openshift-online/ocm-sdk-go"
+)
+
+// ErrNotInManagementCluster is returned when a hosted cluster is not managed by the management cluster reporting it
+var ErrNotInManagementCluster = errors.New("hosted cluster does not belong to the management cluster")
+
+// FleetCluster holds the IDs of a cluster in OCM and, for a hosted cluster, the name of its management cluster
+type FleetCluster struct {
+	ID                string
+	ExternalID        string
+	Name              string
+	ManagementCluster string
+}
+
+// HostedClusterValidator verifies that the hosted clusters of fleet alerts exist in OCM and belong to the management
+// cluster reporting them. Clusters are cached for the TTL, clusters which are not found are cached for the negative
+// TTL. Other errors are never cached.
+type HostedClusterValidator struct {
+	cache *lookupCache[*FleetCluster]
+}
+
+// NewHostedClusterValidator returns a validator looking up clusters with the given connection
+func NewHostedClusterValidator(conn *sdk.Connection, ttl, negativeTTL time.Duration) *HostedClusterValidator {
+	return &HostedClusterValidator{
+		cache: newLookupCache(ttl, negativeTTL, func(ctx context.Context, id string) (*FleetCluster, error) {
+			return GetFleetCluster(ctx, id, conn)
+		}),
+	}
+}
+
+// ValidateHostedCluster returns an error wrapping ErrClusterNotFound when the hosted cluster is not in OCM, or
+// wrapping ErrNotInManagementCluster when it is managed by another management cluster
+func (v *HostedClusterValidator) ValidateHostedCluster(ctx context.Context, mcID, hcID string) error {
+	hc, err := v.cluster(ctx, hcID)
+	if err != nil {
+		return fmt.Errorf("hosted cluster %s: %w", hcID, err)
+	}
+	if hc.ManagementCluster == "" {
+		return fmt.Errorf("cluster %s is not a hosted cluster: %w", hcID, ErrNotInManagementCluster)
+	}
+	// OCM refers to the management cluster by name, alerts may identify it by name or ID
+	if hc.ManagementCluster == mcID {
+		return nil
+	}
+	mc, err := v.cluster(ctx, mcID)
+	if err != nil {
+		return fmt.Errorf("management cluster %s: %w", mcID, err)
+	}
+	if hc.ManagementCluster == mc.Name || hc.ManagementCluster == mc.ID || hc.ManagementCluster == mc.ExternalID {
+		return nil
+	}
+	return fmt.Errorf("hosted cluster %s is managed by %s, not %s: %w", hcID, hc.ManagementCluster, mcID, ErrNotInManagementCluster)
+}
+
+// ClusterExists returns whether the cluster with the given ID or external ID exists in OCM
+func (v *HostedClusterValidator) ClusterExists(ctx context.Context, id string) (bool, error) {
+	_, err := v.cluster(ctx, id)
+	if errors.Is(err, ErrClusterNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// cluster returns the cluster with the given ID or external ID, from the cache when possible
+func (v *HostedClusterValidator) cluster(ctx context.Context, id string) (*FleetCluster, error) {
+	return v.cache.get(ctx, id)
+}
+
+// State returns the content of the cache, it is meant for the debug state endpoint
+func (v *HostedClusterValidator) State() interface{} {
+	return v.cache.state(func(cluster *FleetCluster, fields map[string]interface{}) {
+		fields["Name"] = cluster.Name
+		fields["ManagementCluster"] = cluster.ManagementCluster
+	})
+}
+
+// GetFleetCluster looks up the cluster with the given ID or external ID, an error wrapping ErrClusterNotFound is
+// returned when there is none
+func GetFleetCluster(ctx context.Context, id string, ocm *sdk.Connection) (*FleetCluster, error) {
+	log.Debugf("Getting cluster %s", id)
+	// The ID comes from the labels of an alert, quotes are escaped so it can't alter the search
+	quoted := quoteSearchValue(id)
+	query := fmt.Sprintf("id = '%s' or external_id = '%s'", quoted, quoted)
+	response, err := ocm.ClustersMgmt().V1().Clusters().List().
+		Search(query).
+		Page(1).
+		Size(1).
+		SendContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if response.Total() < 1 {
+		return nil, fmt.Errorf("cluster with id %s: %w", id, ErrClusterNotFound)
+	}
+	cluster := response.Items().Get(0)
+	fc := &FleetCluster{
+		ID:         cluster.ID(),
+		ExternalID: cluster.ExternalID(),
+		Name:       cluster.Name(),
+	}
+	if cluster.Hypershift().Enabled() {
+		// The management cluster of a hosted cluster is the one of its provision shard
+		shard, err := ocm.ClustersMgmt().V1().Clusters().Cluster(cluster.ID()).ProvisionShard().Get().SendContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		fc.ManagementCluster = shard.Body().ManagementCluster()
+	}
+	return fc, nil
+}
@@ -0,0 +1,93 @@
+package ocm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hosted cluster validator", func() {
+
+	const (
+		testMCID = "test-mc-id"
+		testHCID = "test-hc-id"
+	)
+
+	var (
+		lookups   map[string]int
+		clusters  map[string]*FleetCluster
+		lookupErr error
+		validator *HostedClusterValidator
+	)
+
+	BeforeEach(func() {
+		lookups = map[string]int{}
+		lookupErr = nil
+		clusters = map[string]*FleetCluster{
+			testMCID: {ID: testMCID, ExternalID: "test-mc-external-id", Name: "test-mc"},
+			testHCID: {ID: "test-hc-internal-id", ExternalID: testHCID, Name: "test-hc", ManagementCluster: "test-mc"},
+		}
+		validator = &HostedClusterValidator{
+			cache: newLookupCache(time.Hour, time.Hour, func(ctx context.Context, id string) (*FleetCluster, error) {
+				lookups[id]++
+				if lookupErr != nil {
+					return nil, lookupErr
+				}
+				cluster, ok := clusters[id]
+				if !ok {
+					return nil, fmt.Errorf("cluster with id %s: %w", id, ErrClusterNotFound)
+				}
+				return cluster, nil
+			}),
+		}
+	})
+
+	It("Accepts a hosted cluster of the management cluster", func() {
+		Expect(validator.ValidateHostedCluster(context.Background(), testMCID, testHCID)).To(Succeed())
+	})
+	It("Accepts a management cluster identified by name", func() {
+		Expect(validator.ValidateHostedCluster(context.Background(), "test-mc", testHCID)).To(Succeed())
+		Expect(lookups).ToNot(HaveKey("test-mc"))
+	})
+	It("Rejects a hosted cluster which is not in OCM", func() {
+		err := validator.ValidateHostedCluster(context.Background(), testMCID, "unknown")
+		Expect(errors.Is(err, ErrClusterNotFound)).To(BeTrue())
+	})
+	It("Rejects a hosted cluster of another management cluster", func() {
+		clusters["other-mc"] = &FleetCluster{ID: "other-mc", Name: "other-mc"}
+		err := validator.ValidateHostedCluster(context.Background(), "other-mc", testHCID)
+		Expect(errors.Is(err, ErrNotInManagementCluster)).To(BeTrue())
+	})
+	It("Rejects a cluster which is not a hosted cluster", func() {
+		err := validator.ValidateHostedCluster(context.Background(), testHCID, testMCID)
+		Expect(errors.Is(err, ErrNotInManagementCluster)).To(BeTrue())
+	})
+	It("Caches the clusters", func() {
+		for i := 0; i < 2; i++ {
+			Expect(validator.ValidateHostedCluster(context.Background(), testMCID, testHCID)).To(Succeed())
+			Expect(validator.ValidateHostedCluster(context.Background(), testMCID, "unknown")).ToNot(Succeed())
+		}
+		Expect(lookups[testHCID]).To(Equal(1))
+		Expect(lookups["unknown"]).To(Equal(1))
+	})
+	It("Tells whether a cluster exists", func() {
+		Expect(validator.ClusterExists(context.Background(), testHCID)).To(BeTrue())
+		Expect(validator.ClusterExists(context.Background(), "unknown")).To(BeFalse())
+		lookupErr = fmt.Errorf("a fake error")
+		_, err := validator.ClusterExists(context.Background(), "other")
+		Expect(err).To(HaveOccurred())
+	})
+	It("Does not cache other errors", func() {
+		lookupErr = fmt.Errorf("a fake error")
+		for i := 0; i < 2; i++ {
+			err := validator.ValidateHostedCluster(context.Background(), testMCID, testHCID)
+			Expect(err).To(HaveOccurred())
+			Expect(errors.Is(err, ErrClusterNotFound)).To(BeFalse())
+		}
+		Expect(lookups[testHCID]).To(Equal(2))
+	})
+})
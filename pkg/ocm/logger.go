@@ -0,0 +1,54 @@
+package ocm
+
+import (
+	"context"
+
+	sdklogging "github.com/openshift-online/ocm-sdk-go/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// sdkLogger sends the logs of the OCM SDK to the logger of the ocm subsystem, so they follow its runtime level
+type sdkLogger struct {
+	log *logrus.Logger
+}
+
+// NewLogger returns an OCM SDK logger backed by the logger of the ocm subsystem
+func NewLogger() sdklogging.Logger {
+	return &sdkLogger{log: log}
+}
+
+func (l *sdkLogger) DebugEnabled() bool {
+	return l.log.IsLevelEnabled(logrus.DebugLevel)
+}
+
+func (l *sdkLogger) InfoEnabled() bool {
+	return l.log.IsLevelEnabled(logrus.InfoLevel)
+}
+
+func (l *sdkLogger) WarnEnabled() bool {
+	return l.log.IsLevelEnabled(logrus.WarnLevel)
+}
+
+func (l *sdkLogger) ErrorEnabled() bool {
+	return l.log.IsLevelEnabled(logrus.ErrorLevel)
+}
+
+func (l *sdkLogger) Debug(ctx context.Context, format string, args ...interface{}) {
+	l.log.WithContext(ctx).Debugf(format, args...)
+}
+
+func (l *sdkLogger) Info(ctx context.Context, format string, args ...interface{}) {
+	l.log.WithContext(ctx).Infof(format, args...)
+}
+
+func (l *sdkLogger) Warn(ctx context.Context, format string, args ...interface{}) {
+	l.log.WithContext(ctx).Warnf(format, args...)
+}
+
+func (l *sdkLogger) Error(ctx context.Context, format string, args ...interface{}) {
+	l.log.WithContext(ctx).Errorf(format, args...)
+}
+
+func (l *sdkLogger) Fatal(ctx context.Context, format string, args ...interface{}) {
+	l.log.WithContext(ctx).Fatalf(format, args...)
+}
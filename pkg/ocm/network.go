@@ -0,0 +1,208 @@
+package ocm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	sdk "github.com/openshift-online/ocm-sdk-go"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// NetworkConfig configures how the connections to OCM reach the server
+type NetworkConfig struct {
+	// HTTPSProxy is the URL of the proxy OCM is reached through, it may include the proxy credentials.
+	// The HTTPS_PROXY and NO_PROXY environment variables, set on the pods of clusters with a cluster-wide
+	// proxy, are honoured when it is empty.
+	HTTPSProxy string
+	// NoProxy is the comma separated list of hosts which are reached directly when HTTPSProxy is set
+	NoProxy string
+	// CAFile is a PEM file of CA certificates trusted in addition to the system ones, it is reloaded when it changes
+	CAFile string
+	// MinTLSVersion is the minimum TLS version accepted from the server, TLS 1.2 if zero
+	MinTLSVersion uint16
+}
+
+// tlsVersions are the TLS versions which can be set as the minimum one
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion returns the TLS version for the given name, e.g. 1.3
+func ParseTLSVersion(name string) (uint16, error) {
+	version, ok := tlsVersions[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version %q, expected 1.2 or 1.3", name)
+	}
+	return version, nil
+}
+
+// transportWrapper returns the transport wrapper applying the configuration. It is meant to be the innermost
+// wrapper so it replaces the transport created by the OCM SDK, which only honours the proxy environment variables.
+func (c NetworkConfig) transportWrapper() (sdk.TransportWrapper, error) {
+	proxy, err := c.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	var bundle *caBundle
+	if c.CAFile != "" {
+		bundle, err = newCABundle(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	minVersion := c.MinTLSVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		base, ok := next.(*http.Transport)
+		// Connections over Unix sockets dial with their own TLS configuration and never go through a proxy
+		if !ok || base.DialTLSContext != nil {
+			return next
+		}
+		t := base.Clone()
+		t.Proxy = proxy
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.MinVersion = minVersion
+		if bundle != nil {
+			// The roots of a transport can't be changed once it is in use, the chain is verified against the
+			// current content of the bundle instead
+			t.TLSClientConfig.InsecureSkipVerify = true //#nosec G402 -- the chain is verified by VerifyConnection
+			t.TLSClientConfig.VerifyConnection = bundle.verifier(t.TLSClientConfig.ServerName)
+		}
+		return t
+	}, nil
+}
+
+// proxyFunc returns the function selecting the proxy of a request
+func (c NetworkConfig) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if c.HTTPSProxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := url.Parse(c.HTTPSProxy)
+	if err != nil {
+		// The URL may include credentials, it is not part of the error
+		return nil, fmt.Errorf("invalid HTTPS proxy URL")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid HTTPS proxy URL, expected http(s)://[user:password@]host:port")
+	}
+	proxy := (&httpproxy.Config{
+		HTTPProxy:  c.HTTPSProxy,
+		HTTPSProxy: c.HTTPSProxy,
+		NoProxy:    c.NoProxy,
+	}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}, nil
+}
+
+// caBundle holds the CA certificates of a PEM file, reloaded when the modification time or size of the file changes
+type caBundle struct {
+	path string
+
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+	pool    *x509.CertPool
+}
+
+// newCABundle loads the CA certificates of the file, it fails if there is none
+func newCABundle(path string) (*caBundle, error) {
+	b := &caBundle{path: path}
+	_, err := b.Pool()
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Pool returns the system certificates and the ones of the file. When the file can't be reloaded,
+// the certificates loaded previously are kept.
+func (b *caBundle) Pool() (*x509.CertPool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	info, err := os.Stat(b.path)
+	if err != nil {
+		if b.pool != nil {
+			return b.pool, nil
+		}
+		return nil, fmt.Errorf("unable to read CA file: %w", err)
+	}
+	if b.pool != nil && info.ModTime().Equal(b.modTime) && info.Size() == b.size {
+		return b.pool, nil
+	}
+
+	// The file is only reloaded once per change, even if it is invalid
+	b.modTime, b.size = info.ModTime(), info.Size()
+	pool, err := loadCAPool(b.path)
+	if err != nil {
+		if b.pool != nil {
+			log.WithError(err).Warnf("Unable to reload CA file %s, keeping the previous certificates", b.path)
+			return b.pool, nil
+		}
+		return nil, err
+	}
+	if b.pool != nil {
+		log.Infof("Reloaded CA file %s", b.path)
+	}
+	b.pool = pool
+	return pool, nil
+}
+
+// verifier returns the function checking the certificate chain of the server against the bundle. The server
+// name of the connection state is empty for IP addresses, so the one of the TLS configuration is preferred.
+func (b *caBundle) verifier(serverName string) func(cs tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return fmt.Errorf("server presented no certificate")
+		}
+		name := serverName
+		if name == "" {
+			name = cs.ServerName
+		}
+		if name == "" {
+			return fmt.Errorf("unable to verify the server certificate without a server name")
+		}
+		pool, err := b.Pool()
+		if err != nil {
+			return err
+		}
+		opts := x509.VerifyOptions{
+			DNSName:       name,
+			Roots:         pool,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err = cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+}
+
+func loadCAPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path) //#nosec G304 -- path is set by the operator
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificate found in CA file %s", path)
+	}
+	return pool, nil
+}
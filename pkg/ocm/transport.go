@@ -0,0 +1,115 @@
+package ocm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	sdk "github.com/openshift-online/ocm-sdk-go"
+	"github.com/sirupsen/logrus"
+
+	"github.com/openshift/ocm-agent/pkg/diagnostics"
+	"github.com/openshift/ocm-agent/pkg/metrics"
+)
+
+// sensitiveHeaders are redacted when requests are logged
+var sensitiveHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"Set-Cookie":    true,
+}
+
+// NewTransportWrapper returns a transport wrapper which records metrics for every OCM request, logs them with
+// the sensitive headers redacted at debug level, and gives up on requests taking longer than the timeout
+func NewTransportWrapper(timeout time.Duration) sdk.TransportWrapper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &transport{next: next, timeout: timeout}
+	}
+}
+
+type transport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := metricsPath(req.URL.Path)
+	if log.IsLevelEnabled(logrus.DebugLevel) {
+		log.WithFields(logrus.Fields{"method": req.Method, "url": req.URL.String(), "headers": redactHeaders(req.Header)}).Debug("sending OCM request")
+	}
+
+	var cancel context.CancelFunc = func() {}
+	if t.timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), t.timeout)
+		req = req.WithContext(ctx)
+	}
+
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	duration := time.Since(start)
+	if err != nil {
+		cancel()
+		metrics.ObserveOCMRequest(req.Method, path, "error", duration)
+		return nil, err
+	}
+	metrics.ObserveOCMRequest(req.Method, path, strconv.Itoa(res.StatusCode), duration)
+	if log.IsLevelEnabled(logrus.DebugLevel) {
+		log.WithFields(logrus.Fields{"method": req.Method, "url": req.URL.String(), "status": res.StatusCode, "headers": redactHeaders(res.Header), "duration": duration.String()}).Debug("received OCM response")
+	}
+	// The timeout covers reading the body, it is only released once the caller closes it
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// redactHeaders returns a copy of the headers with the value of the sensitive ones replaced
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for name := range redacted {
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			redacted[name] = []string{diagnostics.Redacted}
+		}
+	}
+	return redacted
+}
+
+// metricsPath replaces the IDs in the path so the metrics have a bounded number of label values,
+// e.g. /api/clusters_mgmt/v1/clusters/1a2b3c/limited_support_reasons becomes
+// /api/clusters_mgmt/v1/clusters/-/limited_support_reasons. The OCM routes alternate collections and IDs after the
+// version, /api/{service}/{version}/{collection}/{id}/{collection}/{id}..., so the IDs are found by their position
+// whatever they look like. Other paths, such as the one of the token endpoint, hold no ID.
+func metricsPath(path string) string {
+	segments := strings.Split(path, "/")
+	if len(segments) < 4 || segments[0] != "" || segments[1] != "api" || !isVersion(segments[3]) {
+		return path
+	}
+	for i := 5; i < len(segments); i += 2 {
+		if segments[i] != "" {
+			segments[i] = "-"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isVersion returns whether the path segment is an API version such as v1
+func isVersion(segment string) bool {
+	if len(segment) < 2 || segment[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(segment[1:])
+	return err == nil
+}
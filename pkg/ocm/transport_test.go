@@ -0,0 +1,61 @@
+package ocm
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/onsi/gomega/ghttp"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/ocm-agent/pkg/diagnostics"
+)
+
+var _ = Describe("OCM transport", func() {
+
+	var (
+		server *ghttp.Server
+		client *http.Client
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+		client = &http.Client{Transport: NewTransportWrapper(100 * time.Millisecond)(http.DefaultTransport)}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Returns the response of a fast request", func() {
+		server.AppendHandlers(ghttp.RespondWith(http.StatusOK, "ok"))
+		res, err := client.Get(server.URL() + "/api/service_logs/v1/cluster_logs")
+		Expect(err).ToNot(HaveOccurred())
+		body, err := io.ReadAll(res.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Body.Close()).To(Succeed())
+		Expect(string(body)).To(Equal("ok"))
+	})
+	It("Gives up on a request taking longer than the timeout", func() {
+		server.AppendHandlers(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(500 * time.Millisecond)
+		})
+		_, err := client.Get(server.URL())
+		Expect(err).To(HaveOccurred())
+	})
+	It("Replaces the IDs in the metrics path", func() {
+		Expect(metricsPath("/api/clusters_mgmt/v1/clusters/1n2j3k4l/limited_support_reasons/2abc")).To(Equal("/api/clusters_mgmt/v1/clusters/-/limited_support_reasons/-"))
+		Expect(metricsPath("/api/service_logs/v1/cluster_logs")).To(Equal("/api/service_logs/v1/cluster_logs"))
+		Expect(metricsPath("/api/clusters_mgmt/v1/clusters/abcdef/limited_support_reasons/")).To(Equal("/api/clusters_mgmt/v1/clusters/-/limited_support_reasons/"))
+		Expect(metricsPath("/auth/realms/redhat-external/protocol/openid-connect/token")).To(Equal("/auth/realms/redhat-external/protocol/openid-connect/token"))
+	})
+	It("Redacts the sensitive headers", func() {
+		header := http.Header{"Authorization": []string{"Bearer secret"}, "Accept": []string{"application/json"}}
+		redacted := redactHeaders(header)
+		Expect(redacted.Get("Authorization")).To(Equal(diagnostics.Redacted))
+		Expect(redacted.Get("Accept")).To(Equal("application/json"))
+		Expect(header.Get("Authorization")).To(Equal("Bearer secret"))
+	})
+})
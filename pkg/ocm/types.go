@@ -1,14 +1,77 @@
 package ocm
 
-import "github.com/openshift/ocm-agent-operator/api/v1alpha1"
+import (
+	"time"
+
+	"github.com/openshift/ocm-agent-operator/api/v1alpha1"
+)
 
 type ServiceLog struct {
-	ServiceName   string                               `json:"service_name"`
-	ClusterUUID   string                               `json:"cluster_uuid,omitempty"`
-	Summary       string                               `json:"summary"`
-	Description   string                               `json:"description"`
-	InternalOnly  bool                                 `json:"internal_only"`
-	Severity      v1alpha1.NotificationSeverity        `json:"severity"`
-	LogType       string                               `json:"log_type,omitempty"`
-	DocReferences []v1alpha1.NotificationReferenceType `json:"doc_references,omitempty"`
+	ServiceName    string                               `json:"service_name"`
+	ClusterUUID    string                               `json:"cluster_uuid,omitempty"`
+	ClusterID      string                               `json:"cluster_id,omitempty"`
+	SubscriptionID string                               `json:"subscription_id,omitempty"`
+	Summary        string                               `json:"summary"`
+	Description    string                               `json:"description"`
+	InternalOnly   bool                                 `json:"internal_only"`
+	Severity       v1alpha1.NotificationSeverity        `json:"severity"`
+	LogType        string                               `json:"log_type,omitempty"`
+	DocReferences  []v1alpha1.NotificationReferenceType `json:"doc_references,omitempty"`
+	EventStreamID  string                               `json:"event_stream_id,omitempty"`
+	Username       string                               `json:"username,omitempty"`
+	CreatedBy      string                               `json:"created_by,omitempty"`
+}
+
+// ServiceLogRequest describes the service log to send for an alert
+type ServiceLogRequest struct {
+	// ClusterID is the external ID of the cluster
+	ClusterID string
+	// Summary is prefixed according to the firing state of the alert
+	Summary string
+	// FiringDesc and ResolveDesc are the descriptions of the service log for a firing and resolved alert
+	FiringDesc  string
+	ResolveDesc string
+	Severity    v1alpha1.NotificationSeverity
+	LogType     string
+	References  []v1alpha1.NotificationReferenceType
+	Firing      bool
+	// EventStreamID groups the service logs of the same incident
+	EventStreamID string
+	ServiceLogOptions
+}
+
+// ServiceLogOptions are the optional fields of the service logs of a notification
+type ServiceLogOptions struct {
+	// InternalOnly makes the service log only visible to SRE
+	InternalOnly bool `json:"internalOnly,omitempty"`
+	// ServiceName overrides the default service name of the service log
+	ServiceName string `json:"serviceName,omitempty"`
+	Username    string `json:"username,omitempty"`
+	CreatedBy   string `json:"createdBy,omitempty"`
+}
+
+// ServiceLogQuery describes the service log looked up in OCM to know whether it was already posted
+type ServiceLogQuery struct {
+	// ClusterID is the external ID of the cluster
+	ClusterID string
+	// Summary is prefixed according to the firing state like the one of a ServiceLogRequest
+	Summary       string
+	Firing        bool
+	EventStreamID string
+	// Since is the earliest creation time of the service log
+	Since time.Time
+}
+
+// ServiceLogResponse describes the service log posted to OCM and the operation that handled it
+type ServiceLogResponse struct {
+	OperationID string
+	ServiceLog  ServiceLog
+	// DryRun is set when the service log was not posted as OCM Agent runs in dry run mode
+	DryRun bool
+}
+
+// LimitedSupportReason is the reason a cluster is placed into limited support while a notification is firing
+type LimitedSupportReason struct {
+	Summary string `json:"summary"`
+	Details string `json:"details"`
 }
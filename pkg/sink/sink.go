@@ -0,0 +1,323 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/ocm-agent/pkg/logging"
+	"github.com/openshift/ocm-agent/pkg/metrics"
+)
+
+const (
+	// TypeWebhook posts the message as JSON to a generic HTTP endpoint
+	TypeWebhook = "webhook"
+	// TypeSlack posts the message to a Slack compatible incoming webhook
+	TypeSlack = "slack"
+	// TypeSMTP sends the message as an email
+	TypeSMTP = "smtp"
+	// TypeLog only logs the message, it is meant for local testing
+	TypeLog = "log"
+
+	// ServiceLog is the reserved name selecting the OCM service log as a delivery path
+	ServiceLog = "service_logs"
+
+	// DefaultRetries is the number of retries of a failed delivery when a sink does not set it
+	DefaultRetries = 3
+	// DefaultTimeout is the timeout of a single delivery attempt when a sink does not set it
+	DefaultTimeout = 10 * time.Second
+	// DefaultDeliveryTimeout bounds the attempts and retries of a delivery when a sink does not set it, it is kept
+	// well below the timeout of the Alertmanager webhook requests the deliveries are made from
+	DefaultDeliveryTimeout = 15 * time.Second
+
+	// OutcomeSent and OutcomeFailed are the outcomes of a delivery reported in the metrics
+	OutcomeSent   = "sent"
+	OutcomeFailed = "failed"
+)
+
+var (
+	log = logging.Subsystem(logging.SubsystemHandlers)
+	// retryInterval is the delay before the first retry of a failed delivery, doubled on every retry
+	retryInterval = 500 * time.Millisecond
+)
+
+// Message is the notification delivered to a sink
+type Message struct {
+	Notification string `json:"notification"`
+	ClusterID    string `json:"clusterId"`
+	Summary      string `json:"summary"`
+	Description  string `json:"description"`
+	Severity     string `json:"severity"`
+	Firing       bool   `json:"firing"`
+}
+
+// Sink delivers notifications to a destination other than OCM
+//
+//go:generate mockgen -destination=mocks/sink.go -package=mocks github.com/openshift/ocm-agent/pkg/sink Sink
+type Sink interface {
+	// Send delivers a single message, it is retried by the registry when an error is returned. The delivery is
+	// abandoned when the context is done.
+	Send(ctx context.Context, m Message) error
+}
+
+// Config is the content of the sinks configuration file
+type Config struct {
+	Sinks []SinkConfig `json:"sinks"`
+}
+
+// SinkConfig configures a single sink, values starting with '@' are read from a file
+type SinkConfig struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	SMTP    *SMTPConfig       `json:"smtp,omitempty"`
+	Retries *int              `json:"retries,omitempty"`
+	Timeout string            `json:"timeout,omitempty"`
+	// DeliveryTimeout bounds the time spent delivering a message, retries included
+	DeliveryTimeout string `json:"deliveryTimeout,omitempty"`
+}
+
+// SMTPConfig configures the SMTP server and recipients of an smtp sink
+type SMTPConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+type namedSink struct {
+	sink            Sink
+	kind            string
+	retries         int
+	deliveryTimeout time.Duration
+}
+
+// Registry holds the configured sinks by name
+type Registry struct {
+	sinks map[string]namedSink
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{sinks: map[string]namedSink{}}
+}
+
+// Register adds a sink under the given name, replacing any sink with the same name. A delivery is abandoned once
+// it took deliveryTimeout, whatever the retries left.
+func (r *Registry) Register(name, kind string, s Sink, retries int, deliveryTimeout time.Duration) {
+	r.sinks[name] = namedSink{sink: s, kind: kind, retries: retries, deliveryTimeout: deliveryTimeout}
+}
+
+// Names returns the sorted names of the registered sinks
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.sinks))
+	for name := range r.sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has returns whether a sink is registered under the given name
+func (r *Registry) Has(name string) bool {
+	_, ok := r.sinks[name]
+	return ok
+}
+
+// Send delivers the message to the named sink, retrying with an exponential backoff until the context is done or
+// the delivery timeout of the sink is reached
+func (r *Registry) Send(ctx context.Context, name string, m Message) error {
+	ns, ok := r.sinks[name]
+	if !ok {
+		return fmt.Errorf("sink %s is not configured", name)
+	}
+	if ns.deliveryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ns.deliveryTimeout)
+		defer cancel()
+	}
+	err := deliver(ctx, name, ns, m)
+	if err != nil {
+		metrics.CountSinkDelivery(name, ns.kind, OutcomeFailed)
+		metrics.SetSinkFailure(name)
+		return fmt.Errorf("unable to deliver to sink %s: %w", name, err)
+	}
+	metrics.CountSinkDelivery(name, ns.kind, OutcomeSent)
+	metrics.ResetSinkFailure(name)
+	return nil
+}
+
+// deliver sends the message to the sink, retrying the failures which are not permanent as long as the context is
+// not done
+func deliver(ctx context.Context, name string, ns namedSink, m Message) error {
+	backoff := wait.Backoff{
+		Steps:    ns.retries + 1,
+		Duration: retryInterval,
+		Factor:   2.0,
+		Jitter:   0.1,
+	}
+	for attempt := 0; ; attempt++ {
+		err := ns.sink.Send(ctx, m)
+		if err == nil {
+			return nil
+		}
+		log.WithError(err).WithFields(logrus.Fields{"sink": name, "attempt": attempt + 1}).Debug("sink delivery attempt failed")
+		if !isRetriable(err) || attempt >= ns.retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w, last attempt: %v", ctx.Err(), err)
+		case <-time.After(backoff.Step()):
+		}
+	}
+}
+
+// permanentError is returned by sinks for failures that retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func isRetriable(err error) bool {
+	var p *permanentError
+	return !errors.As(err, &p)
+}
+
+// LoadConfig reads the sinks configuration file, YAML or JSON
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path) //#nosec G304 -- path is set by the operator
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	err = yaml.UnmarshalStrict(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse sinks configuration %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// NewRegistryFromConfig builds a sink for every entry of the configuration
+func NewRegistryFromConfig(c *Config) (*Registry, error) {
+	r := NewRegistry()
+	for _, sc := range c.Sinks {
+		if sc.Name == "" {
+			return nil, fmt.Errorf("sink of type %s has no name", sc.Type)
+		}
+		if sc.Name == ServiceLog {
+			return nil, fmt.Errorf("sink name %s is reserved", ServiceLog)
+		}
+		if r.Has(sc.Name) {
+			return nil, fmt.Errorf("sink %s is defined more than once", sc.Name)
+		}
+		s, err := newSink(sc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sink %s: %w", sc.Name, err)
+		}
+		retries := DefaultRetries
+		if sc.Retries != nil {
+			retries = *sc.Retries
+		}
+		if retries < 0 {
+			return nil, fmt.Errorf("invalid sink %s: retries must not be negative", sc.Name)
+		}
+		deliveryTimeout := DefaultDeliveryTimeout
+		if sc.DeliveryTimeout != "" {
+			deliveryTimeout, err = time.ParseDuration(sc.DeliveryTimeout)
+			if err != nil || deliveryTimeout <= 0 {
+				return nil, fmt.Errorf("invalid sink %s: deliveryTimeout must be a positive duration", sc.Name)
+			}
+		}
+		r.Register(sc.Name, sc.Type, s, retries, deliveryTimeout)
+	}
+	return r, nil
+}
+
+func newSink(sc SinkConfig) (Sink, error) {
+	timeout := DefaultTimeout
+	if sc.Timeout != "" {
+		t, err := time.ParseDuration(sc.Timeout)
+		if err != nil || t <= 0 {
+			return nil, fmt.Errorf("timeout must be a positive duration")
+		}
+		timeout = t
+	}
+	switch sc.Type {
+	case TypeWebhook, TypeSlack:
+		url, err := readValue(sc.URL)
+		if err != nil {
+			return nil, err
+		}
+		if url == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		if sc.Type == TypeSlack {
+			return NewSlackSink(url, timeout), nil
+		}
+		return NewWebhookSink(url, sc.Headers, timeout), nil
+	case TypeSMTP:
+		if sc.SMTP == nil {
+			return nil, fmt.Errorf("smtp settings are required")
+		}
+		smtpConfig := *sc.SMTP
+		password, err := readValue(smtpConfig.Password)
+		if err != nil {
+			return nil, err
+		}
+		smtpConfig.Password = password
+		return NewSMTPSink(smtpConfig, timeout)
+	case TypeLog:
+		return NewLogSink(), nil
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", sc.Type)
+	}
+}
+
+// readValue returns the value as is, or the trimmed content of the file if the value starts with '@'
+func readValue(v string) (string, error) {
+	if !strings.HasPrefix(v, "@") {
+		return v, nil
+	}
+	data, err := os.ReadFile(strings.TrimPrefix(v, "@"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// logSink writes the messages to the log
+type logSink struct{}
+
+// NewLogSink returns a sink which logs every message, it is meant for local testing
+func NewLogSink() Sink {
+	return &logSink{}
+}
+
+func (s *logSink) Send(_ context.Context, m Message) error {
+	log.WithFields(logrus.Fields{
+		"notification": m.Notification,
+		"cluster_id":   m.ClusterID,
+		"firing":       m.Firing,
+		"severity":     m.Severity,
+	}).Infof("%s: %s", m.Summary, m.Description)
+	return nil
+}
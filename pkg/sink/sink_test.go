@@ -0,0 +1,206 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/onsi/gomega/ghttp"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// sequenceSink returns the given errors in order, then succeeds
+type sequenceSink struct {
+	errs  []error
+	calls int
+}
+
+func (s *sequenceSink) Send(_ context.Context, m Message) error {
+	s.calls++
+	if s.calls <= len(s.errs) {
+		return s.errs[s.calls-1]
+	}
+	return nil
+}
+
+var _ = Describe("Sinks", func() {
+
+	var testMessage Message
+
+	BeforeEach(func() {
+		retryInterval = time.Millisecond
+		testMessage = Message{
+			Notification: "test-notification",
+			ClusterID:    "test-cluster",
+			Summary:      "Issue Notification: test",
+			Description:  "test description",
+			Severity:     "Info",
+			Firing:       true,
+		}
+	})
+
+	Context("Registry", func() {
+		It("Retries a failed delivery", func() {
+			s := &sequenceSink{errs: []error{fmt.Errorf("unavailable")}}
+			r := NewRegistry()
+			r.Register("test", TypeWebhook, s, 2, DefaultDeliveryTimeout)
+			Expect(r.Send(context.Background(), "test", testMessage)).To(Succeed())
+			Expect(s.calls).To(Equal(2))
+		})
+		It("Gives up once the retries are spent", func() {
+			s := &sequenceSink{errs: []error{fmt.Errorf("unavailable"), fmt.Errorf("unavailable"), fmt.Errorf("unavailable")}}
+			r := NewRegistry()
+			r.Register("test", TypeWebhook, s, 1, DefaultDeliveryTimeout)
+			Expect(r.Send(context.Background(), "test", testMessage)).ToNot(Succeed())
+			Expect(s.calls).To(Equal(2))
+		})
+		It("Does not retry a permanent error", func() {
+			s := &sequenceSink{errs: []error{&permanentError{err: fmt.Errorf("bad request")}}}
+			r := NewRegistry()
+			r.Register("test", TypeWebhook, s, 3, DefaultDeliveryTimeout)
+			Expect(r.Send(context.Background(), "test", testMessage)).ToNot(Succeed())
+			Expect(s.calls).To(Equal(1))
+		})
+		It("Stops retrying once the context is done", func() {
+			retryInterval = time.Hour
+			s := &sequenceSink{errs: []error{fmt.Errorf("unavailable"), fmt.Errorf("unavailable")}}
+			r := NewRegistry()
+			r.Register("test", TypeWebhook, s, 3, DefaultDeliveryTimeout)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			err := r.Send(ctx, "test", testMessage)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(s.calls).To(Equal(1))
+		})
+		It("Stops retrying once the delivery timeout is reached", func() {
+			retryInterval = time.Hour
+			s := &sequenceSink{errs: []error{fmt.Errorf("unavailable"), fmt.Errorf("unavailable")}}
+			r := NewRegistry()
+			r.Register("test", TypeWebhook, s, 3, 10*time.Millisecond)
+			err := r.Send(context.Background(), "test", testMessage)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(s.calls).To(Equal(1))
+		})
+		It("Reports a sink which is not configured", func() {
+			Expect(NewRegistry().Send(context.Background(), "dummy", testMessage)).ToNot(Succeed())
+		})
+	})
+
+	Context("Configuration", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+		})
+
+		writeConfig := func(content string) string {
+			path := filepath.Join(dir, "sinks.yaml")
+			Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+			return path
+		}
+
+		It("Builds every configured sink", func() {
+			urlFile := filepath.Join(dir, "url")
+			Expect(os.WriteFile(urlFile, []byte("https://hooks.example.com/secret\n"), 0600)).To(Succeed())
+			c, err := LoadConfig(writeConfig(`
+sinks:
+- name: internal-slack
+  type: slack
+  url: "@` + urlFile + `"
+- name: internal-hook
+  type: webhook
+  url: https://example.com/hook
+  retries: 0
+  timeout: 5s
+- name: sre-mail
+  type: smtp
+  smtp:
+    host: smtp.example.com
+    from: ocm-agent@example.com
+    to: [sre@example.com]
+- name: local
+  type: log
+`))
+			Expect(err).ToNot(HaveOccurred())
+			r, err := NewRegistryFromConfig(c)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.Names()).To(Equal([]string{"internal-hook", "internal-slack", "local", "sre-mail"}))
+			Expect(r.sinks["internal-slack"].sink.(*webhookSink).url).To(Equal("https://hooks.example.com/secret"))
+			Expect(r.sinks["internal-hook"].retries).To(Equal(0))
+			Expect(r.sinks["internal-slack"].retries).To(Equal(DefaultRetries))
+		})
+		It("Rejects an unknown field", func() {
+			_, err := LoadConfig(writeConfig("sinks:\n- name: test\n  type: log\n  dummy: true\n"))
+			Expect(err).To(HaveOccurred())
+		})
+		It("Rejects an unknown sink type", func() {
+			_, err := NewRegistryFromConfig(&Config{Sinks: []SinkConfig{{Name: "test", Type: "pager"}}})
+			Expect(err).To(HaveOccurred())
+		})
+		It("Rejects the reserved service log name", func() {
+			_, err := NewRegistryFromConfig(&Config{Sinks: []SinkConfig{{Name: ServiceLog, Type: TypeLog}}})
+			Expect(err).To(HaveOccurred())
+		})
+		It("Rejects duplicate names", func() {
+			_, err := NewRegistryFromConfig(&Config{Sinks: []SinkConfig{{Name: "test", Type: TypeLog}, {Name: "test", Type: TypeLog}}})
+			Expect(err).To(HaveOccurred())
+		})
+		It("Rejects a delivery timeout which is not positive", func() {
+			_, err := NewRegistryFromConfig(&Config{Sinks: []SinkConfig{{Name: "test", Type: TypeLog, DeliveryTimeout: "0s"}}})
+			Expect(err).To(HaveOccurred())
+		})
+		It("Rejects a webhook without url", func() {
+			_, err := NewRegistryFromConfig(&Config{Sinks: []SinkConfig{{Name: "test", Type: TypeWebhook}}})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Webhook sinks", func() {
+		var server *ghttp.Server
+
+		BeforeEach(func() {
+			server = ghttp.NewServer()
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("Posts the message as JSON", func() {
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest(http.MethodPost, "/hook"),
+				ghttp.VerifyHeaderKV("X-Test", "value"),
+				ghttp.VerifyJSONRepresenting(testMessage),
+				ghttp.RespondWith(http.StatusOK, nil),
+			))
+			s := NewWebhookSink(server.URL()+"/hook", map[string]string{"X-Test": "value"}, time.Second)
+			Expect(s.Send(context.Background(), testMessage)).To(Succeed())
+		})
+		It("Posts a Slack message", func() {
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest(http.MethodPost, "/slack"),
+				ghttp.VerifyJSONRepresenting(slackPayload(testMessage)),
+				ghttp.RespondWith(http.StatusOK, "ok"),
+			))
+			s := NewSlackSink(server.URL()+"/slack", time.Second)
+			Expect(s.Send(context.Background(), testMessage)).To(Succeed())
+		})
+		It("Returns a permanent error on a client error", func() {
+			server.AppendHandlers(ghttp.RespondWith(http.StatusBadRequest, nil))
+			err := NewWebhookSink(server.URL(), nil, time.Second).Send(context.Background(), testMessage)
+			Expect(err).To(HaveOccurred())
+			Expect(isRetriable(err)).To(BeFalse())
+		})
+		It("Returns a retriable error on a server error", func() {
+			server.AppendHandlers(ghttp.RespondWith(http.StatusServiceUnavailable, nil))
+			err := NewWebhookSink(server.URL(), nil, time.Second).Send(context.Background(), testMessage)
+			Expect(err).To(HaveOccurred())
+			Expect(isRetriable(err)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,120 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smtpSink sends the message as a plain text email
+type smtpSink struct {
+	config  SMTPConfig
+	timeout time.Duration
+	// rootCAs verify the certificate of the server, the system roots are used when nil
+	rootCAs *x509.CertPool
+}
+
+// NewSMTPSink returns a sink sending the message as an email to the configured recipients
+func NewSMTPSink(c SMTPConfig, timeout time.Duration) (Sink, error) {
+	if c.Host == "" {
+		return nil, fmt.Errorf("smtp host is required")
+	}
+	if c.From == "" || len(c.To) == 0 {
+		return nil, fmt.Errorf("smtp sender and recipients are required")
+	}
+	if c.Port == 0 {
+		c.Port = 587
+	}
+	return &smtpSink{config: c, timeout: timeout}, nil
+}
+
+func (s *smtpSink) Send(ctx context.Context, m Message) error {
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	dialer := &net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	// The SMTP exchange does not take a context, interrupt it by expiring the connection when the context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	c, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	// Upgrade the connection when the server supports it, credentials are never sent in clear text
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: s.config.Host, RootCAs: s.rootCAs, MinVersion: tls.VersionTLS12})
+		if err != nil {
+			return err
+		}
+	}
+	if s.config.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host))
+		if err != nil {
+			return &permanentError{err: err}
+		}
+	}
+	err = c.Mail(s.config.From)
+	if err != nil {
+		return err
+	}
+	for _, to := range s.config.To {
+		err = c.Rcpt(to)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(s.email(m))
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// email formats the message as an RFC 5322 email
+func (s *smtpSink) email(m Message) []byte {
+	state := "Firing"
+	if !m.Firing {
+		state = "Resolved"
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.config.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.config.To, ", "))
+	fmt.Fprintf(&b, "Subject: [%s] %s\r\n", state, strings.ReplaceAll(m.Summary, "\n", " "))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&b, "Cluster: %s\r\nSeverity: %s\r\nNotification: %s\r\n\r\n%s\r\n", m.ClusterID, m.Severity, m.Notification, m.Description)
+	return b.Bytes()
+}
@@ -0,0 +1,187 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeSMTPServer accepts a single session over STARTTLS and records the credentials and the email it receives
+type fakeSMTPServer struct {
+	listener net.Listener
+	tls      *tls.Config
+	auth     chan string
+	data     chan string
+}
+
+// newFakeSMTPServer starts a server with a self-signed certificate for 127.0.0.1, returned to be trusted by the client
+func newFakeSMTPServer() (*fakeSMTPServer, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+	s := &fakeSMTPServer{
+		listener: listener,
+		tls:      &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}, MinVersion: tls.VersionTLS12},
+		auth:     make(chan string, 1),
+		data:     make(chan string, 1),
+	}
+	go s.serve()
+	return s, roots
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer GinkgoRecover()
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	reply := func(lines ...string) {
+		for _, l := range lines {
+			_, _ = w.WriteString(l + "\r\n")
+		}
+		_ = w.Flush()
+	}
+	secure := false
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case command == "EHLO" && !secure:
+			reply("250-fake", "250 STARTTLS")
+		case command == "EHLO":
+			reply("250-fake", "250 AUTH PLAIN")
+		case command == "STARTTLS":
+			reply("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tls)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			r, w = bufio.NewReader(tlsConn), bufio.NewWriter(tlsConn)
+			secure = true
+		case command == "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			s.auth <- string(credentials)
+			reply("235 authenticated")
+		case command == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.data <- data.String()
+			reply("250 queued")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+var _ = Describe("SMTP sinks", func() {
+
+	var (
+		server *fakeSMTPServer
+		roots  *x509.CertPool
+	)
+
+	BeforeEach(func() {
+		server, roots = newFakeSMTPServer()
+	})
+
+	AfterEach(func() {
+		_ = server.listener.Close()
+	})
+
+	It("Sends the email over STARTTLS with the credentials", func() {
+		sink := &smtpSink{
+			config: SMTPConfig{
+				Host:     "127.0.0.1",
+				Port:     server.port(),
+				Username: "ocm-agent",
+				Password: "secret",
+				From:     "ocm-agent@example.com",
+				To:       []string{"sre@example.com"},
+			},
+			timeout: 5 * time.Second,
+			rootCAs: roots,
+		}
+		err := sink.Send(context.Background(), Message{
+			Notification: "test-notification",
+			ClusterID:    "test-cluster",
+			Summary:      "Issue Notification: test",
+			Description:  "Something happened",
+			Firing:       true,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(<-server.auth).To(Equal("\x00ocm-agent\x00secret"))
+		data := <-server.data
+		Expect(data).To(ContainSubstring("Subject: [Firing] Issue Notification: test\r\n"))
+		Expect(data).To(ContainSubstring("Cluster: test-cluster\r\n"))
+	})
+
+	It("Does not send the credentials to a server whose certificate can't be verified", func() {
+		sink := &smtpSink{
+			config: SMTPConfig{
+				Host:     "127.0.0.1",
+				Port:     server.port(),
+				Username: "ocm-agent",
+				Password: "secret",
+				From:     "ocm-agent@example.com",
+				To:       []string{"sre@example.com"},
+			},
+			timeout: 5 * time.Second,
+		}
+		err := sink.Send(context.Background(), Message{Notification: "test-notification", Firing: true})
+		Expect(err).To(HaveOccurred())
+		Expect(server.auth).ToNot(Receive())
+	})
+})
@@ -0,0 +1,84 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// webhookSink posts the message as JSON to an HTTP endpoint
+type webhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	payload func(m Message) interface{}
+}
+
+// slackMessage is the payload of a Slack compatible incoming webhook
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// NewWebhookSink returns a sink posting the message as JSON to the given URL
+func NewWebhookSink(url string, headers map[string]string, timeout time.Duration) Sink {
+	return &webhookSink{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: timeout},
+		payload: func(m Message) interface{} { return m },
+	}
+}
+
+// NewSlackSink returns a sink posting the message to a Slack compatible incoming webhook
+func NewSlackSink(url string, timeout time.Duration) Sink {
+	return &webhookSink{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		payload: slackPayload,
+	}
+}
+
+func slackPayload(m Message) interface{} {
+	state := "Firing"
+	if !m.Firing {
+		state = "Resolved"
+	}
+	return slackMessage{
+		Text: fmt.Sprintf("*[%s] %s*\nCluster: `%s`\nSeverity: %s\n%s", state, m.Summary, m.ClusterID, m.Severity, m.Description),
+	}
+}
+
+func (s *webhookSink) Send(ctx context.Context, m Message) error {
+	body, err := json.Marshal(s.payload(m))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("unexpected response status %d", res.StatusCode)
+	// A client error won't be fixed by retrying, except when being throttled
+	if res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err: err}
+	}
+	return err
+}
@@ -0,0 +1,226 @@
+package suppression
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/common/model"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/ocm-agent/pkg/logging"
+)
+
+var log = logging.Subsystem(logging.SubsystemHandlers)
+
+// Config is the content of the suppression configuration file, usually mounted from a ConfigMap
+type Config struct {
+	Rules []RuleConfig `json:"rules"`
+}
+
+// RuleConfig suppresses the notifications of the alerts matching all its matchers while one of its windows is
+// active. A rule without matchers applies to every alert, a rule without windows is always active.
+type RuleConfig struct {
+	Name     string         `json:"name"`
+	Matchers []string       `json:"matchers,omitempty"`
+	Windows  []WindowConfig `json:"windows,omitempty"`
+}
+
+// WindowConfig is either a one-off window from Start to End, or a window recurring at the time of day At on the
+// given days of the week for Duration, in the time zone of the window
+type WindowConfig struct {
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+
+	// Days are the days of the week the window starts, e.g. Sat, every day if empty
+	Days []string `json:"days,omitempty"`
+	// At is the time of day the window starts, e.g. 02:00
+	At       string `json:"at,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	// TimeZone is the IANA name of the time zone of a recurring window, UTC if empty
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// Rules are the parsed suppression rules
+type Rules []rule
+
+type rule struct {
+	name     string
+	matchers labels.Matchers
+	windows  []window
+}
+
+type window struct {
+	// start and end bound a one-off window
+	start, end time.Time
+
+	// days, at and duration describe a recurring window in the location
+	days     map[time.Weekday]bool
+	at       time.Duration
+	duration time.Duration
+	location *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// LoadConfig reads the suppression configuration file, YAML or JSON
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path) //#nosec G304 -- path is set by the operator
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	err = yaml.UnmarshalStrict(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse suppression configuration %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// NewRules parses the rules of the configuration
+func NewRules(c *Config) (Rules, error) {
+	rules := make(Rules, 0, len(c.Rules))
+	names := map[string]bool{}
+	for _, rc := range c.Rules {
+		if rc.Name == "" {
+			return nil, fmt.Errorf("suppression rule has no name")
+		}
+		if names[rc.Name] {
+			return nil, fmt.Errorf("suppression rule %s is defined twice", rc.Name)
+		}
+		names[rc.Name] = true
+		if len(rc.Matchers) == 0 && len(rc.Windows) == 0 {
+			// Such a rule would suppress every notification forever
+			return nil, fmt.Errorf("suppression rule %s has neither matchers nor windows", rc.Name)
+		}
+		r := rule{name: rc.Name}
+		for _, v := range rc.Matchers {
+			m, err := labels.ParseMatcher(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid matcher of suppression rule %s: %w", rc.Name, err)
+			}
+			r.matchers = append(r.matchers, m)
+		}
+		for _, wc := range rc.Windows {
+			w, err := newWindow(wc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid window of suppression rule %s: %w", rc.Name, err)
+			}
+			r.windows = append(r.windows, w)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func newWindow(wc WindowConfig) (window, error) {
+	if wc.Start != nil || wc.End != nil {
+		if wc.Start == nil || wc.End == nil || !wc.End.After(*wc.Start) {
+			return window{}, fmt.Errorf("a one-off window needs a start before its end")
+		}
+		if len(wc.Days) > 0 || wc.At != "" || wc.Duration != "" || wc.TimeZone != "" {
+			return window{}, fmt.Errorf("a one-off window can't recur")
+		}
+		return window{start: *wc.Start, end: *wc.End}, nil
+	}
+
+	w := window{location: time.UTC}
+	at, err := time.Parse("15:04", wc.At)
+	if err != nil {
+		return window{}, fmt.Errorf("invalid time of day %q, expected HH:MM", wc.At)
+	}
+	w.at = time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute
+	w.duration, err = time.ParseDuration(wc.Duration)
+	if err != nil || w.duration <= 0 {
+		return window{}, fmt.Errorf("invalid duration %q", wc.Duration)
+	}
+	if wc.TimeZone != "" {
+		w.location, err = time.LoadLocation(wc.TimeZone)
+		if err != nil {
+			return window{}, fmt.Errorf("invalid time zone %q: %w", wc.TimeZone, err)
+		}
+	}
+	if len(wc.Days) > 0 {
+		w.days = map[time.Weekday]bool{}
+		for _, d := range wc.Days {
+			day, ok := weekdays[strings.ToLower(d)]
+			if !ok {
+				return window{}, fmt.Errorf("invalid day %q, expected one of Mon, Tue, Wed, Thu, Fri, Sat, Sun", d)
+			}
+			w.days[day] = true
+		}
+	}
+	return w, nil
+}
+
+// active returns whether the window is active at the given time and when it ends
+func (w window) active(now time.Time) (time.Time, bool) {
+	if w.location == nil {
+		return w.end, !now.Before(w.start) && now.Before(w.end)
+	}
+	// The occurrence active now started at most as many days ago as the window lasts
+	local := now.In(w.location)
+	for d := 0; d <= int(w.duration/(24*time.Hour))+1; d++ {
+		day := local.AddDate(0, 0, -d)
+		if w.days != nil && !w.days[day.Weekday()] {
+			continue
+		}
+		// The time of day is set from midnight so occurrences follow the daylight saving changes of the location
+		start := time.Date(day.Year(), day.Month(), day.Day(), int(w.at/time.Hour), int(w.at%time.Hour/time.Minute), 0, 0, w.location)
+		end := start.Add(w.duration)
+		if !now.Before(start) && now.Before(end) {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Match returns the name of the rule suppressing the notification of an alert with the given labels at the given
+// time, and when the suppression ends, which is the zero time for a rule without windows. When several rules
+// suppress the alert, the one suppressing it the longest is returned.
+func (rules Rules) Match(alertLabels map[string]string, now time.Time) (string, time.Time, bool) {
+	lset := make(model.LabelSet, len(alertLabels))
+	for k, v := range alertLabels {
+		lset[model.LabelName(k)] = model.LabelValue(v)
+	}
+
+	var name string
+	var until time.Time
+	var matched bool
+	for _, r := range rules {
+		if !r.matchers.Matches(lset) {
+			continue
+		}
+		end, ok := r.active(now)
+		if !ok {
+			continue
+		}
+		if !matched || (!until.IsZero() && (end.IsZero() || end.After(until))) {
+			name, until, matched = r.name, end, true
+		}
+	}
+	return name, until, matched
+}
+
+// active returns whether one of the windows of the rule is active and when the last of them ends
+func (r rule) active(now time.Time) (time.Time, bool) {
+	if len(r.windows) == 0 {
+		return time.Time{}, true
+	}
+	var until time.Time
+	var active bool
+	for _, w := range r.windows {
+		if end, ok := w.active(now); ok {
+			active = true
+			if end.After(until) {
+				until = end
+			}
+		}
+	}
+	return until, active
+}
@@ -0,0 +1,13 @@
+package suppression
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSuppression(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Suppression Suite")
+}
@@ -0,0 +1,192 @@
+package suppression
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/alertmanager/template"
+)
+
+var _ = Describe("Suppression", func() {
+	var (
+		dir       string
+		testAlert template.Alert
+	)
+
+	writeConfig := func(content string) string {
+		path := filepath.Join(dir, "suppression.yaml")
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		return path
+	}
+
+	mustRules := func(content string) Rules {
+		c, err := LoadConfig(writeConfig(content))
+		Expect(err).ToNot(HaveOccurred())
+		rules, err := NewRules(c)
+		Expect(err).ToNot(HaveOccurred())
+		return rules
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		testAlert = template.Alert{
+			Status:      "firing",
+			Labels:      map[string]string{"alertname": "KubeNodeNotReady", "namespace": "openshift-monitoring"},
+			Fingerprint: "0123456789abcdef",
+		}
+	})
+
+	Context("When loading the configuration", func() {
+		It("Rejects an unknown field", func() {
+			_, err := LoadConfig(writeConfig("rules:\n- name: test\n  dummy: true\n"))
+			Expect(err).To(HaveOccurred())
+		})
+		It("Rejects a rule without name", func() {
+			_, err := NewRules(&Config{Rules: []RuleConfig{{Matchers: []string{`alertname="A"`}}}})
+			Expect(err).To(HaveOccurred())
+		})
+		It("Rejects duplicate names", func() {
+			_, err := NewRules(&Config{Rules: []RuleConfig{{Name: "a", Matchers: []string{`alertname="A"`}}, {Name: "a", Matchers: []string{`alertname="B"`}}}})
+			Expect(err).To(HaveOccurred())
+		})
+		It("Rejects a rule suppressing every notification forever", func() {
+			_, err := NewRules(&Config{Rules: []RuleConfig{{Name: "a"}}})
+			Expect(err).To(HaveOccurred())
+		})
+		It("Rejects an invalid matcher", func() {
+			_, err := NewRules(&Config{Rules: []RuleConfig{{Name: "a", Matchers: []string{"not a matcher"}}}})
+			Expect(err).To(HaveOccurred())
+		})
+		It("Rejects invalid windows", func() {
+			start := time.Now()
+			end := start.Add(-time.Hour)
+			for _, w := range []WindowConfig{
+				{Start: &start},
+				{Start: &start, End: &end},
+				{At: "2am", Duration: "1h"},
+				{At: "02:00", Duration: "-1h"},
+				{At: "02:00", Duration: "1h", TimeZone: "Mars/Olympus"},
+				{At: "02:00", Duration: "1h", Days: []string{"Someday"}},
+			} {
+				_, err := NewRules(&Config{Rules: []RuleConfig{{Name: "a", Windows: []WindowConfig{w}}}})
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+
+	Context("When matching an alert", func() {
+		It("Suppresses the alerts matching a rule without windows forever", func() {
+			rules := mustRules("rules:\n- name: node\n  matchers: ['alertname=~\"KubeNode.*\"']\n")
+			name, until, ok := rules.Match(testAlert.Labels, time.Now())
+			Expect(ok).To(BeTrue())
+			Expect(name).To(Equal("node"))
+			Expect(until.IsZero()).To(BeTrue())
+			testAlert.Labels["alertname"] = "KubePodCrashLooping"
+			_, _, ok = rules.Match(testAlert.Labels, time.Now())
+			Expect(ok).To(BeFalse())
+		})
+		It("Suppresses every alert during a one-off window", func() {
+			rules := mustRules("rules:\n- name: upgrade\n  windows:\n  - start: 2026-10-20T02:00:00+02:00\n    end: 2026-10-20T06:00:00+02:00\n")
+			name, until, ok := rules.Match(testAlert.Labels, time.Date(2026, 10, 20, 1, 0, 0, 0, time.UTC))
+			Expect(ok).To(BeTrue())
+			Expect(name).To(Equal("upgrade"))
+			Expect(until).To(BeTemporally("==", time.Date(2026, 10, 20, 4, 0, 0, 0, time.UTC)))
+			_, _, ok = rules.Match(testAlert.Labels, time.Date(2026, 10, 20, 4, 0, 0, 0, time.UTC))
+			Expect(ok).To(BeFalse())
+			_, _, ok = rules.Match(testAlert.Labels, time.Date(2026, 10, 19, 23, 59, 0, 0, time.UTC))
+			Expect(ok).To(BeFalse())
+		})
+		It("Suppresses the alerts during a recurring window in its time zone", func() {
+			rules := mustRules("rules:\n- name: weekend\n  windows:\n  - days: [Sat]\n    at: '22:00'\n    duration: 4h\n    timeZone: Europe/Paris\n")
+			paris, err := time.LoadLocation("Europe/Paris")
+			Expect(err).ToNot(HaveOccurred())
+			// 2026-10-17 is a Saturday, the window runs over midnight
+			_, until, ok := rules.Match(testAlert.Labels, time.Date(2026, 10, 18, 1, 0, 0, 0, paris))
+			Expect(ok).To(BeTrue())
+			Expect(until).To(BeTemporally("==", time.Date(2026, 10, 18, 2, 0, 0, 0, paris)))
+			_, _, ok = rules.Match(testAlert.Labels, time.Date(2026, 10, 17, 21, 59, 0, 0, paris))
+			Expect(ok).To(BeFalse())
+			_, _, ok = rules.Match(testAlert.Labels, time.Date(2026, 10, 18, 22, 30, 0, 0, paris))
+			Expect(ok).To(BeFalse())
+		})
+		It("Follows the daylight saving changes of the time zone", func() {
+			rules := mustRules("rules:\n- name: nightly\n  windows:\n  - at: '02:30'\n    duration: 1h\n    timeZone: America/New_York\n")
+			// Daylight saving time ended on 2026-11-01, 02:30 is 07:30 UTC afterwards instead of 06:30
+			_, _, ok := rules.Match(testAlert.Labels, time.Date(2026, 11, 2, 7, 45, 0, 0, time.UTC))
+			Expect(ok).To(BeTrue())
+			_, _, ok = rules.Match(testAlert.Labels, time.Date(2026, 10, 30, 7, 45, 0, 0, time.UTC))
+			Expect(ok).To(BeFalse())
+		})
+		It("Returns the rule suppressing the alert the longest", func() {
+			rules := mustRules(`rules:
+- name: short
+  windows:
+  - start: 2026-10-20T00:00:00Z
+    end: 2026-10-20T01:00:00Z
+- name: long
+  windows:
+  - start: 2026-10-20T00:00:00Z
+    end: 2026-10-20T03:00:00Z
+`)
+			name, _, ok := rules.Match(testAlert.Labels, time.Date(2026, 10, 20, 0, 30, 0, 0, time.UTC))
+			Expect(ok).To(BeTrue())
+			Expect(name).To(Equal("long"))
+		})
+	})
+
+	Context("When suppressing alerts", func() {
+		var suppressor *Suppressor
+
+		BeforeEach(func() {
+			var err error
+			suppressor, err = NewSuppressor(writeConfig("rules:\n- name: node\n  matchers: ['alertname=\"KubeNodeNotReady\"']\n"), time.Hour)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("Keeps the suppressed alerts until no rule suppresses them", func() {
+			_, _, ok := suppressor.Suppress(testAlert, time.Now())
+			Expect(ok).To(BeTrue())
+			Expect(suppressor.Pending()).To(Equal(1))
+			Expect(suppressor.release(time.Now())).To(BeEmpty())
+
+			writeConfig("rules: []\n")
+			Expect(suppressor.release(time.Now().Add(time.Minute))).To(Equal([]template.Alert{testAlert}))
+			Expect(suppressor.Pending()).To(Equal(0))
+		})
+		It("Keeps the previous rules when the configuration becomes invalid", func() {
+			writeConfig("rules:\n- name: node\n  matchers: ['not a matcher']\n")
+			_, _, ok := suppressor.Suppress(testAlert, time.Now())
+			Expect(ok).To(BeTrue())
+		})
+		It("Forgets a suppressed alert which is resolved", func() {
+			suppressor.Suppress(testAlert, time.Now())
+			suppressor.Resolve(testAlert)
+			Expect(suppressor.Pending()).To(Equal(0))
+		})
+		It("Forgets a suppressed alert which ended or was not received within the retention", func() {
+			suppressor.Suppress(testAlert, time.Now().Add(-2*time.Hour))
+			ended := testAlert
+			ended.Fingerprint = "fedcba9876543210"
+			ended.EndsAt = time.Now().Add(-time.Minute)
+			suppressor.Suppress(ended, time.Now())
+			writeConfig("rules: []\n")
+			Expect(suppressor.release(time.Now())).To(BeEmpty())
+			Expect(suppressor.Pending()).To(Equal(0))
+		})
+		It("Notifies the alerts which are no longer suppressed", func() {
+			suppressor.Suppress(testAlert, time.Now())
+			writeConfig("rules: []\n")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			notified := make(chan []template.Alert, 1)
+			go suppressor.Run(ctx, 10*time.Millisecond, func(ctx context.Context, alerts []template.Alert) {
+				notified <- alerts
+			})
+			Eventually(notified).Should(Receive(Equal([]template.Alert{testAlert})))
+		})
+	})
+})
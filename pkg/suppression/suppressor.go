@@ -0,0 +1,155 @@
+package suppression
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/openshift/ocm-agent/pkg/metrics"
+)
+
+// Suppressor suppresses the notifications of alerts by the rules of a configuration file, reloaded when it
+// changes, and keeps the suppressed alerts to notify them once they are no longer suppressed
+type Suppressor struct {
+	path      string
+	retention time.Duration
+
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+	rules   Rules
+	pending map[string]pendingAlert
+}
+
+// pendingAlert is a firing alert whose notification was suppressed
+type pendingAlert struct {
+	alert    template.Alert
+	received time.Time
+}
+
+// NewSuppressor loads the rules of the configuration file. The suppressed alerts which are not received again
+// within the retention are forgotten, Alertmanager sending the alerts still firing again.
+func NewSuppressor(path string, retention time.Duration) (*Suppressor, error) {
+	s := &Suppressor{path: path, retention: retention, pending: map[string]pendingAlert{}}
+	c, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	s.rules, err = NewRules(c)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	return s, nil
+}
+
+// currentRules returns the rules of the configuration file, reloaded when its modification time or size changed.
+// The previous rules are kept when the file can't be reloaded. It must be called with the mutex held.
+func (s *Suppressor) currentRules() Rules {
+	info, err := os.Stat(s.path)
+	if err != nil || (info.ModTime().Equal(s.modTime) && info.Size() == s.size) {
+		return s.rules
+	}
+	// The file is only reloaded once per change, even if it is invalid
+	s.modTime, s.size = info.ModTime(), info.Size()
+	c, err := LoadConfig(s.path)
+	if err == nil {
+		var rules Rules
+		rules, err = NewRules(c)
+		if err == nil {
+			log.Infof("Reloaded suppression configuration %s", s.path)
+			s.rules = rules
+			return s.rules
+		}
+	}
+	log.WithError(err).Warnf("Unable to reload suppression configuration %s, keeping the previous rules", s.path)
+	return s.rules
+}
+
+// Suppress returns the name of the rule suppressing the notification of a firing alert and when the suppression
+// ends, the zero time for a rule without windows. The suppressed alert is kept to be notified once it is no longer
+// suppressed.
+func (s *Suppressor) Suppress(alert template.Alert, now time.Time) (string, time.Time, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	name, until, ok := s.currentRules().Match(alert.Labels, now)
+	if ok {
+		s.pending[alertKey(alert)] = pendingAlert{alert: alert, received: now}
+		metrics.MetricSuppressedAlertsPending.Set(float64(len(s.pending)))
+	}
+	return name, until, ok
+}
+
+// Resolve forgets a suppressed alert which is resolved, it no longer needs to be notified
+func (s *Suppressor) Resolve(alert template.Alert) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.pending, alertKey(alert))
+	metrics.MetricSuppressedAlertsPending.Set(float64(len(s.pending)))
+}
+
+// Pending returns the number of suppressed alerts waiting to be notified
+func (s *Suppressor) Pending() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.pending)
+}
+
+// Run re-evaluates the suppressed alerts every interval until the context is done. The alerts which are no longer
+// suppressed are passed to notify, in the order they were received.
+func (s *Suppressor) Run(ctx context.Context, interval time.Duration, notify func(ctx context.Context, alerts []template.Alert)) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		alerts := s.release(time.Now())
+		if len(alerts) > 0 {
+			log.WithField("alerts", len(alerts)).Info("notifying the alerts which are no longer suppressed")
+			notify(ctx, alerts)
+		}
+	}, interval)
+}
+
+// release removes and returns the suppressed alerts which are no longer suppressed at the given time, forgetting
+// the ones which ended or were not received within the retention
+func (s *Suppressor) release(now time.Time) []template.Alert {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	rules := s.currentRules()
+	var released []pendingAlert
+	for key, p := range s.pending {
+		if (!p.alert.EndsAt.IsZero() && !p.alert.EndsAt.After(now)) || (s.retention > 0 && now.Sub(p.received) > s.retention) {
+			delete(s.pending, key)
+			continue
+		}
+		if _, _, ok := rules.Match(p.alert.Labels, now); ok {
+			continue
+		}
+		delete(s.pending, key)
+		released = append(released, p)
+	}
+	metrics.MetricSuppressedAlertsPending.Set(float64(len(s.pending)))
+	sort.SliceStable(released, func(i, j int) bool { return released[i].received.Before(released[j].received) })
+	alerts := make([]template.Alert, 0, len(released))
+	for _, p := range released {
+		alerts = append(alerts, p.alert)
+	}
+	return alerts
+}
+
+// alertKey identifies an alert by its fingerprint, or by its labels when Alertmanager did not set it
+func alertKey(alert template.Alert) string {
+	if alert.Fingerprint != "" {
+		return alert.Fingerprint
+	}
+	lset := make(model.LabelSet, len(alert.Labels))
+	for k, v := range alert.Labels {
+		lset[model.LabelName(k)] = model.LabelValue(v)
+	}
+	return lset.Fingerprint().String()
+}